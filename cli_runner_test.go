@@ -17,8 +17,13 @@ type runningCLI struct {
 }
 
 func startCLI(args []string, env map[string]string, workDir, binaryPath string) (*runningCLI, error) {
+	return startCLIInDir(args, env, workDir, "", binaryPath)
+}
+
+func startCLIInDir(args []string, env map[string]string, workDir, dir, binaryPath string) (*runningCLI, error) {
 
 	cmd := exec.Command(binaryPath, args...)
+	cmd.Dir = dir
 	cmd.Env = append(
 		os.Environ(),
 		fmt.Sprintf("XDG_CONFIG_HOME=%s", workDir),
@@ -67,7 +72,8 @@ func startCLI(args []string, env map[string]string, workDir, binaryPath string)
 				// all good, server is down
 			default:
 				err = cmd.Process.Kill()
-				if err != nil {
+				// the process may exit on its own after the check above
+				if err != nil && !errors.Is(err, os.ErrProcessDone) {
 					return fmt.Errorf("while killing process: %w", err)
 				}
 				select {
@@ -86,8 +92,13 @@ func startCLI(args []string, env map[string]string, workDir, binaryPath string)
 }
 
 func runCLI(args []string, env map[string]string, workDir, binaryPath string) (stdout, stderr string, err error) {
+	return runCLIInDir(args, env, workDir, "", binaryPath)
+}
+
+func runCLIInDir(args []string, env map[string]string, workDir, dir, binaryPath string) (stdout, stderr string, err error) {
 
 	cmd := exec.Command(binaryPath, args...)
+	cmd.Dir = dir
 	cmd.Env = append(
 		os.Environ(),
 		fmt.Sprintf("XDG_CONFIG_HOME=%s", workDir),
@@ -105,7 +116,7 @@ func runCLI(args []string, env map[string]string, workDir, binaryPath string) (s
 
 	err = cmd.Run()
 	if err != nil {
-		return stout.String(), sterr.String(), fmt.Errorf("while running cmd: %w", err)
+		return stout.String(), sterr.String(), fmt.Errorf("while running cmd: %w\n%s", err, sterr.String())
 	}
 
 	return stout.String(), sterr.String(), nil
@@ -0,0 +1,18 @@
+package access
+
+import (
+	"github.com/draganm/kartusche/command/access/grant"
+	"github.com/draganm/kartusche/command/access/ls"
+	"github.com/draganm/kartusche/command/access/revoke"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "access",
+	Usage: "manage the users with access to the kartusche",
+	Subcommands: []*cli.Command{
+		grant.Command,
+		revoke.Command,
+		ls.Command,
+	},
+}
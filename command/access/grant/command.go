@@ -0,0 +1,65 @@
+package grant
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/server"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:      "grant",
+	Usage:     "grant a user a role for the kartusche, replacing the role the user had",
+	ArgsUsage: "<user id>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+		&cli.StringFlag{
+			Name:  "role",
+			Usage: "viewer, developer or admin",
+			Value: string(server.RoleViewer),
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while granting access: %w", err), 1)
+			}
+		}()
+
+		if c.NArg() != 1 {
+			return fmt.Errorf("expected one argument (user id), got %d", c.NArg())
+		}
+
+		role := server.Role(c.String("role"))
+		if !role.IsValid() {
+			return fmt.Errorf("unknown role %q", role)
+		}
+
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		return client.CallAPI(
+			serverBaseURL,
+			"PUT", path.Join("kartusches", cfg.Name, "access", c.Args().First()),
+			nil,
+			client.JSONEncoder(server.GrantRequest{Role: role}),
+			nil,
+			204,
+		)
+
+	},
+}
@@ -0,0 +1,68 @@
+package ls
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/server"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "ls",
+	Usage: "list the users with access to the kartusche",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while listing access: %w", err), 1)
+			}
+		}()
+
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		ka := server.KartuscheAccess{}
+		err = client.CallAPI(serverBaseURL, "GET", path.Join("kartusches", cfg.Name, "access"), nil, nil, client.JSONDecoder(&ka), 200)
+		if err != nil {
+			return err
+		}
+
+		if ka.Owner == "" {
+			fmt.Println("kartusche has no owner, all users have the admin role")
+			return nil
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "USER\tROLE\tGRANTED BY\tGRANTED AT")
+		fmt.Fprintf(tw, "%s\t%s (owner)\t\t\n", ka.Owner, server.RoleAdmin)
+		for _, g := range ka.Grants {
+			role := g.Role
+			if role == "" {
+				role = server.RoleDeveloper
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", g.UserID, role, g.GrantedBy, g.GrantedAt.Format(time.RFC3339))
+		}
+
+		return tw.Flush()
+
+	},
+}
@@ -0,0 +1,47 @@
+package revoke
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:      "revoke",
+	Usage:     "revoke the access of a user to the kartusche",
+	ArgsUsage: "<user id>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while revoking access: %w", err), 1)
+			}
+		}()
+
+		if c.NArg() != 1 {
+			return fmt.Errorf("expected one argument (user id), got %d", c.NArg())
+		}
+
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		return client.CallAPI(serverBaseURL, "DELETE", path.Join("kartusches", cfg.Name, "access", c.Args().First()), nil, nil, nil, 204)
+
+	},
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/server"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "audit",
+	Usage: "list administrative actions on the server, the most recent one first",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+		&cli.StringFlag{
+			Name:  "kartusche",
+			Usage: "only list actions on this kartusche",
+		},
+		&cli.StringFlag{
+			Name:  "user",
+			Usage: "only list actions of this user",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "maximum number of listed actions",
+			Value: 100,
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while listing audit log: %w", err), 1)
+			}
+		}()
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		q := url.Values{}
+		q.Set("limit", strconv.Itoa(c.Int("limit")))
+		if c.IsSet("kartusche") {
+			q.Set("kartusche", c.String("kartusche"))
+		}
+		if c.IsSet("user") {
+			q.Set("user", c.String("user"))
+		}
+
+		entries := []server.AuditEntry{}
+		err = client.CallAPI(serverBaseURL, "GET", "audit", q, nil, client.JSONDecoder(&entries), 200)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tACTOR\tACTION\tKARTUSCHE\tSOURCE\tOUTCOME")
+		for _, e := range entries {
+			outcome := e.Outcome
+			if e.Status != 0 {
+				outcome = fmt.Sprintf("%s (%d)", e.Outcome, e.Status)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Actor(), e.Action, e.Kartusche, e.SourceIP, outcome)
+		}
+
+		return tw.Flush()
+
+	},
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"github.com/draganm/kartusche/command/auth/login"
+	"github.com/draganm/kartusche/command/auth/logout"
 	"github.com/draganm/kartusche/command/auth/tokens"
 	"github.com/draganm/kartusche/command/auth/workspace"
 	"github.com/urfave/cli/v2"
@@ -11,6 +12,7 @@ var Command = &cli.Command{
 	Name: "auth",
 	Subcommands: []*cli.Command{
 		login.Command,
+		logout.Command,
 		tokens.Command,
 		workspace.Command,
 	},
@@ -1,6 +1,7 @@
 package login
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"time"
@@ -81,6 +82,10 @@ var Command = &cli.Command{
 				continue
 			}
 
+			if tr.Error == "expired_token" {
+				return errors.New("login request has expired, please log in again")
+			}
+
 			if tr.Error != "" {
 				return fmt.Errorf("auth error: %s", tr.Error)
 			}
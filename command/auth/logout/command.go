@@ -0,0 +1,46 @@
+package logout
+
+import (
+	"fmt"
+
+	"github.com/draganm/kartusche/common/auth"
+	"github.com/draganm/kartusche/common/client"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:      "logout",
+	Usage:     "revoke the token of the server and remove it from the local config",
+	ArgsUsage: "<server url>",
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while logging out: %w", err), 1)
+			}
+		}()
+
+		if c.NArg() != 1 {
+			return fmt.Errorf("expected one argument (server url), got %d", c.NArg())
+		}
+
+		serverURL := c.Args().First()
+
+		// the token is removed even if revoking fails, e.g. because it has already expired or was revoked
+		revokeErr := client.CallAPI(serverURL, "DELETE", "tokens/current", nil, nil, nil, 204)
+
+		err = auth.RemoveTokenForServer(serverURL)
+		if err != nil {
+			return err
+		}
+
+		if revokeErr != nil {
+			fmt.Printf("removed the token, but could not revoke it on the server: %s\n", revokeErr)
+		}
+
+		fmt.Println("logged out")
+
+		return nil
+
+	},
+}
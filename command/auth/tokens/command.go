@@ -4,13 +4,22 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/draganm/kartusche/command/auth/tokens/create"
+	"github.com/draganm/kartusche/command/auth/tokens/ls"
+	"github.com/draganm/kartusche/command/auth/tokens/revoke"
 	"github.com/draganm/kartusche/common/auth"
 	"github.com/urfave/cli/v2"
 )
 
 var Command = &cli.Command{
 	Name:  "tokens",
+	Usage: "print the locally stored tokens, or manage the tokens on the server",
 	Flags: []cli.Flag{},
+	Subcommands: []*cli.Command{
+		ls.Command,
+		revoke.Command,
+		create.Command,
+	},
 	Action: func(c *cli.Context) (err error) {
 
 		defer func() {
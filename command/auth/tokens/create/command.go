@@ -0,0 +1,89 @@
+package create
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/server"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "create",
+	Usage: "create a token scoped to a kartusche and actions, e.g. for a CI pipeline",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+		&cli.StringFlag{
+			Name:  "kartusche",
+			Usage: "kartusche the token can be used for, defaults to the current kartusche",
+		},
+		&cli.StringSliceFlag{
+			Name:  "action",
+			Usage: "action the token can be used for: read, upload, update-code or rollback",
+			Value: cli.NewStringSlice(server.ActionUpdateCode),
+		},
+		&cli.DurationFlag{
+			Name:  "ttl",
+			Usage: "time after which the token expires, defaults to and is limited by the token ttl of the server",
+		},
+		&cli.StringFlag{
+			Name: "description",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while creating token: %w", err), 1)
+			}
+		}()
+
+		kartusche := c.String("kartusche")
+		if kartusche == "" {
+			cfg, err := config.Current()
+			if err != nil {
+				return err
+			}
+			kartusche = cfg.Name
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		ttl := ""
+		if c.IsSet("ttl") {
+			ttl = c.Duration("ttl").String()
+		}
+
+		ctr := &server.CreateTokenResponse{}
+		err = client.CallAPI(
+			serverBaseURL,
+			"POST", "tokens",
+			nil,
+			client.JSONEncoder(server.CreateTokenRequest{
+				Kartusche:   kartusche,
+				Actions:     c.StringSlice("action"),
+				TTL:         ttl,
+				Description: c.String("description"),
+			}),
+			client.JSONDecoder(ctr),
+			200,
+		)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("created token %s, expiring at %s\n", ctr.ID, ctr.ExpiresAt.Format(time.RFC3339))
+		fmt.Println(ctr.Token)
+
+		return nil
+
+	},
+}
@@ -0,0 +1,67 @@
+package ls
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/server"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "ls",
+	Usage: "list the tokens of the user on the server",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while listing tokens: %w", err), 1)
+			}
+		}()
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		tokens := []server.TokenInfo{}
+		err = client.CallAPI(serverBaseURL, "GET", "tokens", nil, nil, client.JSONDecoder(&tokens), 200)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tCREATED\tEXPIRES\tSCOPE\tDESCRIPTION")
+		for _, t := range tokens {
+			id := t.ID
+			if t.Current {
+				id += " (current)"
+			}
+
+			expires := "never"
+			if t.ExpiresAt != nil {
+				expires = t.ExpiresAt.Format(time.RFC3339)
+			}
+
+			scope := "all"
+			if t.Kartusche != "" {
+				scope = fmt.Sprintf("%s: %s", t.Kartusche, strings.Join(t.Actions, ","))
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", id, t.CreatedAt.Format(time.RFC3339), expires, scope, t.Description)
+		}
+
+		return tw.Flush()
+
+	},
+}
@@ -0,0 +1,41 @@
+package revoke
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:      "revoke",
+	Usage:     "revoke a token of the user on the server",
+	ArgsUsage: "<token id>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while revoking token: %w", err), 1)
+			}
+		}()
+
+		if c.NArg() != 1 {
+			return fmt.Errorf("expected one argument (token id), got %d", c.NArg())
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		return client.CallAPI(serverBaseURL, "DELETE", path.Join("tokens", c.Args().First()), nil, nil, nil, 204)
+
+	},
+}
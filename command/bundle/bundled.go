@@ -0,0 +1,76 @@
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/draganm/kartusche/command/run"
+	"github.com/draganm/kartusche/common/bundle"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+)
+
+// RunBundled serves the kartusche embedded in the executable.
+// On the first start the kartusche is copied to the data dir, subsequent
+// starts keep using that copy so the data survives restarts.
+func RunBundled(b *bundle.Bundle) {
+	app := &cli.App{
+		Name: b.Name,
+		Flags: append(
+			[]cli.Flag{
+				&cli.StringFlag{
+					Name:    "data-dir",
+					EnvVars: []string{"KARTUSCHE_DATA_DIR"},
+				},
+			},
+			run.Flags...,
+		),
+		Action: func(c *cli.Context) (err error) {
+			defer func() {
+				if err != nil {
+					err = cli.Exit(fmt.Errorf("while running %s: %w", b.Name, err), 1)
+				}
+			}()
+
+			dataDir := c.String("data-dir")
+			if dataDir == "" {
+				dataDir, err = defaultDataDir(b.Name)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = os.MkdirAll(dataDir, 0700)
+			if err != nil {
+				return fmt.Errorf("while creating data dir %s: %w", dataDir, err)
+			}
+
+			fileName := filepath.Join(dataDir, fmt.Sprintf("%s.kartusche", b.Name))
+
+			_, err = os.Stat(fileName)
+			if os.IsNotExist(err) {
+				err = b.ExtractKartusche(fileName)
+			}
+
+			if err != nil {
+				return fmt.Errorf("while extracting kartusche: %w", err)
+			}
+
+			return run.ServeFile(c, fileName)
+		},
+	}
+	app.RunAndExitOnError()
+}
+
+func defaultDataDir(name string) (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		hd, err := homedir.Dir()
+		if err != nil {
+			return "", fmt.Errorf("could not get user's home dir: %w", err)
+		}
+		dataHome = filepath.Join(hd, ".local", "share")
+	}
+	return filepath.Join(dataHome, name), nil
+}
@@ -0,0 +1,115 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+
+	"github.com/draganm/kartusche/common/build"
+	"github.com/draganm/kartusche/common/bundle"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name: "bundle",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+		},
+		&cli.StringFlag{
+			Name: "name",
+		},
+		&cli.StringFlag{
+			Name:  "kartusche-file",
+			Usage: "bundle an existing kartusche file instead of the code in the directory",
+		},
+		&cli.StringFlag{
+			Name:    "base-executable",
+			EnvVars: []string{"KARTUSCHE_BASE_EXECUTABLE"},
+			Usage:   "Linux kartusche executable the kartusche is appended to, defaults to the current executable",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while bundling Kartusche: %w", err), 1)
+			}
+		}()
+
+		dir := c.Args().First()
+
+		if dir == "" {
+			dir = "."
+		}
+
+		name := c.String("name")
+		if name == "" {
+			cfg, err := config.Current()
+			switch {
+			case errors.Is(err, config.ErrConfigNotFound):
+				absDir, err := filepath.Abs(dir)
+				if err != nil {
+					return fmt.Errorf("while getting absolute path of %s: %w", dir, err)
+				}
+				name = filepath.Base(absDir)
+			case err != nil:
+				return err
+			default:
+				name = cfg.Name
+			}
+		}
+
+		baseExecutable := c.String("base-executable")
+		if baseExecutable == "" {
+			if goruntime.GOOS != "linux" {
+				return errors.New("bundles are Linux executables, please provide a Linux build of kartusche using --base-executable")
+			}
+			baseExecutable, err = os.Executable()
+			if err != nil {
+				return fmt.Errorf("while getting current executable: %w", err)
+			}
+		}
+
+		kartuscheFileName := c.String("kartusche-file")
+
+		if kartuscheFileName == "" {
+			td, err := os.MkdirTemp("", "")
+			if err != nil {
+				return fmt.Errorf("while creating temp dir: %w", err)
+			}
+
+			defer os.RemoveAll(td)
+
+			kartuscheFileName = filepath.Join(td, "kartusche")
+
+			err = build.Run(dir)
+			if err != nil {
+				return err
+			}
+
+			err = runtime.InitializeNew(kartuscheFileName, dir)
+			if err != nil {
+				return fmt.Errorf("while initializing Kartusche: %w", err)
+			}
+		}
+
+		output := c.String("output")
+		if output == "" {
+			output = name
+		}
+
+		err = bundle.Create(output, baseExecutable, kartuscheFileName, name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("created %s\n", output)
+
+		return nil
+	},
+}
@@ -11,9 +11,14 @@ import (
 
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/build"
+	"github.com/draganm/kartusche/common/ignore"
+	"github.com/draganm/kartusche/common/manifest"
 	"github.com/draganm/kartusche/common/paths"
 	"github.com/draganm/kartusche/common/util/path"
+	"github.com/draganm/kartusche/config"
 	"github.com/draganm/kartusche/runtime"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/draganm/kartusche/tests"
 	"github.com/fsnotify/fsnotify"
 	"github.com/go-logr/zapr"
@@ -29,6 +34,8 @@ var Command = &cli.Command{
 			EnvVars: []string{"KARTUSCHE_ADDR"},
 			Value:   "localhost:5001",
 		},
+		tracing.TraceFileFlag,
+		tracing.OTLPEndpointFlag,
 	},
 	Action: func(c *cli.Context) (err error) {
 		defer func() {
@@ -59,7 +66,10 @@ var Command = &cli.Command{
 
 		_, err = os.Stat(".kartusche/development")
 		if os.IsNotExist(err) {
-			err = runtime.InitializeNew(".kartusche/development", dir)
+			err = build.Run(dir)
+			if err == nil {
+				err = runtime.InitializeNew(".kartusche/development", dir)
+			}
 		}
 
 		if err != nil {
@@ -73,13 +83,27 @@ var Command = &cli.Command{
 
 		log.Info("listening for HTTP requests", "url", fmt.Sprintf("http://%s/", l.Addr().String()))
 
-		rt, err := runtime.Open(".kartusche/development", log)
+		tracer, err := tracing.NewFromFlags(c, log)
+		if err != nil {
+			return err
+		}
+
+		defer tracer.Shutdown()
+
+		rt, err := runtime.Open(
+			".kartusche/development",
+			log.WithValues("kartusche", kartuscheName(dir)),
+			runtime.WithDevMode(),
+			runtime.WithTracer(tracer),
+		)
 		if err != nil {
 			return fmt.Errorf("while starting runtime: %w", err)
 		}
 
+		lr := newLiveReload()
+
 		s := &http.Server{
-			Handler: rt,
+			Handler: lr.handler(rt),
 		}
 
 		w, err := fsnotify.NewWatcher()
@@ -92,12 +116,14 @@ var Command = &cli.Command{
 			names <- "."
 			done := make(chan error)
 			go watch(dir, w, names, done)
-			for range names {
+			for name := range names {
+				changed := []string{name}
 				// debounce
 			inner:
 				for {
 					select {
-					case <-names:
+					case name = <-names:
+						changed = append(changed, name)
 					case <-time.NewTimer(100 * time.Millisecond).C:
 						break inner
 					}
@@ -105,10 +131,13 @@ var Command = &cli.Command{
 
 				err := updateRuntimeCode(rt, dir)
 				if err != nil {
-					fmt.Println(fmt.Errorf("failed to update runtime: %w", err))
+					err = fmt.Errorf("failed to update runtime: %w", err)
+					fmt.Println(err)
+					lr.failed(err)
 					continue
 				}
 				fmt.Println("updated runtime")
+				lr.updated(changed, staticSourceDir(dir))
 				err = tests.Run(dir)
 				if err != nil {
 					fmt.Println(err)
@@ -123,6 +152,21 @@ var Command = &cli.Command{
 
 func updateRuntimeCode(rt runtime.Runtime, dir string) error {
 
+	err := build.Run(dir)
+	if err != nil {
+		return err
+	}
+
+	ignored, err := ignore.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	m, err := manifest.Load(dir)
+	if err != nil {
+		return err
+	}
+
 	return rt.Update(func(tx bolted.SugaredWriteTx) error {
 		for _, p := range paths.WellKnown {
 			pth := dbpath.ToPath(p)
@@ -130,8 +174,7 @@ func updateRuntimeCode(rt runtime.Runtime, dir string) error {
 				tx.Delete(pth)
 			}
 
-			localFile := filepath.Join(dir, p)
-			err := loadFromPath(localFile, tx, pth)
+			err := loadFromPath(dir, m.SourceDir(p), tx, pth, ignored)
 			if err != nil {
 				return err
 			}
@@ -140,12 +183,40 @@ func updateRuntimeCode(rt runtime.Runtime, dir string) error {
 	})
 }
 
-func loadFromPath(dir string, wtx bolted.SugaredWriteTx, prefix dbpath.Path) error {
+// kartuscheName returns the name of the kartusche from the config,
+// falling back to the name of the dir.
+func kartuscheName(dir string) string {
+	cfg, err := config.Current()
+	if err == nil && cfg.Name != "" {
+		return cfg.Name
+	}
+
 	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+
+	return filepath.Base(absDir)
+}
+
+// staticSourceDir returns the dir static files are loaded from, relative to the kartusche dir.
+func staticSourceDir(dir string) string {
+	m, err := manifest.Load(dir)
+	if err != nil {
+		return "static"
+	}
+	return m.SourceDir("static")
+}
+
+// loadFromPath loads the source dir, relative to the kartusche root dir, into prefix.
+func loadFromPath(root, source string, wtx bolted.SugaredWriteTx, prefix dbpath.Path, ignored *ignore.Matcher) error {
+	absRoot, err := filepath.Abs(root)
 	if err != nil {
 		return fmt.Errorf("while getting abs path: %w", err)
 	}
 
+	absDir := filepath.Join(absRoot, source)
+
 	_, err = os.Stat(absDir)
 	if os.IsNotExist(err) {
 		return nil
@@ -172,6 +243,18 @@ func loadFromPath(dir string, wtx bolted.SugaredWriteTx, prefix dbpath.Path) err
 			return nil
 		}
 
+		rel, err := filepath.Rel(absRoot, file)
+		if err != nil {
+			return fmt.Errorf("while getting relative path of %s: %w", file, err)
+		}
+
+		if ignored.Match(filepath.ToSlash(rel), fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		if fi.IsDir() {
 			wtx.CreateMap(dbp)
 			return nil
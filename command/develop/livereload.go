@@ -0,0 +1,249 @@
+package develop
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed livereload.js
+var liveReloadScript string
+
+const (
+	liveReloadPath       = "/_kartusche/livereload"
+	liveReloadScriptPath = "/_kartusche/livereload.js"
+)
+
+var liveReloadScriptTag = []byte(fmt.Sprintf("<script src=%q></script>", liveReloadScriptPath))
+
+type liveReloadEvent struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+}
+
+// liveReload notifies browsers connected using server-sent events about code updates.
+type liveReload struct {
+	mu        sync.Mutex
+	clients   map[chan liveReloadEvent]struct{}
+	lastError string
+}
+
+func newLiveReload() *liveReload {
+	return &liveReload{
+		clients: map[chan liveReloadEvent]struct{}{},
+	}
+}
+
+func (lr *liveReload) publish(ev liveReloadEvent) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	if ev.Type == "error" {
+		lr.lastError = ev.Message
+	} else {
+		lr.lastError = ""
+	}
+
+	for c := range lr.clients {
+		select {
+		case c <- ev:
+		default:
+			// client is not keeping up, it will get the next event
+		}
+	}
+}
+
+// updated is called after the code has been successfully updated.
+// Browsers swap the stylesheets if only CSS files in the static dir have changed, otherwise they reload.
+func (lr *liveReload) updated(changed []string, staticDir string) {
+	lr.mu.Lock()
+	hadError := lr.lastError != ""
+	lr.mu.Unlock()
+
+	if !hadError && onlyStaticCSS(changed, staticDir) {
+		lr.publish(liveReloadEvent{Type: "css"})
+		return
+	}
+
+	lr.publish(liveReloadEvent{Type: "reload"})
+}
+
+// failed is called when the code could not be updated.
+// Browsers show the error as an overlay until the next successful update.
+func (lr *liveReload) failed(err error) {
+	lr.publish(liveReloadEvent{Type: "error", Message: err.Error()})
+}
+
+func onlyStaticCSS(changed []string, staticDir string) bool {
+	prefix := filepath.ToSlash(filepath.Clean(staticDir)) + "/"
+	for _, name := range changed {
+		name = filepath.ToSlash(filepath.Clean(name))
+		if !strings.HasPrefix(name, prefix) || filepath.Ext(name) != ".css" {
+			return false
+		}
+	}
+	return len(changed) > 0
+}
+
+func (lr *liveReload) subscribe() (chan liveReloadEvent, func()) {
+	c := make(chan liveReloadEvent, 4)
+
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.clients[c] = struct{}{}
+	if lr.lastError != "" {
+		c <- liveReloadEvent{Type: "error", Message: lr.lastError}
+	}
+
+	return c, func() {
+		lr.mu.Lock()
+		defer lr.mu.Unlock()
+		delete(lr.clients, c)
+	}
+}
+
+func (lr *liveReload) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events, unsubscribe := lr.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			d, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, d)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handler serves the live reload endpoints and injects the live reload script
+// into HTML responses of the runtime.
+func (lr *liveReload) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case liveReloadPath:
+			lr.serveEvents(w, r)
+			return
+		case liveReloadScriptPath:
+			w.Header().Set("Content-Type", "application/javascript")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write([]byte(liveReloadScript))
+			return
+		}
+
+		if r.Method != http.MethodGet || r.Header.Get("Upgrade") != "" || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the script can't be injected into compressed or partial content
+		r.Header.Del("Accept-Encoding")
+		r.Header.Del("Range")
+
+		iw := &injectingWriter{ResponseWriter: w}
+		next.ServeHTTP(iw, r)
+		iw.finish()
+	})
+}
+
+// injectingWriter buffers successful HTML responses in order to inject the live reload script.
+// Other responses are passed through.
+type injectingWriter struct {
+	http.ResponseWriter
+	status  int
+	decided bool
+	html    bool
+	buf     bytes.Buffer
+}
+
+func (iw *injectingWriter) WriteHeader(status int) {
+	if iw.decided {
+		return
+	}
+	iw.decided = true
+	iw.status = status
+
+	h := iw.Header()
+	iw.html = status == http.StatusOK && strings.HasPrefix(h.Get("Content-Type"), "text/html") && h.Get("Content-Encoding") == ""
+	if !iw.html {
+		iw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (iw *injectingWriter) Write(p []byte) (int, error) {
+	if !iw.decided {
+		if iw.Header().Get("Content-Type") == "" {
+			iw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		iw.WriteHeader(http.StatusOK)
+	}
+
+	if iw.html {
+		return iw.buf.Write(p)
+	}
+
+	return iw.ResponseWriter.Write(p)
+}
+
+func (iw *injectingWriter) Flush() {
+	if iw.html {
+		return
+	}
+	flusher, ok := iw.ResponseWriter.(http.Flusher)
+	if ok {
+		flusher.Flush()
+	}
+}
+
+func (iw *injectingWriter) finish() {
+	if !iw.html {
+		return
+	}
+
+	body := injectScript(iw.buf.Bytes())
+
+	iw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	iw.ResponseWriter.WriteHeader(iw.status)
+	iw.ResponseWriter.Write(body)
+}
+
+// injectScript inserts the live reload script tag before the closing body tag,
+// or appends it if there is none.
+func injectScript(html []byte) []byte {
+	idx := bytes.LastIndex(bytes.ToLower(html), []byte("</body>"))
+	if idx < 0 {
+		return append(html, liveReloadScriptTag...)
+	}
+
+	res := make([]byte, 0, len(html)+len(liveReloadScriptTag))
+	res = append(res, html[:idx]...)
+	res = append(res, liveReloadScriptTag...)
+	res = append(res, html[idx:]...)
+	return res
+}
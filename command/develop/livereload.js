@@ -0,0 +1,59 @@
+(function () {
+  var overlayId = "kartusche-livereload-overlay";
+
+  function removeOverlay() {
+    var overlay = document.getElementById(overlayId);
+    if (overlay) {
+      overlay.remove();
+    }
+  }
+
+  function showOverlay(message) {
+    removeOverlay();
+    var overlay = document.createElement("div");
+    overlay.id = overlayId;
+    overlay.style.cssText =
+      "position:fixed;top:0;left:0;right:0;bottom:0;z-index:2147483647;" +
+      "background:rgba(0,0,0,0.85);color:#ff6b6b;padding:2em;overflow:auto;" +
+      "font:14px/1.5 monospace;white-space:pre-wrap";
+    var title = document.createElement("div");
+    title.style.cssText = "color:#fff;font-weight:bold;margin-bottom:1em";
+    title.textContent = "Failed to update the code";
+    var body = document.createElement("div");
+    body.textContent = message;
+    overlay.appendChild(title);
+    overlay.appendChild(body);
+    document.body.appendChild(overlay);
+  }
+
+  function reloadCSS() {
+    var links = document.querySelectorAll('link[rel="stylesheet"]');
+    for (var i = 0; i < links.length; i++) {
+      var url = new URL(links[i].href);
+      if (url.origin !== location.origin) {
+        continue;
+      }
+      url.searchParams.set("livereload", Date.now().toString());
+      links[i].href = url.toString();
+    }
+  }
+
+  var source = new EventSource("/_kartusche/livereload");
+
+  source.addEventListener("reload", function () {
+    location.reload();
+  });
+
+  source.addEventListener("css", function () {
+    removeOverlay();
+    reloadCSS();
+  });
+
+  source.addEventListener("error", function (e) {
+    // error events without data are connection errors, EventSource reconnects by itself
+    if (!e.data) {
+      return;
+    }
+    showOverlay(JSON.parse(e.data).message);
+  });
+})();
@@ -0,0 +1,16 @@
+package failures
+
+import (
+	"github.com/draganm/kartusche/command/failures/ls"
+	"github.com/draganm/kartusche/command/failures/replay"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "failures",
+	Usage: "inspect and replay requests failed by handlers",
+	Subcommands: []*cli.Command{
+		ls.Command,
+		replay.Command,
+	},
+}
@@ -0,0 +1,58 @@
+package ls
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "ls",
+	Usage: "list recorded failures, the most recent one first",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while listing failures: %w", err), 1)
+			}
+		}()
+
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		failures := []runtime.Failure{}
+		err = client.CallAPI(serverBaseURL, "GET", path.Join("kartusches", cfg.Name, "failures"), nil, nil, client.JSONDecoder(&failures), 200)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTIME\tREQUEST\tHANDLER\tCODE\tERROR")
+		for _, f := range failures {
+			fmt.Fprintf(tw, "%s\t%s\t%s %s\t%s\t%s\t%s\n", f.ID, f.Time.Format(time.RFC3339), f.Method, f.URL, f.Handler, f.CodeHash, f.Message)
+		}
+
+		return tw.Flush()
+
+	},
+}
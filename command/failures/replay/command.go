@@ -0,0 +1,140 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/urfave/cli/v2"
+)
+
+// skippedHeaders are not replayed, they are set by the client or don't apply to the target.
+var skippedHeaders = []string{
+	"Host",
+	"Content-Length",
+	"Connection",
+	"Keep-Alive",
+	"Transfer-Encoding",
+	"Upgrade",
+	"X-Request-Id",
+}
+
+var Command = &cli.Command{
+	Name:      "replay",
+	Usage:     "send the request of a recorded failure to a kartusche, e.g. a local develop instance",
+	ArgsUsage: "<failure id>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "base URL of the kartusche the request is sent to",
+			Value: "http://localhost:5001",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while replaying failure: %w", err), 1)
+			}
+		}()
+
+		id := c.Args().First()
+		if id == "" {
+			return errors.New("id of the failure must be provided")
+		}
+
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		f := &runtime.Failure{}
+		err = client.CallAPI(serverBaseURL, "GET", path.Join("kartusches", cfg.Name, "failures", id), nil, nil, client.JSONDecoder(f), 200)
+		if err != nil {
+			return err
+		}
+
+		req, err := replayRequest(f, c.String("target"))
+		if err != nil {
+			return err
+		}
+
+		if f.BodyTruncated {
+			fmt.Fprintln(os.Stderr, "warning: the request body was truncated when recording the failure")
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("while sending request: %w", err)
+		}
+
+		defer res.Body.Close()
+
+		fmt.Println(res.Status)
+		_, err = io.Copy(os.Stdout, res.Body)
+		return err
+
+	},
+}
+
+func replayRequest(f *runtime.Failure, target string) (*http.Request, error) {
+	tu, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing target: %w", err)
+	}
+
+	fu, err := url.Parse(f.URL)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing URL of the failed request: %w", err)
+	}
+
+	tu.Path = strings.TrimSuffix(tu.Path, "/") + fu.Path
+	tu.RawQuery = fu.RawQuery
+
+	req, err := http.NewRequest(f.Method, tu.String(), bytes.NewReader(f.Body))
+	if err != nil {
+		return nil, fmt.Errorf("while creating request: %w", err)
+	}
+
+	for name, values := range f.Header {
+		if skipped(name) {
+			continue
+		}
+		for _, v := range values {
+			// credentials are redacted when recording the failure
+			if v == runtime.Redacted {
+				continue
+			}
+			req.Header.Add(name, v)
+		}
+	}
+
+	return req, nil
+}
+
+func skipped(name string) bool {
+	for _, s := range skippedHeaders {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package info
 import (
 	"github.com/draganm/kartusche/command/info/dbstats"
 	"github.com/draganm/kartusche/command/info/handlers"
+	"github.com/draganm/kartusche/command/info/routes"
 	"github.com/urfave/cli/v2"
 )
 
@@ -11,5 +12,6 @@ var Command = &cli.Command{
 	Subcommands: []*cli.Command{
 		handlers.Command,
 		dbstats.Command,
+		routes.Command,
 	},
 }
@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:  "routes",
+	Usage: "show request counters of handlers and static files",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "reset",
+			Usage: "reset the request counters",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while getting route stats: %w", err), 1)
+			}
+		}()
+
+		serverBaseURL, err := serverurl.BaseServerURL("")
+		if err != nil {
+			return err
+		}
+
+		if serverBaseURL == "" {
+			return errors.New("could not determine Kartusche server")
+		}
+
+		name := c.Args().First()
+
+		if name == "" {
+			return errors.New("name of kartusche must be provided")
+		}
+
+		routesPath := path.Join("kartusches", name, "info", "routes")
+
+		if c.Bool("reset") {
+			return client.CallAPI(serverBaseURL, "DELETE", routesPath, nil, nil, nil, 204)
+		}
+
+		routes := []runtime.RouteStats{}
+		err = client.CallAPI(serverBaseURL, "GET", routesPath, nil, nil, client.JSONDecoder(&routes), 200)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tMETHOD\tROUTE\tHITS\tERRORS\tP50\tP95\tLAST HIT")
+		for _, r := range routes {
+			lastHit := "-"
+			if r.LastHit != nil {
+				lastHit = r.LastHit.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", r.Kind, r.Method, r.Route, r.Hits, r.Errors, r.P50, r.P95, lastHit)
+		}
+
+		return tw.Flush()
+
+	},
+}
@@ -0,0 +1,125 @@
+package logs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/runtime/logring"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name: "logs",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+		&cli.BoolFlag{
+			Name:    "follow",
+			Aliases: []string{"f"},
+			Usage:   "stream new log entries",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only show entries newer than a RFC3339 timestamp or a relative duration (e.g. 10m)",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print entries as newline delimited JSON",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while getting logs: %w", err), 1)
+			}
+		}()
+
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		q := url.Values{}
+		if c.Bool("follow") {
+			q.Set("follow", "true")
+		}
+
+		if c.String("since") != "" {
+			q.Set("since", c.String("since"))
+		}
+
+		return client.CallAPI(serverBaseURL, "GET", path.Join("kartusches", cfg.Name, "logs"), q, nil, func(r io.Reader) error {
+			return printEntries(r, os.Stdout, c.Bool("json"))
+		}, 200)
+
+	},
+}
+
+func printEntries(r io.Reader, w io.Writer, raw bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		if raw {
+			fmt.Fprintln(w, scanner.Text())
+			continue
+		}
+
+		e := logring.Entry{}
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return fmt.Errorf("while parsing log entry: %w", err)
+		}
+
+		fmt.Fprintln(w, formatEntry(e))
+	}
+
+	return scanner.Err()
+}
+
+func formatEntry(e logring.Entry) string {
+	parts := []string{
+		e.Time.Format(time.RFC3339),
+		strings.ToUpper(e.Level),
+	}
+
+	if e.Name != "" {
+		parts = append(parts, e.Name)
+	}
+
+	parts = append(parts, e.Message)
+
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, e.Fields[k]))
+	}
+
+	if e.Error != "" {
+		parts = append(parts, fmt.Sprintf("error=%q", e.Error))
+	}
+
+	return strings.Join(parts, " ")
+}
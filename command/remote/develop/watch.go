@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/draganm/kartusche/common/ignore"
+	"github.com/draganm/kartusche/common/manifest"
 	"github.com/fsnotify/fsnotify"
 )
 
@@ -15,8 +17,14 @@ const chmodMask fsnotify.Op = ^fsnotify.Op(0) ^ fsnotify.Chmod
 // It sends an error on the done chan.
 // As an optimization, any dirs we encounter that meet the ExcludePrefix
 // criteria of all reflexes can be ignored.
+// Changes of files matching .kartuscheignore are not reported.
 func watch(root string, watcher *fsnotify.Watcher, names chan<- string, done chan<- error) {
-	if err := filepath.Walk(root, walker(watcher)); err != nil {
+	ignored, err := ignore.LoadForWatching(root)
+	if err != nil {
+		fmt.Println("while loading ignore file", err)
+	}
+
+	if err := filepath.Walk(root, walker(root, watcher, ignored)); err != nil {
 		fmt.Println("while walking dir", err)
 	}
 
@@ -32,9 +40,18 @@ func watch(root string, watcher *fsnotify.Watcher, names chan<- string, done cha
 			if e.Op&chmodMask == 0 {
 				continue
 			}
+			name := relativeName(root, e.Name)
+			if name == ignore.FileName || name == manifest.FileName {
+				ignored, err = ignore.LoadForWatching(root)
+				if err != nil {
+					fmt.Println("while loading ignore file", err)
+				}
+			} else if ignored.Match(name, stat.IsDir()) {
+				continue
+			}
 			names <- path
 			if e.Op&fsnotify.Create > 0 && stat.IsDir() {
-				if err := filepath.Walk(path, walker(watcher)); err != nil {
+				if err := filepath.Walk(path, walker(root, watcher, ignored)); err != nil {
 					fmt.Printf("Error while walking path %s: %s\n", path, err)
 				}
 			}
@@ -50,18 +67,17 @@ func watch(root string, watcher *fsnotify.Watcher, names chan<- string, done cha
 	}
 }
 
-func walker(watcher *fsnotify.Watcher) filepath.WalkFunc {
+func walker(root string, watcher *fsnotify.Watcher, ignored *ignore.Matcher) filepath.WalkFunc {
 	return func(path string, f os.FileInfo, err error) error {
 		if err != nil || !f.IsDir() {
 			return nil
 		}
+		skip := ignored.Match(relativeName(root, path), true)
 		path = normalize(path, f.IsDir())
-		ignore := false
 		if path == ".kartusche/" {
-			ignore = true
+			skip = true
 		}
-		// TODO: set ignore to `true` if we don't care about the file
-		if ignore {
+		if skip {
 			return filepath.SkipDir
 		}
 		if err := watcher.Add(path); err != nil {
@@ -71,6 +87,15 @@ func walker(watcher *fsnotify.Watcher) filepath.WalkFunc {
 	}
 }
 
+// relativeName returns the slash separated name of the file relative to root.
+func relativeName(root, file string) string {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
 func normalize(path string, dir bool) string {
 	path = strings.TrimPrefix(path, "./")
 	if dir && !strings.HasSuffix(path, "/") {
@@ -0,0 +1,69 @@
+package rollback
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/server"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name: "rollback",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while rolling back code: %w", err), 1)
+			}
+		}()
+
+		if c.NArg() != 1 {
+			return errors.New("version must be provided")
+		}
+
+		version, err := strconv.ParseUint(c.Args().First(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("while parsing version: %w", err)
+		}
+
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		cv := server.CodeVersion{}
+		err = client.CallAPI(
+			serverBaseURL,
+			"POST",
+			path.Join("kartusches", cfg.Name, "versions", strconv.FormatUint(version, 10), "rollback"),
+			nil,
+			nil,
+			client.JSONDecoder(&cv),
+			200,
+		)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("rolled back to version %d, current version is %d\n", version, cv.Version)
+
+		return nil
+
+	},
+}
@@ -0,0 +1,107 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/draganm/kartusche/runtime/standalone"
+	"github.com/draganm/kartusche/runtime/tracing"
+	"github.com/go-logr/zapr"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Flags are shared with the bundled executables.
+var Flags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "addr",
+		EnvVars: []string{"KARTUSCHE_ADDR"},
+		Value:   ":3002",
+	},
+	&cli.StringFlag{
+		Name:    "tls-cert-file",
+		EnvVars: []string{"KARTUSCHE_TLS_CERT_FILE"},
+	},
+	&cli.StringFlag{
+		Name:    "tls-key-file",
+		EnvVars: []string{"KARTUSCHE_TLS_KEY_FILE"},
+	},
+	&cli.DurationFlag{
+		Name:    "shutdown-timeout",
+		EnvVars: []string{"KARTUSCHE_SHUTDOWN_TIMEOUT"},
+		Value:   standalone.DefaultShutdownTimeout,
+	},
+	tracing.TraceFileFlag,
+	tracing.OTLPEndpointFlag,
+}
+
+var Command = &cli.Command{
+	Name:  "run",
+	Flags: Flags,
+	Action: func(c *cli.Context) (err error) {
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while running kartusche: %w", err), 1)
+			}
+		}()
+
+		if c.NArg() != 1 {
+			return errors.New("kartusche file must be provided")
+		}
+
+		fileName := c.Args().First()
+
+		_, err = os.Stat(fileName)
+		if err != nil {
+			return err
+		}
+
+		return ServeFile(c, fileName)
+
+	},
+}
+
+// ServeFile serves the kartusche file using the options from Flags
+// until SIGINT or SIGTERM is received.
+func ServeFile(c *cli.Context, fileName string) error {
+	lc := zap.NewProductionConfig()
+
+	lc.Sampling = nil
+	lc.EncoderConfig.EncodeTime = zapcore.RFC3339TimeEncoder
+	lc.DisableStacktrace = true
+
+	logger, err := lc.Build()
+	if err != nil {
+		return fmt.Errorf("while starting logger: %w", err)
+	}
+
+	defer logger.Sync()
+	log := zapr.NewLogger(logger)
+
+	tracer, err := tracing.NewFromFlags(c, log)
+	if err != nil {
+		return err
+	}
+
+	defer tracer.Shutdown()
+
+	ctx, cancel := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	return standalone.Serve(
+		ctx,
+		fileName,
+		standalone.Options{
+			Addr:            c.String("addr"),
+			TLSCertFile:     c.String("tls-cert-file"),
+			TLSKeyFile:      c.String("tls-key-file"),
+			ShutdownTimeout: c.Duration("shutdown-timeout"),
+			Tracer:          tracer,
+		},
+		log,
+	)
+}
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/draganm/kartusche/server"
 	"github.com/draganm/kartusche/server/verifier"
 	"github.com/go-logr/zapr"
@@ -34,9 +38,14 @@ var Command = &cli.Command{
 		},
 		&cli.StringFlag{
 			Name:    "auth-provider",
-			Value:   "mock",
+			Usage:   "authentication provider of the API: github, oidc or mock",
 			EnvVars: []string{"AUTH_PROVIDER"},
 		},
+		&cli.BoolFlag{
+			Name:    "insecure-mock-auth",
+			Usage:   "allow the mock auth provider, which lets anyone log in as any user",
+			EnvVars: []string{"INSECURE_MOCK_AUTH"},
+		},
 		&cli.StringFlag{
 			Name:    "oauth2-github-client-id",
 			EnvVars: []string{"OAUTH2_GITHUB_CLIENT_ID"},
@@ -49,11 +58,81 @@ var Command = &cli.Command{
 			Name:    "oauth2-github-organization",
 			EnvVars: []string{"OAUTH2_GITHUB_ORGANIZATION"},
 		},
+		&cli.StringFlag{
+			Name:    "oidc-issuer-url",
+			Usage:   "issuer of the OpenID Connect identity provider",
+			EnvVars: []string{"OIDC_ISSUER_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "oidc-client-id",
+			EnvVars: []string{"OIDC_CLIENT_ID"},
+		},
+		&cli.StringFlag{
+			Name:    "oidc-client-secret",
+			EnvVars: []string{"OIDC_CLIENT_SECRET"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "oidc-scopes",
+			Usage:   "scopes requested in addition to openid",
+			EnvVars: []string{"OIDC_SCOPES"},
+			Value:   cli.NewStringSlice("email", "profile"),
+		},
+		&cli.StringFlag{
+			Name:    "oidc-user-id-claim",
+			Usage:   "claim of the ID token used as the user id",
+			EnvVars: []string{"OIDC_USER_ID_CLAIM"},
+			Value:   "email",
+		},
+		&cli.StringFlag{
+			Name:    "oidc-groups-claim",
+			Usage:   "claim of the ID token listing the groups of the user",
+			EnvVars: []string{"OIDC_GROUPS_CLAIM"},
+			Value:   "groups",
+		},
+		&cli.StringSliceFlag{
+			Name:    "oidc-allowed-groups",
+			Usage:   "only members of one of the groups are allowed to use the API",
+			EnvVars: []string{"OIDC_ALLOWED_GROUPS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "oidc-required-claims",
+			Usage:   "<claim>=<value> the ID token must contain to be allowed to use the API",
+			EnvVars: []string{"OIDC_REQUIRED_CLAIMS"},
+		},
 		&cli.StringFlag{
 			Name:    "kartusche-domain",
 			EnvVars: []string{"KARTUSCHE_DOMAIN"},
 			Value:   "127.0.0.1.nip.io",
 		},
+		&cli.DurationFlag{
+			Name:    "token-ttl",
+			Usage:   "time after which tokens issued on login expire",
+			EnvVars: []string{"TOKEN_TTL"},
+			Value:   30 * 24 * time.Hour,
+		},
+		&cli.DurationFlag{
+			Name:    "login-request-ttl",
+			Usage:   "time the user has to complete authentication after starting a login",
+			EnvVars: []string{"LOGIN_REQUEST_TTL"},
+			Value:   10 * time.Minute,
+		},
+		&cli.StringFlag{
+			Name:    "metrics-token",
+			Usage:   "bearer token required to get the metrics, metrics are not served if not set",
+			EnvVars: []string{"METRICS_TOKEN"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "trusted-proxies",
+			Usage:   "IPs or CIDRs of the proxies in front of the server, X-Forwarded-For is used for the client IP only for requests from them",
+			EnvVars: []string{"TRUSTED_PROXIES"},
+		},
+		&cli.StringFlag{
+			Name:    "legacy-owner",
+			Usage:   "user id becoming the owner of kartusches uploaded before ownership was recorded",
+			EnvVars: []string{"LEGACY_OWNER"},
+		},
+		tracing.TraceFileFlag,
+		tracing.OTLPEndpointFlag,
 	},
 	Action: func(c *cli.Context) (err error) {
 		defer func() {
@@ -77,9 +156,17 @@ var Command = &cli.Command{
 		defer logger.Sync()
 		log := zapr.NewLogger(logger)
 
-		vf := verifier.NewMockProvider()
+		var vf verifier.AuthenticationProvider
 
-		if c.String("auth-provider") == "github" {
+		switch c.String("auth-provider") {
+		case "":
+			return errors.New("AUTH_PROVIDER must be set to github, oidc or mock")
+		case "mock":
+			if !c.Bool("insecure-mock-auth") {
+				return errors.New("the mock auth provider lets anyone log in as any user, it can only be used with --insecure-mock-auth")
+			}
+			vf = verifier.NewMockProvider()
+		case "github":
 			switch {
 			case !c.IsSet("oauth2-github-client-id"):
 				return fmt.Errorf("OAUTH2_GITHUB_CLIENT_ID must be set")
@@ -93,18 +180,71 @@ var Command = &cli.Command{
 				c.String("oauth2-github-client-secret"),
 				c.String("oauth2-github-organization"),
 			)
+		case "oidc":
+			switch {
+			case !c.IsSet("oidc-issuer-url"):
+				return fmt.Errorf("OIDC_ISSUER_URL must be set")
+			case !c.IsSet("oidc-client-id"):
+				return fmt.Errorf("OIDC_CLIENT_ID must be set")
+			}
+
+			requiredClaims := map[string]string{}
+			for _, rc := range c.StringSlice("oidc-required-claims") {
+				claim, value, found := strings.Cut(rc, "=")
+				if !found {
+					return fmt.Errorf("required claim %q must have the format <claim>=<value>", rc)
+				}
+				requiredClaims[claim] = value
+			}
+
+			vf, err = verifier.NewOIDCProvider(verifier.OIDCConfig{
+				IssuerURL:      c.String("oidc-issuer-url"),
+				ClientID:       c.String("oidc-client-id"),
+				ClientSecret:   c.String("oidc-client-secret"),
+				Scopes:         c.StringSlice("oidc-scopes"),
+				UserIDClaim:    c.String("oidc-user-id-claim"),
+				GroupsClaim:    c.String("oidc-groups-claim"),
+				AllowedGroups:  c.StringSlice("oidc-allowed-groups"),
+				RequiredClaims: requiredClaims,
+				LoginTTL:       c.Duration("login-request-ttl"),
+			})
+			if err != nil {
+				return fmt.Errorf("while creating OIDC provider: %w", err)
+			}
+		default:
+			return fmt.Errorf("unknown auth provider %q", c.String("auth-provider"))
+		}
+
+		tracer, err := tracing.NewFromFlags(c, log)
+		if err != nil {
+			return err
+		}
+
+		defer tracer.Shutdown()
+
+		trustedProxies, err := server.ParseTrustedProxies(c.StringSlice("trusted-proxies"))
+		if err != nil {
+			return err
 		}
 
 		ks, err := server.Open(
 			c.String("work-dir"),
 			c.String("kartusche-domain"),
 			vf,
+			c.Duration("token-ttl"),
+			c.Duration("login-request-ttl"),
+			c.String("metrics-token"),
+			trustedProxies,
+			c.String("legacy-owner"),
+			tracer,
 			log,
 		)
 		if err != nil {
 			return fmt.Errorf("while starting kartusche server: %w", err)
 		}
 
+		defer ks.Close()
+
 		s := &http.Server{
 			Handler: ks.ServerRouter,
 		}
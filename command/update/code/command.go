@@ -1,24 +1,33 @@
 package code
 
 import (
-	"archive/tar"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
-	"path/filepath"
-	"strings"
 
+	"github.com/draganm/kartusche/common/build"
 	"github.com/draganm/kartusche/common/client"
-	"github.com/draganm/kartusche/common/paths"
+	"github.com/draganm/kartusche/common/packer"
 	"github.com/draganm/kartusche/common/serverurl"
 	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/server"
 	"github.com/urfave/cli/v2"
 )
 
 var Command = &cli.Command{
-	Name:  "code",
-	Flags: []cli.Flag{},
+	Name: "code",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "show the changes and compile errors without updating the code",
+		},
+		&cli.BoolFlag{
+			Name:  "full",
+			Usage: "upload the complete code instead of only the changed files",
+		},
+	},
 	Action: func(c *cli.Context) (err error) {
 		defer func() {
 			if err != nil {
@@ -37,7 +46,29 @@ var Command = &cli.Command{
 			return err
 		}
 
-		err = UpdateServerCode(dir, serverBaseURL)
+		if c.Bool("dry-run") {
+			res, err := DryRunUpdateServerCode(dir, serverBaseURL)
+			if err != nil {
+				return err
+			}
+
+			printDryRunResult(res)
+
+			if len(res.CompileErrors) > 0 {
+				return errors.New("code has compile errors")
+			}
+
+			return nil
+		}
+
+		if c.Bool("full") {
+			err = UploadServerCode(dir, serverBaseURL)
+		} else {
+			err = UpdateServerCode(dir, serverBaseURL)
+		}
+		if err != nil {
+			return err
+		}
 
 		fmt.Println("code updated")
 		return nil
@@ -45,104 +76,187 @@ var Command = &cli.Command{
 	},
 }
 
+func createCodeTar(dir string) (*os.File, error) {
+	tf, err := os.CreateTemp("", "")
+	if err != nil {
+		return nil, fmt.Errorf("while creating temp file: %w", err)
+	}
+
+	err = packer.WriteTar(dir, tf)
+	if err != nil {
+		tf.Close()
+		os.Remove(tf.Name())
+		return nil, err
+	}
+
+	_, err = tf.Seek(0, 0)
+	if err != nil {
+		tf.Close()
+		os.Remove(tf.Name())
+		return nil, fmt.Errorf("while seeking tar file to beginning: %w", err)
+	}
+
+	return tf, nil
+}
+
+// UpdateServerCode syncs the code in dir to the server by
+// sending only the files that have been added, changed or deleted.
 func UpdateServerCode(dir, serverBaseURL string) error {
+	return syncServerCode(dir, serverBaseURL, false)
+}
+
+// DevelopServerCode is like UpdateServerCode, but the update is not recorded as a code version.
+func DevelopServerCode(dir, serverBaseURL string) error {
+	return syncServerCode(dir, serverBaseURL, true)
+}
+
+func syncServerCode(dir, serverBaseURL string, develop bool) error {
 
 	cfg, err := config.Current()
 	if err != nil {
 		return fmt.Errorf("while getting current config: %w", err)
 	}
 
-	tf, err := os.CreateTemp("", "")
+	err = build.Run(dir)
 	if err != nil {
-		return fmt.Errorf("while creating temp file: %w", err)
+		return err
 	}
 
-	defer tf.Close()
-	defer os.Remove(tf.Name())
+	files, err := packer.Files(dir)
+	if err != nil {
+		return err
+	}
 
-	tw := tar.NewWriter(tf)
+	hashes, err := packer.Hashes(dir)
+	if err != nil {
+		return fmt.Errorf("while hashing code: %w", err)
+	}
 
-	for _, p := range paths.WellKnown {
+	mr := &server.CodeManifestResponse{}
+	err = client.CallAPI(serverBaseURL, "POST", path.Join("kartusches", cfg.Name, "code", "manifest"), nil, client.JSONEncoder(server.CodeManifest{Files: hashes}), client.JSONDecoder(mr), 200)
+	if err != nil {
+		return fmt.Errorf("while exchanging code manifest: %w", err)
+	}
 
-		if !filepath.IsAbs(p) {
-			p = filepath.Join(dir, p)
-		}
+	if len(mr.Missing) == 0 && len(mr.Deleted) == 0 {
+		return nil
+	}
 
-		_, err = os.Stat(p)
-		if os.IsNotExist(err) {
-			continue
-		}
+	patch := server.CodePatch{
+		Files:   map[string][]byte{},
+		Deleted: mr.Deleted,
+		Base:    mr.Base,
+		Develop: develop,
+	}
 
+	for _, name := range mr.Missing {
+		d, err := os.ReadFile(files[name])
 		if err != nil {
-			return err
+			return fmt.Errorf("while reading %s: %w", name, err)
 		}
+		patch.Files[name] = d
+	}
 
-		absDir, err := filepath.Abs(p)
+	err = client.CallAPI(serverBaseURL, "PATCH", path.Join("kartusches", cfg.Name, "code", "patch"), nil, client.JSONEncoder(patch), nil, 204)
+	if err != nil {
+		return fmt.Errorf("while patching code: %w", err)
+	}
 
-		if err != nil {
-			return fmt.Errorf("while getting absolute dir of %s: %w", dir, err)
-		}
+	return nil
 
-		absDirParts := strings.Split(absDir, string(os.PathSeparator))
+}
 
-		err = filepath.Walk(absDir, func(file string, fi os.FileInfo, err error) error {
+// UploadServerCode replaces the code on the server with the complete code in dir.
+func UploadServerCode(dir, serverBaseURL string) error {
 
-			if err != nil {
-				return fmt.Errorf("while walking dir: %w", err)
-			}
+	cfg, err := config.Current()
+	if err != nil {
+		return fmt.Errorf("while getting current config: %w", err)
+	}
 
-			// generate tar header
-			header, err := tar.FileInfoHeader(fi, file)
-			if err != nil {
-				return err
-			}
+	err = build.Run(dir)
+	if err != nil {
+		return err
+	}
 
-			// must provide real name
-			// (see https://golang.org/src/archive/tar/common.go?#L626)
-			absPath, err := filepath.Abs(file)
-			if err != nil {
-				return fmt.Errorf("while getting absolute path of %s: %w", file, err)
-			}
+	tf, err := createCodeTar(dir)
+	if err != nil {
+		return err
+	}
 
-			pathParts := strings.Split(absPath, string(os.PathSeparator))
-			pathParts = append([]string{p}, pathParts[len(absDirParts):]...)
+	defer tf.Close()
+	defer os.Remove(tf.Name())
 
-			header.Name = filepath.ToSlash(strings.Join(pathParts, string(os.PathSeparator)))
+	err = client.CallAPI(serverBaseURL, "PATCH", path.Join("kartusches", cfg.Name, "code"), nil, func() (io.Reader, error) { return tf, nil }, nil, 204)
+	if err != nil {
+		return err
+	}
 
-			// write header
-			if err := tw.WriteHeader(header); err != nil {
-				return err
-			}
+	return nil
 
-			if fi.Mode().IsRegular() {
-				data, err := os.Open(file)
-				if err != nil {
-					return err
-				}
-				_, err = io.Copy(tw, data)
-				if err != nil {
-					return err
-				}
-			}
+}
 
-			return nil
-		})
+// DryRunUpdateServerCode sends the code to the server and returns the changes
+// that an update would make, without updating the code.
+func DryRunUpdateServerCode(dir, serverBaseURL string) (*server.DryRunResult, error) {
 
-		if err != nil {
-			return err
-		}
+	cfg, err := config.Current()
+	if err != nil {
+		return nil, fmt.Errorf("while getting current config: %w", err)
 	}
 
-	_, err = tf.Seek(0, 0)
+	err = build.Run(dir)
 	if err != nil {
-		return fmt.Errorf("while seeking tar file to beginning: %w", err)
+		return nil, err
 	}
 
-	err = client.CallAPI(serverBaseURL, "PATCH", path.Join("kartusches", cfg.Name, "code"), nil, func() (io.Reader, error) { return tf, nil }, nil, 204)
+	tf, err := createCodeTar(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	defer tf.Close()
+	defer os.Remove(tf.Name())
+
+	res := &server.DryRunResult{}
+
+	err = client.CallAPI(serverBaseURL, "POST", path.Join("kartusches", cfg.Name, "code", "dry-run"), nil, func() (io.Reader, error) { return tf, nil }, client.JSONDecoder(res), 200)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+
+}
+
+func printDryRunResult(res *server.DryRunResult) {
+	if len(res.Files) == 0 {
+		fmt.Println("no changes")
+	}
+
+	for _, f := range res.Files {
+		switch f.Change {
+		case server.FileAdded:
+			fmt.Printf("A %s\n", f.Path)
+		case server.FileRemoved:
+			fmt.Printf("D %s\n", f.Path)
+		default:
+			fmt.Printf("M %s\n", f.Path)
+		}
+	}
 
+	for _, f := range res.Files {
+		if f.Diff != "" {
+			fmt.Println()
+			fmt.Print(f.Diff)
+		}
+	}
+
+	if len(res.CompileErrors) > 0 {
+		fmt.Println()
+		fmt.Println("compile errors:")
+		for _, ce := range res.CompileErrors {
+			fmt.Printf("%s: %s\n", ce.Path, ce.Error)
+		}
+	}
 }
@@ -7,6 +7,7 @@ import (
 	"path"
 	"path/filepath"
 
+	"github.com/draganm/kartusche/common/build"
 	"github.com/draganm/kartusche/common/client"
 	"github.com/draganm/kartusche/common/serverurl"
 	"github.com/draganm/kartusche/config"
@@ -43,6 +44,11 @@ var Command = &cli.Command{
 
 		kartuscheFileName := filepath.Join(td, "kartusche")
 
+		err = build.Run(dir)
+		if err != nil {
+			return err
+		}
+
 		err = runtime.InitializeNew(kartuscheFileName, dir)
 		if err != nil {
 			return fmt.Errorf("while initializing Kartusche: %w", err)
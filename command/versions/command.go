@@ -0,0 +1,57 @@
+package versions
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/draganm/kartusche/common/client"
+	"github.com/draganm/kartusche/common/serverurl"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/server"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name: "versions",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "remote",
+		},
+	},
+	Action: func(c *cli.Context) (err error) {
+
+		defer func() {
+			if err != nil {
+				err = cli.Exit(fmt.Errorf("while listing code versions: %w", err), 1)
+			}
+		}()
+
+		cfg, err := config.Current()
+		if err != nil {
+			return err
+		}
+
+		serverBaseURL, err := serverurl.BaseServerURL(c.String("remote"))
+		if err != nil {
+			return err
+		}
+
+		versions := []server.CodeVersion{}
+		err = client.CallAPI(serverBaseURL, "GET", path.Join("kartusches", cfg.Name, "versions"), nil, nil, client.JSONDecoder(&versions), 200)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range versions {
+			restored := ""
+			if v.RestoredVersion != 0 {
+				restored = fmt.Sprintf("rollback to %d", v.RestoredVersion)
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", v.Version, v.CreatedAt.Format(time.RFC3339), v.CodeHash, v.UserID, restored)
+		}
+
+		return nil
+
+	},
+}
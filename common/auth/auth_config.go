@@ -39,7 +39,14 @@ func GetAllTokens() (map[string]string, error) {
 
 }
 
+// GetTokenForServer returns the token stored for the server.
+// The token in $KARTUSCHE_TOKEN, e.g. a scoped token in a CI pipeline, is used for all servers.
 func GetTokenForServer(server string) (string, error) {
+	envToken := os.Getenv("KARTUSCHE_TOKEN")
+	if envToken != "" {
+		return envToken, nil
+	}
+
 	tokens, err := GetAllTokens()
 	if err != nil {
 		return "", fmt.Errorf("could not get tokens: %w", err)
@@ -56,6 +63,18 @@ func GetTokenForServer(server string) (string, error) {
 }
 
 func StoreTokenForServer(server, token string) error {
+	return updateTokens(func(tokens map[string]string) {
+		tokens[server] = token
+	})
+}
+
+func RemoveTokenForServer(server string) error {
+	return updateTokens(func(tokens map[string]string) {
+		delete(tokens, server)
+	})
+}
+
+func updateTokens(update func(tokens map[string]string)) error {
 
 	configHome := os.Getenv("XDG_CONFIG_HOME")
 	if configHome == "" {
@@ -93,7 +112,7 @@ func StoreTokenForServer(server, token string) error {
 
 	}
 
-	tokens[server] = token
+	update(tokens)
 
 	nc, err := yaml.Marshal(tokens)
 	if err != nil {
@@ -0,0 +1,206 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/draganm/kartusche/common/manifest"
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// MappingFileName is the name of the file, written to the output dir,
+// mapping entrypoints to the URL paths of their bundles.
+const MappingFileName = "entrypoints.json"
+
+// MarkerFileName is the name of the file, written to the output dir,
+// marking the dir as created by the build. Only marked dirs are cleaned.
+const MarkerFileName = ".kartusche-build"
+
+type Output struct {
+	// File is the URL path of the bundle.
+	File string `json:"file"`
+	// CSS is the URL path of the CSS imported by a JS entrypoint.
+	CSS string `json:"css,omitempty"`
+}
+
+// Run bundles the entrypoints declared in the manifest of the kartusche located in dir.
+// Bundles are written to the output dir within `static` with content hashed file names.
+// Nothing is done if the manifest does not declare any entrypoints.
+func Run(dir string) error {
+	m, err := manifest.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	outputDir := m.OutputDir()
+	if outputDir == "" {
+		return nil
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("while getting abs path: %w", err)
+	}
+
+	outDir := filepath.Join(absDir, outputDir)
+
+	err = cleanOutDir(outDir)
+	if err != nil {
+		return err
+	}
+
+	minify := m.Build.Minify == nil || *m.Build.Minify
+
+	sourcemap := api.SourceMapNone
+	if m.Build.Sourcemap {
+		sourcemap = api.SourceMapLinked
+	}
+
+	res := api.Build(api.BuildOptions{
+		AbsWorkingDir:     absDir,
+		EntryPoints:       m.Build.Entrypoints,
+		Outdir:            outDir,
+		EntryNames:        "[dir]/[name].[hash]",
+		AssetNames:        "[name].[hash]",
+		Bundle:            true,
+		Write:             true,
+		Metafile:          true,
+		MinifyWhitespace:  minify,
+		MinifyIdentifiers: minify,
+		MinifySyntax:      minify,
+		Sourcemap:         sourcemap,
+		Target:            api.ES2015,
+		LogLevel:          api.LogLevelSilent,
+		Loader: map[string]api.Loader{
+			".png":   api.LoaderFile,
+			".jpg":   api.LoaderFile,
+			".jpeg":  api.LoaderFile,
+			".gif":   api.LoaderFile,
+			".svg":   api.LoaderFile,
+			".woff":  api.LoaderFile,
+			".woff2": api.LoaderFile,
+			".ttf":   api.LoaderFile,
+			".eot":   api.LoaderFile,
+		},
+	})
+
+	if len(res.Errors) > 0 {
+		return buildError(res.Errors)
+	}
+
+	mapping, err := entrypointMapping(res.Metafile, absDir, filepath.Join(absDir, m.SourceDir("static")))
+	if err != nil {
+		return err
+	}
+
+	d, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return fmt.Errorf("while marshalling entrypoint mapping: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(outDir, MappingFileName), d, 0700)
+	if err != nil {
+		return fmt.Errorf("while writing entrypoint mapping: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(outDir, MarkerFileName), nil, 0700)
+	if err != nil {
+		return fmt.Errorf("while writing build marker: %w", err)
+	}
+
+	return nil
+}
+
+// cleanOutDir removes the output dir of an earlier build.
+// Dirs not marked by the build are not removed, they could contain files of the user.
+func cleanOutDir(outDir string) error {
+	_, err := os.Stat(outDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("while checking build output dir: %w", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outDir, MarkerFileName))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("build output dir %s was not created by the build, remove it or choose another out_dir", outDir)
+	}
+
+	if err != nil {
+		return fmt.Errorf("while checking build output dir: %w", err)
+	}
+
+	err = os.RemoveAll(outDir)
+	if err != nil {
+		return fmt.Errorf("while cleaning build output dir: %w", err)
+	}
+
+	return nil
+}
+
+type metafile struct {
+	Outputs map[string]struct {
+		EntryPoint string `json:"entryPoint"`
+		CSSBundle  string `json:"cssBundle"`
+	} `json:"outputs"`
+}
+
+func entrypointMapping(metafileJSON, absDir, staticDir string) (map[string]Output, error) {
+	mf := &metafile{}
+	err := json.Unmarshal([]byte(metafileJSON), mf)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing build metafile: %w", err)
+	}
+
+	urlPath := func(output string) (string, error) {
+		rel, err := filepath.Rel(staticDir, filepath.Join(absDir, filepath.FromSlash(output)))
+		if err != nil {
+			return "", err
+		}
+		return path.Join("/", filepath.ToSlash(rel)), nil
+	}
+
+	mapping := map[string]Output{}
+	for output, o := range mf.Outputs {
+		if o.EntryPoint == "" {
+			continue
+		}
+
+		file, err := urlPath(output)
+		if err != nil {
+			return nil, err
+		}
+
+		out := Output{File: file}
+
+		if o.CSSBundle != "" {
+			out.CSS, err = urlPath(o.CSSBundle)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		mapping[o.EntryPoint] = out
+	}
+
+	return mapping, nil
+}
+
+func buildError(messages []api.Message) error {
+	lines := []string{}
+	for _, msg := range messages {
+		if msg.Location != nil {
+			lines = append(lines, fmt.Sprintf("%s:%d:%d: %s", msg.Location.File, msg.Location.Line, msg.Location.Column, msg.Text))
+			continue
+		}
+		lines = append(lines, msg.Text)
+	}
+	return errors.New("build failed:\n" + strings.Join(lines, "\n"))
+}
@@ -0,0 +1,193 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// A bundle is an executable with a kartusche file appended to it:
+//
+//	[executable][kartusche][name][kartusche size][name size][magic]
+//
+// sizes are encoded as little endian uint64.
+
+var magic = []byte("KARTUSCHE-BUNDLE")
+
+const trailerSize = 8 + 8 + 16
+
+var ErrNotBundled = errors.New("executable does not contain a kartusche")
+
+type Bundle struct {
+	Name string
+
+	executablePath  string
+	executableSize  int64
+	kartuscheOffset int64
+	kartuscheSize   int64
+}
+
+// Open reads the bundle trailer of the executable.
+// ErrNotBundled is returned if the executable has no kartusche appended.
+func Open(executablePath string) (*Bundle, error) {
+	f, err := os.Open(executablePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if st.Size() < trailerSize {
+		return nil, ErrNotBundled
+	}
+
+	trailer := make([]byte, trailerSize)
+	_, err = f.ReadAt(trailer, st.Size()-trailerSize)
+	if err != nil {
+		return nil, fmt.Errorf("while reading bundle trailer: %w", err)
+	}
+
+	if !bytes.Equal(trailer[16:], magic) {
+		return nil, ErrNotBundled
+	}
+
+	kartuscheSize := int64(binary.LittleEndian.Uint64(trailer[0:8]))
+	nameSize := int64(binary.LittleEndian.Uint64(trailer[8:16]))
+
+	nameOffset := st.Size() - trailerSize - nameSize
+	kartuscheOffset := nameOffset - kartuscheSize
+
+	if nameSize < 0 || kartuscheSize < 0 || kartuscheOffset < 0 {
+		return nil, errors.New("corrupt bundle trailer")
+	}
+
+	name := make([]byte, nameSize)
+	_, err = f.ReadAt(name, nameOffset)
+	if err != nil {
+		return nil, fmt.Errorf("while reading bundle name: %w", err)
+	}
+
+	return &Bundle{
+		Name:            string(name),
+		executablePath:  executablePath,
+		executableSize:  kartuscheOffset,
+		kartuscheOffset: kartuscheOffset,
+		kartuscheSize:   kartuscheSize,
+	}, nil
+}
+
+// OpenSelf opens the bundle of the currently running executable.
+func OpenSelf() (*Bundle, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("while getting current executable: %w", err)
+	}
+	return Open(exe)
+}
+
+// ExtractKartusche copies the embedded kartusche file to fileName.
+func (b *Bundle) ExtractKartusche(fileName string) (err error) {
+	f, err := os.Open(b.executablePath)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return writeFileAtomically(fileName, 0700, io.NewSectionReader(f, b.kartuscheOffset, b.kartuscheSize))
+}
+
+// Create writes a new bundle consisting of the base executable and the kartusche file.
+// If the base executable is a bundle itself, its kartusche is replaced.
+func Create(outputFileName, baseExecutable, kartuscheFileName, name string) (err error) {
+
+	executableSize := int64(-1)
+
+	b, err := Open(baseExecutable)
+	switch {
+	case errors.Is(err, ErrNotBundled):
+	case err != nil:
+		return fmt.Errorf("while checking base executable: %w", err)
+	default:
+		executableSize = b.executableSize
+	}
+
+	exe, err := os.Open(baseExecutable)
+	if err != nil {
+		return fmt.Errorf("while opening base executable: %w", err)
+	}
+
+	defer exe.Close()
+
+	if executableSize < 0 {
+		st, err := exe.Stat()
+		if err != nil {
+			return err
+		}
+		executableSize = st.Size()
+	}
+
+	kf, err := os.Open(kartuscheFileName)
+	if err != nil {
+		return fmt.Errorf("while opening kartusche: %w", err)
+	}
+
+	defer kf.Close()
+
+	kst, err := kf.Stat()
+	if err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 16, trailerSize)
+	binary.LittleEndian.PutUint64(trailer[0:8], uint64(kst.Size()))
+	binary.LittleEndian.PutUint64(trailer[8:16], uint64(len(name)))
+	trailer = append(trailer, magic...)
+
+	return writeFileAtomically(
+		outputFileName,
+		0755,
+		io.MultiReader(
+			io.LimitReader(exe, executableSize),
+			kf,
+			bytes.NewReader([]byte(name)),
+			bytes.NewReader(trailer),
+		),
+	)
+
+}
+
+func writeFileAtomically(fileName string, perm os.FileMode, r io.Reader) (err error) {
+	tmpName := fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return fmt.Errorf("while writing %s: %w", fileName, err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, fileName)
+}
@@ -0,0 +1,160 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, fileName string, content []byte) string {
+	t.Helper()
+	err := os.WriteFile(fileName, content, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func readFile(t *testing.T, fileName string) []byte {
+	t.Helper()
+	d, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// createBundle bundles the executable and kartusche contents into a new file in dir.
+func createBundle(t *testing.T, dir string, executable, kartusche []byte, name string) string {
+	t.Helper()
+
+	exe := writeFile(t, filepath.Join(dir, "exe"), executable)
+	kf := writeFile(t, filepath.Join(dir, "kartusche"), kartusche)
+	bundled := filepath.Join(dir, "bundled")
+
+	err := Create(bundled, exe, kf, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bundled
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	executable := []byte("#!/bin/sh\necho executable\n")
+	kartusche := []byte("kartusche content")
+
+	bundled := createBundle(t, dir, executable, kartusche, "test")
+
+	d := readFile(t, bundled)
+
+	expectedTrailer := make([]byte, 16)
+	binary.LittleEndian.PutUint64(expectedTrailer[0:8], uint64(len(kartusche)))
+	binary.LittleEndian.PutUint64(expectedTrailer[8:16], uint64(len("test")))
+	expectedTrailer = append(expectedTrailer, magic...)
+
+	expected := bytes.Join([][]byte{executable, kartusche, []byte("test"), expectedTrailer}, nil)
+	if !bytes.Equal(d, expected) {
+		t.Fatalf("unexpected bundle layout %q", d)
+	}
+
+	b, err := Open(bundled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Name != "test" {
+		t.Fatalf("expected name test, got %q", b.Name)
+	}
+
+	extracted := filepath.Join(dir, "extracted")
+	err = b.ExtractKartusche(extracted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(readFile(t, extracted), kartusche) {
+		t.Fatalf("unexpected extracted kartusche %q", readFile(t, extracted))
+	}
+}
+
+func TestCreateReplacesKartuscheOfBundle(t *testing.T) {
+	dir := t.TempDir()
+
+	executable := []byte("executable")
+	bundled := createBundle(t, dir, executable, []byte("first"), "first")
+
+	kf := writeFile(t, filepath.Join(dir, "second.kartusche"), []byte("second"))
+	rebundled := filepath.Join(dir, "rebundled")
+
+	err := Create(rebundled, bundled, kf, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := readFile(t, rebundled)
+	if !bytes.HasPrefix(d, append(executable, []byte("second")...)) {
+		t.Fatalf("expected kartusche to be replaced, got %q", d)
+	}
+
+	b, err := Open(rebundled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Name != "second" {
+		t.Fatalf("expected name second, got %q", b.Name)
+	}
+}
+
+func TestOpenNotBundled(t *testing.T) {
+	dir := t.TempDir()
+
+	bundled := createBundle(t, dir, []byte("executable"), []byte("kartusche"), "test")
+	d := readFile(t, bundled)
+
+	wrongMagic := append([]byte{}, d...)
+	wrongMagic[len(wrongMagic)-1] = 'X'
+
+	cases := map[string][]byte{
+		"plain executable":         []byte("executable without a kartusche appended to it"),
+		"shorter than the trailer": d[len(d)-trailerSize+1:],
+		"truncated trailer":        d[:len(d)-1],
+		"wrong magic":              wrongMagic,
+	}
+
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Open(writeFile(t, filepath.Join(dir, "candidate"), content))
+			if !errors.Is(err, ErrNotBundled) {
+				t.Fatalf("expected ErrNotBundled, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenCorruptTrailer(t *testing.T) {
+	dir := t.TempDir()
+
+	trailer := make([]byte, 16)
+	binary.LittleEndian.PutUint64(trailer[0:8], 1000)
+	binary.LittleEndian.PutUint64(trailer[8:16], 4)
+	trailer = append(trailer, magic...)
+
+	_, err := Open(writeFile(t, filepath.Join(dir, "corrupt"), append([]byte("name"), trailer...)))
+	if err == nil || errors.Is(err, ErrNotBundled) {
+		t.Fatalf("expected corrupt trailer error, got %v", err)
+	}
+}
+
+func TestOpenSelfNotBundled(t *testing.T) {
+	_, err := OpenSelf()
+	if !errors.Is(err, ErrNotBundled) {
+		t.Fatalf("expected ErrNotBundled, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileName is the name of the file, located in the root of the kartusche dir,
+// containing gitignore style patterns of files that are not part of the kartusche code.
+const FileName = ".kartuscheignore"
+
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher matches slash separated paths relative to the kartusche dir
+// against the patterns of a .kartuscheignore file.
+type Matcher struct {
+	patterns []pattern
+}
+
+// Load reads the .kartuscheignore file from dir.
+// If the file does not exist, the returned Matcher does not ignore anything.
+func Load(dir string) (*Matcher, error) {
+	f, err := os.Open(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) {
+		return &Matcher{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	m, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s: %w", FileName, err)
+	}
+
+	return m, nil
+}
+
+// Parse parses gitignore style patterns, one per line.
+func Parse(r io.Reader) (*Matcher, error) {
+	m := &Matcher{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		err := m.Add(s.Text())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Add adds a single gitignore style pattern to the matcher.
+// Empty lines and comments are skipped.
+func (m *Matcher) Add(line string) error {
+	original := line
+	line = strings.TrimRight(line, " \t\r")
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	p := pattern{}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	if line == "" {
+		return nil
+	}
+
+	// patterns containing a slash are relative to the kartusche dir,
+	// other patterns match the name at any level
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return fmt.Errorf("while compiling pattern %q: %w", original, err)
+	}
+
+	p.re = re
+
+	m.patterns = append(m.patterns, p)
+
+	return nil
+}
+
+// Match returns true if the file or dir with the given slash separated name
+// relative to the kartusche dir is ignored.
+// A file is also ignored when any of its parent dirs is ignored.
+func (m *Matcher) Match(name string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+
+	name = strings.Trim(path.Clean(name), "/")
+	if name == "." || name == "" {
+		return false
+	}
+
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.matchSelf(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+
+	return m.matchSelf(name, isDir)
+}
+
+func (m *Matcher) matchSelf(name string, isDir bool) bool {
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(name) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func globToRegexp(glob string) string {
+	sb := new(strings.Builder)
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "/**":
+			sb.WriteString("/.*")
+			i += 2
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,32 @@
+package ignore
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/draganm/kartusche/common/manifest"
+	"go.uber.org/multierr"
+)
+
+// LoadForWatching reads the .kartuscheignore file from dir and additionally ignores the build output dir
+// declared in the manifest, which is written by the commands watching dir for changes.
+// The returned Matcher is never nil, if the ignore file or the manifest can't be loaded,
+// it ignores what could be loaded and the error is returned as well.
+func LoadForWatching(dir string) (*Matcher, error) {
+	m, err := Load(dir)
+	if err != nil {
+		m = &Matcher{}
+	}
+
+	km, manifestErr := manifest.Load(dir)
+	if manifestErr != nil {
+		return m, multierr.Append(err, fmt.Errorf("while loading manifest: %w", manifestErr))
+	}
+
+	outputDir := km.OutputDir()
+	if outputDir != "" {
+		err = multierr.Append(err, m.Add("/"+filepath.ToSlash(outputDir)+"/"))
+	}
+
+	return m, err
+}
@@ -0,0 +1,256 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/paths"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the manifest, both in the kartusche dir and in the kartusche itself.
+const FileName = "kartusche.yaml"
+
+var Path = dbpath.ToPath(FileName)
+
+type Manifest struct {
+	// Layout maps well known kartusche paths (e.g. `static`) to directories
+	// relative to the kartusche dir they are loaded from.
+	Layout map[string]string `yaml:"layout,omitempty"`
+
+	SPA *SPA `yaml:"spa,omitempty"`
+
+	Static Static `yaml:"static,omitempty"`
+
+	Build *Build `yaml:"build,omitempty"`
+
+	Headers []Headers `yaml:"headers,omitempty"`
+
+	Timeouts Timeouts `yaml:"timeouts,omitempty"`
+
+	// Cronjobs maps the names of cronjobs (without `.js`) to their schedule.
+	// Schedules declared here take precedence over the schedule comment in the first line of the cronjob.
+	Cronjobs map[string]string `yaml:"cronjobs,omitempty"`
+
+	// Env is available to the JS code as the `env` object.
+	Env map[string]string `yaml:"env,omitempty"`
+}
+
+type SPA struct {
+	// Index is the static file served for GET requests not matching any route.
+	Index string `yaml:"index"`
+}
+
+type Static struct {
+	// CacheControl is the Cache-Control header of static files.
+	CacheControl string `yaml:"cache_control,omitempty"`
+
+	// FingerprintedCacheControl is the Cache-Control header of static files
+	// containing a content hash in their name (e.g. `app.3f2a9c1b.js`).
+	// Defaults to DefaultFingerprintedCacheControl.
+	FingerprintedCacheControl string `yaml:"fingerprinted_cache_control,omitempty"`
+
+	// MaxCachedSize is the size in bytes above which static files are not kept in memory,
+	// but read from the database for every request.
+	// Defaults to DefaultMaxCachedSize.
+	MaxCachedSize int64 `yaml:"max_cached_size,omitempty"`
+}
+
+const DefaultFingerprintedCacheControl = "public, max-age=31536000, immutable"
+
+const DefaultMaxCachedSize = 1024 * 1024
+
+// CacheSizeLimit returns the size in bytes above which static files are not kept in memory.
+func (s Static) CacheSizeLimit() int64 {
+	if s.MaxCachedSize <= 0 {
+		return DefaultMaxCachedSize
+	}
+	return s.MaxCachedSize
+}
+
+// fingerprintRegexp matches hex content hashes and base32 hashes generated by the build.
+var fingerprintRegexp = regexp.MustCompile(`[.-]([0-9a-fA-F]{8,}|[0-9A-Z]{8})\.[^./]+$`)
+
+// CacheControlFor returns the Cache-Control header for the static file.
+func (s Static) CacheControlFor(name string) string {
+	if fingerprintRegexp.MatchString(name) {
+		if s.FingerprintedCacheControl == "" {
+			return DefaultFingerprintedCacheControl
+		}
+		return s.FingerprintedCacheControl
+	}
+	return s.CacheControl
+}
+
+type Build struct {
+	// Entrypoints are JS and CSS files, relative to the kartusche dir,
+	// bundled into OutDir.
+	Entrypoints []string `yaml:"entrypoints"`
+
+	// OutDir is the directory within `static` the bundles are written to.
+	// It is owned by the build and its content is replaced on every build.
+	// Defaults to DefaultBuildOutDir.
+	OutDir string `yaml:"out_dir,omitempty"`
+
+	// Minify defaults to true.
+	Minify *bool `yaml:"minify,omitempty"`
+
+	Sourcemap bool `yaml:"sourcemap,omitempty"`
+}
+
+const DefaultBuildOutDir = "_build"
+
+// OutputDir returns the directory the bundles are written to, relative to the kartusche dir.
+// It returns an empty string if there is nothing to build.
+func (m *Manifest) OutputDir() string {
+	if m.Build == nil || len(m.Build.Entrypoints) == 0 {
+		return ""
+	}
+
+	outDir := m.Build.OutDir
+	if outDir == "" {
+		outDir = DefaultBuildOutDir
+	}
+
+	return filepath.Join(m.SourceDir("static"), filepath.FromSlash(outDir))
+}
+
+type Headers struct {
+	// Path is matched against the request path using `path.Match`.
+	// A trailing `/**` matches all paths below.
+	Path   string            `yaml:"path"`
+	Values map[string]string `yaml:"values"`
+}
+
+type Timeouts struct {
+	Handler time.Duration `yaml:"handler,omitempty"`
+	Cronjob time.Duration `yaml:"cronjob,omitempty"`
+	Job     time.Duration `yaml:"job,omitempty"`
+}
+
+// Parse parses and validates the manifest.
+func Parse(d []byte) (*Manifest, error) {
+	m := &Manifest{}
+
+	err := yaml.Unmarshal(d, m)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s: %w", FileName, err)
+	}
+
+	err = m.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", FileName, err)
+	}
+
+	return m, nil
+}
+
+// Load reads the manifest from the kartusche dir.
+// If there is no manifest, an empty one is returned.
+func Load(dir string) (*Manifest, error) {
+	d, err := os.ReadFile(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) {
+		return &Manifest{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(d)
+}
+
+// FromTx reads the manifest stored in the kartusche.
+// If there is no manifest, an empty one is returned.
+func FromTx(tx bolted.SugaredReadTx) (*Manifest, error) {
+	if !tx.Exists(Path) || tx.IsMap(Path) {
+		return &Manifest{}, nil
+	}
+
+	return Parse(tx.Get(Path))
+}
+
+// SourceDir returns the path, relative to the kartusche dir,
+// the well known kartusche path is loaded from.
+func (m *Manifest) SourceDir(name string) string {
+	dir, found := m.Layout[name]
+	if !found {
+		return name
+	}
+	return filepath.FromSlash(dir)
+}
+
+// HeadersFor returns the headers configured for the request path.
+func (m *Manifest) HeadersFor(requestPath string) map[string]string {
+	var headers map[string]string
+	for _, h := range m.Headers {
+		if !h.matches(requestPath) {
+			continue
+		}
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		for k, v := range h.Values {
+			headers[k] = v
+		}
+	}
+	return headers
+}
+
+func (h Headers) matches(requestPath string) bool {
+	if strings.HasSuffix(h.Path, "/**") {
+		return strings.HasPrefix(requestPath, strings.TrimSuffix(h.Path, "**"))
+	}
+	matched, _ := path.Match(h.Path, requestPath)
+	return matched
+}
+
+func (m *Manifest) validate() error {
+	for name, dir := range m.Layout {
+		if !isWellKnown(name) || name == FileName {
+			return fmt.Errorf("layout of %q can't be changed", name)
+		}
+
+		clean := path.Clean(dir)
+		if dir == "" || clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("layout of %q must be a sub-directory of the kartusche dir", name)
+		}
+	}
+
+	if m.Build != nil && m.Build.OutDir != "" {
+		clean := path.Clean(m.Build.OutDir)
+		if clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return errors.New("build out_dir must be a sub-directory of static")
+		}
+	}
+
+	if m.SPA != nil && m.SPA.Index == "" {
+		return errors.New("spa index must be set")
+	}
+
+	for _, h := range m.Headers {
+		_, err := path.Match(h.Path, "/")
+		if !strings.HasPrefix(h.Path, "/") || err != nil {
+			return fmt.Errorf("invalid headers path %q", h.Path)
+		}
+	}
+
+	return nil
+}
+
+func isWellKnown(name string) bool {
+	for _, wk := range paths.WellKnown {
+		if wk == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package packer
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/draganm/kartusche/common/ignore"
+	"github.com/draganm/kartusche/common/manifest"
+	"github.com/draganm/kartusche/common/paths"
+)
+
+// WalkFunc is called for every file and directory of the kartusche code.
+// name is the slash separated path of the file in the kartusche.
+type WalkFunc func(name, file string, fi os.FileInfo) error
+
+// Walk calls fn for every file and directory of the kartusche code located in dir.
+// Well known paths are loaded from the directories set in the layout of the manifest.
+// Files and directories matching the patterns in .kartuscheignore are skipped.
+func Walk(dir string, fn WalkFunc) error {
+
+	ignored, err := ignore.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	m, err := manifest.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths.WellKnown {
+
+		root := filepath.Join(dir, m.SourceDir(p))
+
+		_, err := os.Stat(root)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = filepath.Walk(root, func(file string, fi os.FileInfo, err error) error {
+
+			if err != nil {
+				return fmt.Errorf("while walking dir: %w", err)
+			}
+
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return fmt.Errorf("while getting relative path of %s: %w", file, err)
+			}
+
+			if ignored.Match(filepath.ToSlash(rel), fi.IsDir()) {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			relToRoot, err := filepath.Rel(root, file)
+			if err != nil {
+				return fmt.Errorf("while getting relative path of %s: %w", file, err)
+			}
+
+			return fn(path.Join(p, filepath.ToSlash(relToRoot)), file, fi)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteTar writes the kartusche code located in dir as a tar archive.
+func WriteTar(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	err := Walk(dir, func(name, file string, fi os.FileInfo) error {
+
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		// generate tar header
+		header, err := tar.FileInfoHeader(fi, file)
+		if err != nil {
+			return err
+		}
+
+		// must provide real name
+		// (see https://golang.org/src/archive/tar/common.go?#L626)
+		header.Name = name
+
+		// write header
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode().IsRegular() {
+			data, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer data.Close()
+
+			_, err = io.Copy(tw, data)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// Files returns the paths of all files of the kartusche code located in dir,
+// keyed by their name in the kartusche.
+func Files(dir string) (map[string]string, error) {
+	files := map[string]string{}
+
+	err := Walk(dir, func(name, file string, fi os.FileInfo) error {
+		if fi.Mode().IsRegular() {
+			files[name] = file
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// Hashes returns hex encoded SHA256 hashes of all files of the kartusche code
+// located in dir.
+func Hashes(dir string) (map[string]string, error) {
+	hashes := map[string]string{}
+
+	err := Walk(dir, func(name, file string, fi os.FileInfo) error {
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		if err != nil {
+			return fmt.Errorf("while hashing %s: %w", file, err)
+		}
+
+		hashes[name] = hex.EncodeToString(h.Sum(nil))
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
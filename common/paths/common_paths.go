@@ -10,4 +10,38 @@ var WellKnown = []string{
 	"jobs",
 	"job-queue",
 	"init.js",
+	"kartusche.yaml",
+}
+
+// Data is the top level path containing the data of the kartusche.
+const Data = "data"
+
+// Failures is the top level path where the runtime records failed requests.
+// It is neither part of the code nor of the data.
+const Failures = "failures"
+
+// JobQueue is the top level path where the runtime keeps scheduled jobs.
+// It is neither part of the code nor of the data and is preserved when the code is replaced.
+const JobQueue = "job-queue"
+
+// Generated are top level paths the runtime derives from the code.
+// They are neither part of the code nor of the data and are preserved
+// when the code is replaced.
+var Generated = []string{
+	"static-meta",
+}
+
+// IsGenerated returns true if the top level key is derived from the code.
+func IsGenerated(key string) bool {
+	for _, g := range Generated {
+		if g == key {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCode returns true if the top level key is part of the code.
+func IsCode(key string) bool {
+	return key != Data && key != Failures && key != JobQueue && !IsGenerated(key)
 }
@@ -0,0 +1,62 @@
+package statusrecorder
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Recorder records the response status.
+// It supports flushing and hijacking (e.g. for websockets) if the underlying writer does.
+type Recorder struct {
+	http.ResponseWriter
+	status   int
+	hijacked bool
+}
+
+func New(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+func (sr *Recorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *Recorder) Write(d []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(d)
+}
+
+func (sr *Recorder) Flush() {
+	flusher, ok := sr.ResponseWriter.(http.Flusher)
+	if ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *Recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	sr.hijacked = true
+	return hijacker.Hijack()
+}
+
+// StatusCode returns the recorded status, 200 if nothing was written and 101 if the connection was hijacked.
+func (sr *Recorder) StatusCode() int {
+	switch {
+	case sr.hijacked:
+		return http.StatusSwitchingProtocols
+	case sr.status == 0:
+		return http.StatusOK
+	default:
+		return sr.status
+	}
+}
@@ -65,8 +65,6 @@ func Current() (*Config, error) {
 		return c, nil
 	}
 
-	return nil, ErrConfigNotFound
-
 }
 
 func loadConfig(path string) (*Config, error) {
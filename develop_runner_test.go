@@ -0,0 +1,110 @@
+package main_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+type runningDevServer struct {
+	url      string
+	shutdown func() error
+}
+
+func startDevServer(binaryPath, workDir, dir string) (*runningDevServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("while finding a free port: %w", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cmd := exec.Command(binaryPath, "develop", "--addr", addr)
+	cmd.Dir = dir
+	cmd.Env = append(
+		os.Environ(),
+		fmt.Sprintf("XDG_CONFIG_HOME=%s", workDir),
+	)
+
+	output := &syncBuffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("while starting dev server: %w", err)
+	}
+
+	processDoneChan := make(chan int)
+
+	go func() {
+		st, err := cmd.Process.Wait()
+		if err != nil {
+			fmt.Println(fmt.Errorf("while waiting for the process: %w", err))
+			return
+		}
+		processDoneChan <- st.ExitCode()
+	}()
+
+	shutdown := func() error {
+		select {
+		case <-processDoneChan:
+			// all good, server is down
+		default:
+			err := cmd.Process.Kill()
+			if err != nil {
+				return fmt.Errorf("while killing process: %w", err)
+			}
+			select {
+			case <-time.NewTimer(3 * time.Second).C:
+				return fmt.Errorf("timed out while shutting down dev server")
+			case <-processDoneChan:
+				// all good, server is down now, continue
+			}
+		}
+		return nil
+	}
+
+	url := fmt.Sprintf("http://%s", addr)
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(50 * time.Millisecond) {
+		select {
+		case <-processDoneChan:
+			return nil, fmt.Errorf("dev server has died before properly starting:\n%s\n", output.String())
+		default:
+		}
+
+		// the code is loaded after the server has started listening
+		if !strings.Contains(output.String(), "updated runtime") {
+			continue
+		}
+
+		return &runningDevServer{url: url, shutdown: shutdown}, nil
+	}
+
+	shutdown()
+
+	return nil, fmt.Errorf("dev server did not start within 5 seconds:\n%s\n", output.String())
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,23 @@
+Feature: audit log
+
+    Background:
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+
+    Scenario: logins and code changes are audited
+        When I upload the kartusche
+        And I change the response to "v2" and update the code
+        Then the audit log should list "login" by "mock@kartusche.com" with outcome "success"
+        And the audit log should list "upload" of "test-project" with outcome "success"
+        And the audit log should list "patch-code" of "test-project" with outcome "success"
+
+    Scenario: failed actions are audited
+        Given I upload the kartusche
+        When I try to roll back the code to version 42
+        Then the audit log should list "rollback" of "test-project" with outcome "failure (404)"
+
+    Scenario: requests failing authentication are not audited
+        Given I upload the kartusche
+        When I try to remove the kartusche with an invalid token
+        Then the audit log should not list "rm" of "test-project"
@@ -4,3 +4,9 @@ Feature: authentication
         Given the server is running
         When I authenticate the user using browser
         Then the user config should contain token for the server
+
+    Scenario: the mock provider must be allowed explicitly
+        Then starting the server with the mock provider without allowing it should fail
+
+    Scenario: the auth provider must be set
+        Then starting the server without an auth provider should fail
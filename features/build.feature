@@ -0,0 +1,24 @@
+Feature: static asset build
+
+    Scenario: entrypoints are bundled into static when uploading
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project has a file "kartusche.yaml" containing "build: {entrypoints: [build/app.js]}"
+        And the project has a file "build/greet.js" containing "export const greet = (name) => 'hello ' + name"
+        And the project has a file "build/app.js" containing "import {greet} from './greet.js'; console.log(greet('world'))"
+        When I upload the kartusche
+        Then the bundle of "build/app.js" should contain "hello "
+        When the project has a file "build/greet.js" containing "export const greet = (name) => 'hi ' + name"
+        And I update the code
+        Then the bundle of "build/app.js" should contain "hi "
+
+    Scenario: an output dir not created by the build is not replaced
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project has a file "kartusche.yaml" containing "build: {entrypoints: [build/app.js], out_dir: css}"
+        And the project has a file "build/app.js" containing "console.log('hello')"
+        And the project has a file "static/css/site.css" containing "body {}"
+        Then uploading the kartusche should fail with "was not created by the build"
+        And the project should have a file "static/css/site.css"
@@ -0,0 +1,39 @@
+Feature: incremental code sync
+
+    Scenario: added and removed handlers are synced
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        When I upload the kartusche
+        And I add a handler for "/other" responding with "other" and update the code
+        Then the kartusche should respond to "/other" with "other"
+        When I remove the handler for "/other" and update the code
+        Then the kartusche should respond to "/other" with status 404
+        And the kartusche should respond with "v1"
+
+    Scenario: updating unchanged code does not record a new version
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        When I upload the kartusche
+        And I update the code
+        Then the kartusche should have 1 code versions
+
+    Scenario: develop patches do not record a new version
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And I upload the kartusche
+        And the kartusche should respond with "v1"
+        When I change the response to "dev" with a develop patch
+        Then the kartusche should respond with "dev"
+        And the kartusche should have 1 code versions
+
+    Scenario: patches based on changed code are rejected
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And I upload the kartusche
+        And the kartusche should respond with "v1"
+        Then patching "handler/GET.js" based on a stale version should be rejected
+        And the kartusche should respond with "v1"
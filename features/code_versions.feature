@@ -0,0 +1,24 @@
+Feature: code versions
+
+    Scenario: rolling back code to an earlier version
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        When I upload the kartusche
+        And I change the response to "v2" and update the code
+        Then the kartusche should respond with "v2"
+        When I roll back the code to version 1
+        Then the kartusche should respond with "v1"
+        And the kartusche should have 3 code versions
+
+    Scenario: changing code over WebDAV records a version
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        When I upload the kartusche
+        And the kartusche should respond with "v1"
+        And I write "w.write('v2')" to "handler/GET.js" over WebDAV
+        Then the kartusche should respond with "v2"
+        And the kartusche should have 2 code versions
+        When I write "some data" to "data/x" over WebDAV
+        Then the kartusche should have 2 code versions
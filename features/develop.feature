@@ -0,0 +1,25 @@
+Feature: development server
+
+    Background:
+        Given a local kartusche project
+        And the project has a file "static/index.html" containing "<html><body>hello</body></html>"
+        And the project has a file "static/style.css" containing "body {}"
+        And the development server is running
+
+    Scenario: live reload script is injected into HTML
+        Then the development server should respond to "/index.html" with the live reload script
+
+    Scenario: browser reloads after the code is updated
+        Given I am listening for live reload events
+        When the project has a handler for "/api" responding with "v2"
+        Then I should receive a "reload" live reload event
+
+    Scenario: stylesheets are swapped when only CSS has changed
+        Given I am listening for live reload events
+        When the project has a file "static/style.css" containing "body {color: red}"
+        Then I should receive a "css" live reload event
+
+    Scenario: compile errors are reported
+        Given I am listening for live reload events
+        When the project has a file "handler/GET.js" containing "w.write("
+        Then I should receive a "error" live reload event
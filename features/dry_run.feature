@@ -0,0 +1,18 @@
+Feature: dry run of code update
+
+    Scenario: dry run shows changes without updating the code
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        When I upload the kartusche
+        And I change the response to "v2" and dry run the code update
+        Then the dry run should report "handler/GET.js" as changed
+        And the kartusche should respond with "v1"
+
+    Scenario: dry run reports compile errors
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        When I upload the kartusche
+        And I add a handler with a syntax error and dry run the code update
+        Then the dry run should report a compile error for "handler/broken/GET.js"
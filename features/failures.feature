@@ -0,0 +1,39 @@
+Feature: failures
+
+    Background:
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project has a file "handler/fail/POST.js" containing "throw new Error('failed on ' + requestBody())"
+        And I upload the kartusche
+        And the kartusche should respond with "v1"
+
+    Scenario: listing failures
+        When I post "payload" to "/fail" of the kartusche
+        Then the failures of the kartusche should list "POST /fail"
+        And the failures of the kartusche should list "Error: failed on payload"
+
+    Scenario: credentials are redacted from failures
+        When I post "payload" to "/fail" of the kartusche
+        Then the header "Authorization" of the last failure should be redacted
+        And the header "X-Api-Key" of the last failure should be redacted
+        And the last failure should have the request body "payload"
+
+    Scenario: viewers can't read request bodies of failures
+        Given I grant "bob@example.com" the "viewer" role
+        And I post "payload" to "/fail" of the kartusche
+        When I authenticate as "bob@example.com" using browser
+        Then the failures of the kartusche should list "POST /fail"
+        And the last failure should not have a request body
+
+    Scenario: failures record the code version
+        Given I add a handler for "/other" responding with "other" and update the code
+        When I post "payload" to "/fail" of the kartusche
+        Then the last failure should have the code hash of version 2
+
+    Scenario: replaying a failure against the development server
+        Given I post "payload" to "/fail" of the kartusche
+        And the development server is running
+        When I replay the last failure against the development server
+        Then the output should contain "500 Internal Server Error"
+        And the output should contain "failed on payload"
@@ -0,0 +1,20 @@
+Feature: kartusche manifest
+
+    Scenario: static files are loaded from the directory set in the layout
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project has a file "kartusche.yaml" containing "layout: {static: web/dist}"
+        And the project has a file "web/dist/app.txt" containing "app"
+        When I upload the kartusche
+        Then the kartusche should respond to "/app.txt" with "app"
+        When the project has a file "web/dist/app.txt" containing "changed"
+        And I update the code
+        Then the kartusche should respond to "/app.txt" with "changed"
+
+    Scenario: the kartusche dir can't be used as a layout directory
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project has a file "kartusche.yaml" containing "layout: {static: .}"
+        Then uploading the kartusche should fail with "must be a sub-directory of the kartusche dir"
@@ -0,0 +1,13 @@
+Feature: .kartuscheignore
+
+    Scenario: ignored files are not uploaded
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project ignores "secret/"
+        And the project has a handler for "/secret" responding with "secret"
+        When I upload the kartusche
+        Then the kartusche should respond to "/secret" with status 404
+        When I add a handler for "/public" responding with "public" and update the code
+        Then the kartusche should respond to "/public" with "public"
+        And the kartusche should respond to "/secret" with status 404
@@ -0,0 +1,33 @@
+Feature: login requests
+
+    Scenario: the access token is handed out only once
+        Given the server is running
+        When I authenticate the user using browser
+        Then requesting the access token should fail with status 404
+
+    Scenario: expired login requests are deleted
+        Given the server is running with a login request ttl of "1s"
+        When I start a login
+        Then requesting the access token should respond with "authorization_pending"
+        And the login request should expire
+        And requesting the access token should fail with status 404
+
+    Scenario: tokens issued for expired login requests are deleted
+        Given the server is running with a login request ttl of "2s"
+        And I authenticate the user using browser
+        When I start a login
+        And I complete the login in the browser
+        Then the login request should expire
+        And the user should have 1 token
+
+    Scenario: verifying an unknown login request is rejected
+        Given the server is running
+        Then opening the verification page for the login request "unknown" should fail with status 404
+
+    Scenario: starting logins is rate limited
+        Given the server is running
+        Then starting 25 logins should be rate limited
+
+    Scenario: opening the verification page is rate limited
+        Given the server is running
+        Then opening the verification page 25 times should be rate limited
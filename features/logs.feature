@@ -0,0 +1,22 @@
+Feature: kartusche logs
+
+    Background:
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project has a file "handler/greet/GET.js" containing "log.info('greeting', {name: 'world'}); w.write('hi')"
+        And I upload the kartusche
+
+    Scenario: listing recent log entries
+        When the kartusche should respond to "/greet" with "hi"
+        Then the logs of the kartusche should contain "greeting handler=handler/greet/GET.js"
+
+    Scenario: following log entries
+        Given I follow the logs of the kartusche
+        When the kartusche should respond to "/greet" with "hi"
+        Then the followed logs should contain "greeting handler=handler/greet/GET.js"
+
+    Scenario: following ends when the kartusche is removed
+        Given I follow the logs of the kartusche
+        When I remove the kartusche
+        Then following the logs should have finished
@@ -0,0 +1,20 @@
+Feature: prometheus metrics
+
+    Background:
+        Given the server is running with the metrics token "metrics-secret"
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project has a handler for "/greet" responding with "hi"
+        And I upload the kartusche
+
+    Scenario: metrics of handlers and the database
+        When the kartusche should respond to "/greet" with "hi"
+        Then the server metrics should contain:
+            """
+            kartusche_handler_requests_total{kartusche="test-project",method="GET",route="/greet",status="200"} 1
+            kartusche_db_open_read_transactions{kartusche="test-project"}
+            go_goroutines
+            """
+
+    Scenario: metrics require the token
+        Then getting the server metrics without the token should be refused
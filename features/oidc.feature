@@ -0,0 +1,30 @@
+Feature: OpenID Connect authentication
+
+    Background:
+        Given an OIDC identity provider
+        And the server is running with OIDC authentication allowing the group "developers"
+
+    Scenario: members of an allowed group can log in
+        Given the identity provider authenticates "alice@example.com" in the group "developers"
+        When I authenticate the user using browser
+        Then the user config should contain token for the server
+        And a kartusche project responding with "v1"
+        And I upload the kartusche
+        And the audit log should list "login" by "alice@example.com" with outcome "success"
+        And the audit log should list "upload" by "alice@example.com" with outcome "success"
+
+    Scenario: users not in an allowed group are denied
+        Given the identity provider authenticates "mallory@example.com" in the group "guests"
+        Then authenticating using browser should be denied
+
+    Scenario: ID tokens signed with PS256 are accepted
+        Given the identity provider signs ID tokens with "PS256"
+        And the identity provider authenticates "alice@example.com" in the group "developers"
+        When I authenticate the user using browser
+        Then the user config should contain token for the server
+
+    Scenario: ID tokens signed with ES256 are accepted
+        Given the identity provider signs ID tokens with "ES256"
+        And the identity provider authenticates "alice@example.com" in the group "developers"
+        When I authenticate the user using browser
+        Then the user config should contain token for the server
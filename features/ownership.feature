@@ -0,0 +1,29 @@
+Feature: kartusche ownership
+
+    Background:
+        Given the server is running
+        And I authenticate as "alice@example.com" using browser
+        And a kartusche project responding with "v1"
+        And I upload the kartusche
+
+    Scenario: only the owner can access a kartusche
+        When I authenticate as "bob@example.com" using browser
+        Then updating the code should be denied
+        And the kartusche should not be listed
+        And the kartusche should not be accessible over WebDAV
+
+    Scenario: users granted access can update the code
+        When I grant "bob@example.com" access to the kartusche
+        And I authenticate as "bob@example.com" using browser
+        And I change the response to "v2" and update the code
+        Then the kartusche should respond with "v2"
+
+    Scenario: kartusches uploaded before ownership was recorded are assigned to the legacy owner
+        Given the kartusche was uploaded before ownership was recorded
+        When the server is restarted
+        Then the kartusche should not be listed
+        When the server is restarted with the legacy owner "bob@example.com"
+        Then the kartusche should not be listed
+        When I authenticate as "bob@example.com" using browser
+        And I change the response to "v2" and update the code
+        Then the kartusche should respond with "v2"
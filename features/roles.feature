@@ -0,0 +1,41 @@
+Feature: roles
+
+    Background:
+        Given the server is running
+        And I authenticate as "alice@example.com" using browser
+        And a kartusche project responding with "v1"
+        And I upload the kartusche
+
+    Scenario: viewers can read but not change the kartusche
+        When I grant "bob@example.com" the "viewer" role
+        And I authenticate as "bob@example.com" using browser
+        Then the access list should show "bob@example.com" with role "viewer"
+        And the kartusche should have 1 code versions
+        And the audit log should list "upload" of "test-project" with outcome "success"
+        And updating the code should be denied
+        And writing "handler/GET.js" over WebDAV should be denied
+
+    Scenario: developers can update the code but not remove the kartusche
+        When I grant "bob@example.com" the "developer" role
+        And I authenticate as "bob@example.com" using browser
+        And I change the response to "v2" and update the code
+        Then the kartusche should respond with "v2"
+        And removing the kartusche should be denied
+
+    Scenario: users with revoked access can't access the kartusche
+        Given I grant "bob@example.com" the "admin" role
+        When I revoke the access of "bob@example.com"
+        And I authenticate as "bob@example.com" using browser
+        Then the kartusche should not be listed
+
+    Scenario: other users can't upload a kartusche with the same name
+        When I authenticate as "bob@example.com" using browser
+        Then uploading the kartusche should be denied
+        And the kartusche file should still be on the server
+        And the kartusche should respond with "v1"
+
+    Scenario: the audit log only lists kartusches the user has a role for
+        When I authenticate as "bob@example.com" using browser
+        Then the audit log should list "login" by "bob@example.com" with outcome "success"
+        And the audit log should not list "upload" of "test-project"
+        And the audit log should not list "login" by "alice@example.com"
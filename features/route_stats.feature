@@ -0,0 +1,34 @@
+Feature: route stats
+
+    Background:
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And the project has a handler for "/greet" responding with "hi"
+        And the project has a file "handler/fail/GET.js" containing "throw new Error('boom')"
+        And the project has a file "static/app.css" containing "body {}"
+        And I upload the kartusche
+
+    Scenario: counting requests of handlers and static files
+        When the kartusche should respond to "/greet" with "hi"
+        And the kartusche should respond to "/fail" with status 500
+        And the kartusche should respond to "/app.css" with "body {}"
+        Then the route stats of "GET /greet" should show 1 hit and 0 errors
+        And the route stats of "GET /fail" should show 1 hit and 1 error
+        And the route stats of "GET /app.css" should show 1 hit and 0 errors
+
+    Scenario: resetting the counters
+        Given the kartusche should respond to "/greet" with "hi"
+        When I reset the route stats
+        Then the route stats of "GET /greet" should show 0 hits and 0 errors
+
+    Scenario: counters survive code updates
+        Given the kartusche should respond to "/greet" with "hi"
+        When I add a handler for "/other" responding with "other" and update the code
+        Then the route stats of "GET /greet" should show 1 hit and 0 errors
+        And the route stats of "GET /other" should show 0 hits and 0 errors
+
+    Scenario: counters of removed routes are dropped
+        Given the kartusche should respond to "/greet" with "hi"
+        When I remove the handler for "/greet" and update the code
+        Then the route stats should not list "GET /greet"
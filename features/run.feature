@@ -0,0 +1,21 @@
+Feature: run
+
+    Scenario: serving a kartusche file over HTTPS
+        Given a kartusche file responding with "v1"
+        When I run the kartusche file with a TLS certificate
+        Then the running kartusche should respond with "v1"
+
+    Scenario: in-flight requests are drained on shutdown
+        Given a kartusche file with a handler for "/slow" responding with "done" after 1000ms
+        And I run the kartusche file
+        When I request "/slow" from the running kartusche
+        And I terminate the running kartusche
+        Then the request should have been answered with "done"
+        And the running kartusche should have exited cleanly
+
+    Scenario: running jobs are interrupted on shutdown
+        Given a kartusche file with a job running forever
+        And I run the kartusche file
+        When I start the job of the running kartusche
+        And I terminate the running kartusche
+        Then the running kartusche should have exited cleanly
@@ -0,0 +1,41 @@
+Feature: tokens
+
+    Background:
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And I upload the kartusche
+
+    Scenario: listing the tokens of the user
+        Then the tokens should list the current token
+
+    Scenario: logging out revokes the token
+        When I log out
+        Then the revoked token should be rejected
+
+    Scenario: logging out removes a revoked token
+        Given the stored token has been revoked
+        When I log out
+        Then the revoked token should be rejected
+
+    Scenario: logging out revokes a scoped token
+        Given I create a token allowed to "read"
+        And I store the created token
+        When I log out
+        Then the revoked token should be rejected
+
+    Scenario: scoped tokens can only be used for their actions
+        Given I create a token allowed to "update-code"
+        When I use the created token
+        And I change the response to "v2" and update the code
+        Then the kartusche should respond with "v2"
+        And removing the kartusche should be denied
+
+    Scenario: expired tokens are rejected
+        Given I create a token allowed to "read" expiring after "1s"
+        Then the created token should be accepted
+        And the created token should be rejected after it expires
+
+    Scenario: scoped tokens don't outlive tokens issued on login
+        Given I create a token allowed to "read" expiring after "100000h"
+        Then the created token should expire within "720h"
@@ -0,0 +1,22 @@
+Feature: trusted proxies
+
+    Scenario: forwarded addresses are used for requests from trusted proxies
+        Given the server is running with the trusted proxies "127.0.0.1"
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And I upload the kartusche
+        When I remove the kartusche through a proxy forwarding for "203.0.113.7"
+        Then the audit log should list "rm" from "203.0.113.7"
+
+    Scenario: forwarded addresses are ignored for requests from other clients
+        Given the server is running
+        And I authenticate the user using browser
+        And a kartusche project responding with "v1"
+        And I upload the kartusche
+        When I remove the kartusche through a proxy forwarding for "203.0.113.7"
+        Then the audit log should list "rm" from "127.0.0.1"
+        And the audit log should not list "rm" from "203.0.113.7"
+
+    Scenario: the rate limit can't be evaded with forwarded addresses
+        Given the server is running
+        Then starting 25 logins forwarded for different addresses should be rate limited
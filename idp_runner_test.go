@@ -0,0 +1,273 @@
+package main_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	idpClientID     = "kartusche"
+	idpClientSecret = "kartusche-secret"
+	idpRSAKeyID     = "rsa-key"
+	idpECKeyID      = "ec-key"
+)
+
+// runningIdP is a stand-in OpenID Connect identity provider.
+// It authenticates every authorization request as the configured user, without any interaction.
+type runningIdP struct {
+	url    string
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	alg    string
+	email  string
+	groups []string
+	codes  map[string]idpCode
+}
+
+type idpCode struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	email       string
+	groups      []string
+}
+
+func startIdP() (*runningIdP, error) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("while generating RSA key: %w", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("while generating EC key: %w", err)
+	}
+
+	idp := &runningIdP{
+		rsaKey: rsaKey,
+		ecKey:  ecKey,
+		alg:    "RS256",
+		codes:  map[string]idpCode{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+
+	idp.server = httptest.NewServer(mux)
+	idp.url = idp.server.URL
+
+	return idp, nil
+}
+
+func (idp *runningIdP) shutdown() {
+	idp.server.Close()
+}
+
+// authenticateAs sets the user the identity provider authenticates.
+func (idp *runningIdP) authenticateAs(email string, groups ...string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.email = email
+	idp.groups = groups
+}
+
+// signWith sets the algorithm the identity provider signs ID tokens with, one of RS256, PS256 or ES256.
+func (idp *runningIdP) signWith(alg string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.alg = alg
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (idp *runningIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 200, map[string]interface{}{
+		"issuer":                                idp.url,
+		"authorization_endpoint":                idp.url + "/authorize",
+		"token_endpoint":                        idp.url + "/token",
+		"jwks_uri":                              idp.url + "/jwks",
+		"code_challenge_methods_supported":      []string{"S256"},
+		"id_token_signing_alg_values_supported": []string{"RS256", "PS256", "ES256"},
+	})
+}
+
+func (idp *runningIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != idpClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", 400)
+		return
+	}
+
+	code := make([]byte, 16)
+	rand.Read(code)
+	c := base64.RawURLEncoding.EncodeToString(code)
+
+	idp.mu.Lock()
+	idp.codes[c] = idpCode{
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		redirectURI: q.Get("redirect_uri"),
+		email:       idp.email,
+		groups:      idp.groups,
+	}
+	idp.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	rq := url.Values{}
+	rq.Set("code", c)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+
+	http.Redirect(w, r, redirect.String(), 302)
+}
+
+func (idp *runningIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != idpClientID || clientSecret != idpClientSecret {
+		writeJSON(w, 401, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeJSON(w, 400, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	c, found := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	switch {
+	case !found,
+		r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("redirect_uri") != c.redirectURI,
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != c.challenge:
+		writeJSON(w, 400, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := idp.sign(map[string]interface{}{
+		"iss":            idp.url,
+		"sub":            c.email,
+		"aud":            idpClientID,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          c.nonce,
+		"email":          c.email,
+		"email_verified": true,
+		"groups":         c.groups,
+	})
+	if err != nil {
+		writeJSON(w, 500, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, 200, map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (idp *runningIdP) sign(claims map[string]interface{}) (string, error) {
+	idp.mu.Lock()
+	alg := idp.alg
+	idp.mu.Unlock()
+
+	kid := idpRSAKeyID
+	if alg == "ES256" {
+		kid = idpECKeyID
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:])
+	case "PS256":
+		signature, err = rsa.SignPSS(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	default:
+		err = fmt.Errorf("unsupported algorithm %s", alg)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (idp *runningIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 200, map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": idpRSAKeyID,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": idpECKeyID,
+				"use": "sig",
+				"alg": "ES256",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(idp.ecKey.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(idp.ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+		},
+	})
+}
@@ -4,17 +4,34 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cucumber/godog"
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/bolted/embedded"
+	"github.com/draganm/kartusche/common/build"
+	"github.com/draganm/kartusche/common/manifest"
+	"github.com/draganm/kartusche/config"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/draganm/kartusche/server"
 	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
 )
 
 func TestFeatures(t *testing.T) {
@@ -37,8 +54,120 @@ func TestFeatures(t *testing.T) {
 				panic(fmt.Errorf("while creating world: %w", err))
 			}
 			ctx.Step(`^the server is running$`, w.theServerIsRunning)
+			ctx.Step(`^starting the server with the mock provider without allowing it should fail$`, w.startingTheServerWithTheMockProviderWithoutAllowingItShouldFail)
+			ctx.Step(`^starting the server without an auth provider should fail$`, w.startingTheServerWithoutAnAuthProviderShouldFail)
 			ctx.Step(`^I authenticate the user using browser$`, w.iAuthenticateTheUserUsingBrowser)
 			ctx.Step(`^the user config should contain token for the server$`, w.theUserConfigShouldContainTokenForTheServer)
+			ctx.Step(`^a kartusche project responding with "([^"]*)"$`, w.aKartuscheProjectRespondingWith)
+			ctx.Step(`^I upload the kartusche$`, w.iUploadTheKartusche)
+			ctx.Step(`^I change the response to "([^"]*)" and update the code$`, w.iChangeTheResponseToAndUpdateTheCode)
+			ctx.Step(`^the kartusche should respond with "([^"]*)"$`, w.theKartuscheShouldRespondWith)
+			ctx.Step(`^I roll back the code to version (\d+)$`, w.iRollBackTheCodeToVersion)
+			ctx.Step(`^the kartusche should have (\d+) code versions$`, w.theKartuscheShouldHaveCodeVersions)
+			ctx.Step(`^I write "([^"]*)" to "([^"]*)" over WebDAV$`, w.iWriteToOverWebDAV)
+			ctx.Step(`^I change the response to "([^"]*)" with a develop patch$`, w.iChangeTheResponseToWithADevelopPatch)
+			ctx.Step(`^patching "([^"]*)" based on a stale version should be rejected$`, w.patchingBasedOnAStaleVersionShouldBeRejected)
+			ctx.Step(`^I change the response to "([^"]*)" and dry run the code update$`, w.iChangeTheResponseToAndDryRunTheCodeUpdate)
+			ctx.Step(`^the dry run should report "([^"]*)" as changed$`, w.theDryRunShouldReportAsChanged)
+			ctx.Step(`^I add a handler with a syntax error and dry run the code update$`, w.iAddAHandlerWithASyntaxErrorAndDryRunTheCodeUpdate)
+			ctx.Step(`^the dry run should report a compile error for "([^"]*)"$`, w.theDryRunShouldReportACompileErrorFor)
+			ctx.Step(`^I add a handler for "([^"]*)" responding with "([^"]*)" and update the code$`, w.iAddAHandlerForRespondingWithAndUpdateTheCode)
+			ctx.Step(`^the kartusche should respond to "([^"]*)" with "([^"]*)"$`, w.theKartuscheShouldRespondToWith)
+			ctx.Step(`^I remove the handler for "([^"]*)" and update the code$`, w.iRemoveTheHandlerForAndUpdateTheCode)
+			ctx.Step(`^the kartusche should respond to "([^"]*)" with status (\d+)$`, w.theKartuscheShouldRespondToWithStatus)
+			ctx.Step(`^I update the code$`, w.iUpdateTheCode)
+			ctx.Step(`^the project ignores "([^"]*)"$`, w.theProjectIgnores)
+			ctx.Step(`^the project has a file "([^"]*)" containing "([^"]*)"$`, w.theProjectHasAFileContaining)
+			ctx.Step(`^the project should have a file "([^"]*)"$`, w.theProjectShouldHaveAFile)
+			ctx.Step(`^the bundle of "([^"]*)" should contain "([^"]*)"$`, w.theBundleOfShouldContain)
+			ctx.Step(`^the project has a handler for "([^"]*)" responding with "([^"]*)"$`, w.theProjectHasAHandlerForRespondingWith)
+			ctx.Step(`^a local kartusche project$`, w.aLocalKartuscheProject)
+			ctx.Step(`^the development server is running$`, w.theDevelopmentServerIsRunning)
+			ctx.Step(`^the development server should respond to "([^"]*)" with the live reload script$`, w.theDevelopmentServerShouldRespondToWithTheLiveReloadScript)
+			ctx.Step(`^I am listening for live reload events$`, w.iAmListeningForLiveReloadEvents)
+			ctx.Step(`^I should receive a "([^"]*)" live reload event$`, w.iShouldReceiveALiveReloadEvent)
+			ctx.Step(`^the logs of the kartusche should contain "([^"]*)"$`, w.theLogsOfTheKartuscheShouldContain)
+			ctx.Step(`^I follow the logs of the kartusche$`, w.iFollowTheLogsOfTheKartusche)
+			ctx.Step(`^the followed logs should contain "([^"]*)"$`, w.theFollowedLogsShouldContain)
+			ctx.Step(`^I remove the kartusche$`, w.iRemoveTheKartusche)
+			ctx.Step(`^following the logs should have finished$`, w.followingTheLogsShouldHaveFinished)
+			ctx.Step(`^the server metrics should contain:$`, w.theServerMetricsShouldContain)
+			ctx.Step(`^the server is running with the metrics token "([^"]*)"$`, w.theServerIsRunningWithTheMetricsToken)
+			ctx.Step(`^getting the server metrics without the token should be refused$`, w.gettingTheServerMetricsWithoutTheTokenShouldBeRefused)
+			ctx.Step(`^the route stats of "([^"]*)" should show (\d+) hits? and (\d+) errors?$`, w.theRouteStatsOfShouldShowHitsAndErrors)
+			ctx.Step(`^the route stats should not list "([^"]*)"$`, w.theRouteStatsShouldNotList)
+			ctx.Step(`^I reset the route stats$`, w.iResetTheRouteStats)
+			ctx.Step(`^I post "([^"]*)" to "([^"]*)" of the kartusche$`, w.iPostToOfTheKartusche)
+			ctx.Step(`^the failures of the kartusche should list "([^"]*)"$`, w.theFailuresOfTheKartuscheShouldList)
+			ctx.Step(`^the last failure should have the code hash of version (\d+)$`, w.theLastFailureShouldHaveTheCodeHashOfVersion)
+			ctx.Step(`^the last failure should have the request body "([^"]*)"$`, w.theLastFailureShouldHaveTheRequestBody)
+			ctx.Step(`^the last failure should not have a request body$`, w.theLastFailureShouldNotHaveARequestBody)
+			ctx.Step(`^the header "([^"]*)" of the last failure should be redacted$`, w.theHeaderOfTheLastFailureShouldBeRedacted)
+			ctx.Step(`^I replay the last failure against the development server$`, w.iReplayTheLastFailureAgainstTheDevelopmentServer)
+			ctx.Step(`^the output should contain "([^"]*)"$`, w.theOutputShouldContain)
+			ctx.Step(`^the audit log should list "([^"]*)" by "([^"]*)" with outcome "([^"]*)"$`, w.theAuditLogShouldListByWithOutcome)
+			ctx.Step(`^the audit log should list "([^"]*)" of "([^"]*)" with outcome "([^"]*)"$`, w.theAuditLogShouldListOfWithOutcome)
+			ctx.Step(`^the audit log should not list "([^"]*)" (?:of|by|from) "([^"]*)"$`, w.theAuditLogShouldNotList)
+			ctx.Step(`^the audit log should list "([^"]*)" from "([^"]*)"$`, w.theAuditLogShouldListFrom)
+			ctx.Step(`^the server is running with the trusted proxies "([^"]*)"$`, w.theServerIsRunningWithTheTrustedProxies)
+			ctx.Step(`^I remove the kartusche through a proxy forwarding for "([^"]*)"$`, w.iRemoveTheKartuscheThroughAProxyForwardingFor)
+			ctx.Step(`^starting (\d+) logins forwarded for different addresses should be rate limited$`, w.startingLoginsForwardedForDifferentAddressesShouldBeRateLimited)
+			ctx.Step(`^I try to roll back the code to version (\d+)$`, w.iTryToRollBackTheCodeToVersion)
+			ctx.Step(`^I try to remove the kartusche with an invalid token$`, w.iTryToRemoveTheKartuscheWithAnInvalidToken)
+			ctx.Step(`^I authenticate as "([^"]*)" using browser$`, w.iAuthenticateAsUsingBrowser)
+			ctx.Step(`^I grant "([^"]*)" access to the kartusche$`, w.iGrantAccessToTheKartusche)
+			ctx.Step(`^updating the code should be denied$`, w.updatingTheCodeShouldBeDenied)
+			ctx.Step(`^the kartusche should not be listed$`, w.theKartuscheShouldNotBeListed)
+			ctx.Step(`^the kartusche was uploaded before ownership was recorded$`, w.theKartuscheWasUploadedBeforeOwnershipWasRecorded)
+			ctx.Step(`^the server is restarted$`, w.theServerIsRestarted)
+			ctx.Step(`^the server is restarted with the legacy owner "([^"]*)"$`, w.theServerIsRestartedWithTheLegacyOwner)
+			ctx.Step(`^the kartusche should not be accessible over WebDAV$`, w.theKartuscheShouldNotBeAccessibleOverWebDAV)
+			ctx.Step(`^I grant "([^"]*)" the "([^"]*)" role$`, w.iGrantTheRole)
+			ctx.Step(`^I revoke the access of "([^"]*)"$`, w.iRevokeTheAccessOf)
+			ctx.Step(`^the access list should show "([^"]*)" with role "([^"]*)"$`, w.theAccessListShouldShowWithRole)
+			ctx.Step(`^writing "([^"]*)" over WebDAV should be denied$`, w.writingOverWebDAVShouldBeDenied)
+			ctx.Step(`^removing the kartusche should be denied$`, w.removingTheKartuscheShouldBeDenied)
+			ctx.Step(`^uploading the kartusche should be denied$`, w.uploadingTheKartuscheShouldBeDenied)
+			ctx.Step(`^uploading the kartusche should fail with "([^"]*)"$`, w.uploadingTheKartuscheShouldFailWith)
+			ctx.Step(`^claiming the kartusche should fail with "([^"]*)"$`, w.claimingTheKartuscheShouldFailWith)
+			ctx.Step(`^the kartusche file should still be on the server$`, w.theKartuscheFileShouldStillBeOnTheServer)
+			ctx.Step(`^a kartusche file responding with "([^"]*)"$`, w.aKartuscheFileRespondingWith)
+			ctx.Step(`^a kartusche file with a handler for "([^"]*)" responding with "([^"]*)" after (\d+)ms$`, w.aKartuscheFileWithAHandlerForRespondingWithAfterMs)
+			ctx.Step(`^I run the kartusche file$`, w.iRunTheKartuscheFile)
+			ctx.Step(`^I run the kartusche file with a TLS certificate$`, w.iRunTheKartuscheFileWithATLSCertificate)
+			ctx.Step(`^the running kartusche should respond with "([^"]*)"$`, w.theRunningKartuscheShouldRespondWith)
+			ctx.Step(`^I request "([^"]*)" from the running kartusche$`, w.iRequestFromTheRunningKartusche)
+			ctx.Step(`^a kartusche file with a job running forever$`, w.aKartuscheFileWithAJobRunningForever)
+			ctx.Step(`^I start the job of the running kartusche$`, w.iStartTheJobOfTheRunningKartusche)
+			ctx.Step(`^I terminate the running kartusche$`, w.iTerminateTheRunningKartusche)
+			ctx.Step(`^the request should have been answered with "([^"]*)"$`, w.theRequestShouldHaveBeenAnsweredWith)
+			ctx.Step(`^the running kartusche should have exited cleanly$`, w.theRunningKartuscheShouldHaveExitedCleanly)
+			ctx.Step(`^an OIDC identity provider$`, w.anOIDCIdentityProvider)
+			ctx.Step(`^the identity provider signs ID tokens with "([^"]*)"$`, w.theIdentityProviderSignsIDTokensWith)
+			ctx.Step(`^the server is running with OIDC authentication allowing the group "([^"]*)"$`, w.theServerIsRunningWithOIDCAuthenticationAllowingTheGroup)
+			ctx.Step(`^the identity provider authenticates "([^"]*)" in the group "([^"]*)"$`, w.theIdentityProviderAuthenticatesInTheGroup)
+			ctx.Step(`^authenticating using browser should be denied$`, w.authenticatingUsingBrowserShouldBeDenied)
+			ctx.Step(`^the server is running with a login request ttl of "([^"]*)"$`, w.theServerIsRunningWithALoginRequestTtlOf)
+			ctx.Step(`^I start a login$`, w.iStartALogin)
+			ctx.Step(`^I complete the login in the browser$`, w.iCompleteTheLoginInTheBrowser)
+			ctx.Step(`^the user should have (\d+) tokens?$`, w.theUserShouldHaveTokens)
+			ctx.Step(`^requesting the access token should respond with "([^"]*)"$`, w.requestingTheAccessTokenShouldRespondWith)
+			ctx.Step(`^requesting the access token should fail with status (\d+)$`, w.requestingTheAccessTokenShouldFailWithStatus)
+			ctx.Step(`^the login request should expire$`, w.theLoginRequestShouldExpire)
+			ctx.Step(`^starting (\d+) logins should be rate limited$`, w.startingLoginsShouldBeRateLimited)
+			ctx.Step(`^opening the verification page (\d+) times should be rate limited$`, w.openingTheVerificationPageTimesShouldBeRateLimited)
+			ctx.Step(`^opening the verification page for the login request "([^"]*)" should fail with status (\d+)$`, w.openingTheVerificationPageForTheLoginRequestShouldFailWithStatus)
+			ctx.Step(`^the tokens should list the current token$`, w.theTokensShouldListTheCurrentToken)
+			ctx.Step(`^I log out$`, w.iLogOut)
+			ctx.Step(`^the revoked token should be rejected$`, w.theRevokedTokenShouldBeRejected)
+			ctx.Step(`^the stored token has been revoked$`, w.theStoredTokenHasBeenRevoked)
+			ctx.Step(`^I store the created token$`, w.iStoreTheCreatedToken)
+			ctx.Step(`^I create a token allowed to "([^"]*)"$`, w.iCreateATokenAllowedTo)
+			ctx.Step(`^I create a token allowed to "([^"]*)" expiring after "([^"]*)"$`, w.iCreateATokenAllowedToExpiringAfter)
+			ctx.Step(`^I use the created token$`, w.iUseTheCreatedToken)
+			ctx.Step(`^the created token should expire within "([^"]*)"$`, w.theCreatedTokenShouldExpireWithin)
+			ctx.Step(`^the created token should be accepted$`, w.theCreatedTokenShouldBeAccepted)
+			ctx.Step(`^the created token should be rejected after it expires$`, w.theCreatedTokenShouldBeRejectedAfterItExpires)
 			ctx.After(w.shutdown)
 		},
 		Options: &godog.Options{
@@ -56,9 +185,28 @@ func TestFeatures(t *testing.T) {
 }
 
 type world struct {
-	dir        string
-	binaryPath string
-	s          *runningServer
+	dir                   string
+	binaryPath            string
+	s                     *runningServer
+	dev                   *runningDevServer
+	liveReloadEvents      chan string
+	followedLogs          chan string
+	followingCLI          *runningCLI
+	metricsToken          string
+	projectDir            string
+	lastOutput            string
+	env                   map[string]string
+	createdToken          string
+	createdTokenExpiresAt time.Time
+	revokedToken          string
+	idp                   *runningIdP
+	loginRequestID        string
+	loginRequestTTL       time.Duration
+	kartuscheFile         string
+	running               *runningKartusche
+	runningScheme         string
+	runningResponses      chan string
+	exitCode              int
 }
 
 func newWorld(binaryPath string) (*world, error) {
@@ -81,7 +229,7 @@ func (w *world) cleanup() error {
 }
 
 func (w *world) theServerIsRunning() error {
-	rs, err := startServer()
+	rs, err := startServer(w.binaryPath)
 	if err != nil {
 		return fmt.Errorf("while starting server: %w", err)
 	}
@@ -89,7 +237,47 @@ func (w *world) theServerIsRunning() error {
 	return nil
 }
 
+func (w *world) startingTheServerWithTheMockProviderWithoutAllowingItShouldFail() error {
+	return w.startingTheServerShouldFailWith("--insecure-mock-auth", "AUTH_PROVIDER=mock", "INSECURE_MOCK_AUTH=false")
+}
+
+func (w *world) startingTheServerWithoutAnAuthProviderShouldFail() error {
+	return w.startingTheServerShouldFailWith("AUTH_PROVIDER must be set", "AUTH_PROVIDER=")
+}
+
+// startingTheServerShouldFailWith starts the server with env and expects it to exit with output containing expected.
+func (w *world) startingTheServerShouldFailWith(expected string, env ...string) error {
+	cmd := exec.Command(w.binaryPath, "server")
+	cmd.Env = append(
+		os.Environ(),
+		"CONTROLLER_ADDR=localhost:0",
+		"KARTUSCHES_ADDR=localhost:0",
+		fmt.Sprintf("WORK_DIR=%s", filepath.Join(w.dir, "server-work")),
+	)
+	cmd.Env = append(cmd.Env, env...)
+
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return errors.New("expected the server not to start")
+	}
+
+	if !strings.Contains(string(out), expected) {
+		return fmt.Errorf("expected the server to fail with %q, got %s", expected, out)
+	}
+
+	return nil
+}
+
 func (w *world) iAuthenticateTheUserUsingBrowser(ctx context.Context) error {
+	return w.authenticate("")
+}
+
+func (w *world) iAuthenticateAsUsingBrowser(email string) error {
+	return w.authenticate(email)
+}
+
+// authenticate logs in, as the given user if email is set.
+func (w *world) authenticate(email string) error {
 	runningCli, err := startCLI(
 		[]string{"auth", "login", w.s.serverURL},
 		map[string]string{},
@@ -111,6 +299,16 @@ func (w *world) iAuthenticateTheUserUsingBrowser(ctx context.Context) error {
 	line := scanner.Text()
 
 	au := strings.TrimPrefix(line, "Please complete authentication flow by visiting ")
+
+	u, err := url.Parse(au)
+	if err != nil {
+		return fmt.Errorf("while parsing auth url: %w", err)
+	}
+	w.loginRequestID = u.Query().Get("request_id")
+
+	if email != "" {
+		au += "&email=" + url.QueryEscape(email)
+	}
 	res, err := http.Get(au)
 	if err != nil {
 		return fmt.Errorf("while visiting auth url: %w", err)
@@ -153,11 +351,1671 @@ func (w *world) theUserConfigShouldContainTokenForTheServer() error {
 }
 
 func (w *world) shutdown(ctx context.Context, sc *godog.Scenario, err error) (context.Context, error) {
+	if w.idp != nil {
+		defer w.idp.shutdown()
+	}
+	if w.running != nil {
+		err = multierr.Append(err, w.running.shutdown())
+	}
 	if w.s != nil {
 		err = multierr.Append(err, w.s.shutdown())
 	}
+	if w.followingCLI != nil {
+		err = multierr.Append(err, w.followingCLI.cleanup())
+	}
+	if w.dev != nil {
+		err = multierr.Append(err, w.dev.shutdown())
+	}
 	err = multierr.Append(err, os.RemoveAll(w.dir))
 
 	return ctx, err
 
 }
+
+const projectName = "test-project"
+
+func (w *world) runCLIInProject(args ...string) (string, error) {
+	out, _, err := runCLIInDir(args, w.env, w.dir, w.projectDir, w.binaryPath)
+	return out, err
+}
+
+func (w *world) aKartuscheProjectRespondingWith(response string) error {
+	w.projectDir = filepath.Join(w.dir, projectName)
+	err := os.MkdirAll(filepath.Join(w.projectDir, "handler"), 0700)
+	if err != nil {
+		return err
+	}
+
+	cfg := &config.Config{
+		Name:          projectName,
+		DefaultRemote: "origin",
+		Remotes: map[string]string{
+			"origin": w.s.serverURL,
+		},
+	}
+
+	err = cfg.Write(w.projectDir)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(w.projectDir, "handler", "GET.js"), []byte(fmt.Sprintf("w.write(%q)", response)), 0700)
+}
+
+func (w *world) iUploadTheKartusche() error {
+	_, err := w.runCLIInProject("upload")
+	return err
+}
+
+func (w *world) iChangeTheResponseToAndUpdateTheCode(response string) error {
+	err := os.WriteFile(filepath.Join(w.projectDir, "handler", "GET.js"), []byte(fmt.Sprintf("w.write(%q)", response)), 0700)
+	if err != nil {
+		return err
+	}
+	_, err = w.runCLIInProject("update", "code")
+	return err
+}
+
+func (w *world) getFromKartusche(pth string) (int, string, error) {
+	req, err := http.NewRequest("GET", w.s.contentURL+pth, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Host = fmt.Sprintf("%s.127.0.0.1.nip.io", projectName)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+
+	defer res.Body.Close()
+
+	d, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return res.StatusCode, string(d), nil
+}
+
+func (w *world) theKartuscheShouldRespondWith(expected string) error {
+	return w.theKartuscheShouldRespondToWith("/", expected)
+}
+
+func (w *world) waitForKartuscheResponse(pth string, expectedStatus int, expected *string) error {
+	var lastResponse string
+	var lastStatus int
+	var err error
+
+	// kartusches are started asynchronously
+	for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(50 * time.Millisecond) {
+		lastStatus, lastResponse, err = w.getFromKartusche(pth)
+		if err != nil {
+			return err
+		}
+		if lastStatus == expectedStatus && (expected == nil || lastResponse == *expected) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected response for %s: %d %q", pth, lastStatus, lastResponse)
+}
+
+func (w *world) theKartuscheShouldRespondToWith(pth, expected string) error {
+	return w.waitForKartuscheResponse(pth, 200, &expected)
+}
+
+func (w *world) theKartuscheShouldRespondToWithStatus(pth string, status int) error {
+	return w.waitForKartuscheResponse(pth, status, nil)
+}
+
+func (w *world) theProjectHasAHandlerForRespondingWith(pth, response string) error {
+	dir := filepath.Join(w.projectDir, "handler", filepath.FromSlash(strings.TrimPrefix(pth, "/")))
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "GET.js"), []byte(fmt.Sprintf("w.write(%q)", response)), 0700)
+}
+
+func (w *world) iAddAHandlerForRespondingWithAndUpdateTheCode(pth, response string) error {
+	err := w.theProjectHasAHandlerForRespondingWith(pth, response)
+	if err != nil {
+		return err
+	}
+
+	return w.iUpdateTheCode()
+}
+
+func (w *world) theProjectHasAFileContaining(pth, content string) error {
+	fileName := filepath.Join(w.projectDir, filepath.FromSlash(pth))
+	err := os.MkdirAll(filepath.Dir(fileName), 0700)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, []byte(content), 0700)
+}
+
+func (w *world) theProjectShouldHaveAFile(name string) error {
+	_, err := os.Stat(filepath.Join(w.projectDir, filepath.FromSlash(name)))
+	return err
+}
+
+func (w *world) theBundleOfShouldContain(entrypoint, expected string) error {
+	mappingPath := "/" + manifest.DefaultBuildOutDir + "/" + build.MappingFileName
+
+	err := w.waitForKartuscheResponse(mappingPath, 200, nil)
+	if err != nil {
+		return err
+	}
+
+	_, mappingJSON, err := w.getFromKartusche(mappingPath)
+	if err != nil {
+		return err
+	}
+
+	mapping := map[string]build.Output{}
+	err = json.Unmarshal([]byte(mappingJSON), &mapping)
+	if err != nil {
+		return err
+	}
+
+	out, found := mapping[entrypoint]
+	if !found {
+		return fmt.Errorf("entrypoint %s not found in %s", entrypoint, mappingJSON)
+	}
+
+	status, bundle, err := w.getFromKartusche(out.File)
+	if err != nil {
+		return err
+	}
+
+	if status != 200 || !strings.Contains(bundle, expected) {
+		return fmt.Errorf("expected bundle %s to contain %q, got %d %q", out.File, expected, status, bundle)
+	}
+
+	return nil
+}
+
+func (w *world) theProjectIgnores(pattern string) error {
+	return os.WriteFile(filepath.Join(w.projectDir, ".kartuscheignore"), []byte(pattern+"\n"), 0700)
+}
+
+func (w *world) iRemoveTheHandlerForAndUpdateTheCode(pth string) error {
+	err := os.RemoveAll(filepath.Join(w.projectDir, "handler", filepath.FromSlash(strings.TrimPrefix(pth, "/"))))
+	if err != nil {
+		return err
+	}
+
+	return w.iUpdateTheCode()
+}
+
+func (w *world) iUpdateTheCode() error {
+	_, err := w.runCLIInProject("update", "code")
+	return err
+}
+
+func (w *world) iRollBackTheCodeToVersion(version int) error {
+	_, err := w.runCLIInProject("rollback", fmt.Sprintf("%d", version))
+	return err
+}
+
+func (w *world) theKartuscheShouldHaveCodeVersions(expected int) error {
+	out, err := w.runCLIInProject("versions")
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != expected {
+		return fmt.Errorf("expected %d versions, got:\n%s", expected, out)
+	}
+
+	return nil
+}
+
+func (w *world) iChangeTheResponseToAndDryRunTheCodeUpdate(response string) error {
+	err := os.WriteFile(filepath.Join(w.projectDir, "handler", "GET.js"), []byte(fmt.Sprintf("w.write(%q)", response)), 0700)
+	if err != nil {
+		return err
+	}
+	w.lastOutput, err = w.runCLIInProject("update", "code", "--dry-run")
+	return err
+}
+
+func (w *world) theDryRunShouldReportAsChanged(pth string) error {
+	if !strings.Contains(w.lastOutput, fmt.Sprintf("M %s\n", pth)) {
+		return fmt.Errorf("expected %s to be reported as changed:\n%s", pth, w.lastOutput)
+	}
+	return nil
+}
+
+func (w *world) iAddAHandlerWithASyntaxErrorAndDryRunTheCodeUpdate() error {
+	dir := filepath.Join(w.projectDir, "handler", "broken")
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "GET.js"), []byte("w.write("), 0700)
+	if err != nil {
+		return err
+	}
+
+	// the command is expected to fail because of the compile error
+	w.lastOutput, _ = w.runCLIInProject("update", "code", "--dry-run")
+	return nil
+}
+
+func (w *world) theDryRunShouldReportACompileErrorFor(pth string) error {
+	if !strings.Contains(w.lastOutput, fmt.Sprintf("compile errors:\n%s: ", pth)) {
+		return fmt.Errorf("expected compile error for %s:\n%s", pth, w.lastOutput)
+	}
+	return nil
+}
+
+func (w *world) aLocalKartuscheProject() error {
+	w.projectDir = filepath.Join(w.dir, projectName)
+	return os.MkdirAll(filepath.Join(w.projectDir, "handler"), 0700)
+}
+
+func (w *world) theDevelopmentServerIsRunning() error {
+	dev, err := startDevServer(w.binaryPath, w.dir, w.projectDir)
+	if err != nil {
+		return err
+	}
+	w.dev = dev
+	return nil
+}
+
+func (w *world) theDevelopmentServerShouldRespondToWithTheLiveReloadScript(pth string) error {
+	req, err := http.NewRequest("GET", w.dev.url+pth, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	d, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	expected := `<script src="/_kartusche/livereload.js"></script></body>`
+	if res.StatusCode != 200 || !strings.Contains(string(d), expected) {
+		return fmt.Errorf("expected response containing %q, got %d %q", expected, res.StatusCode, string(d))
+	}
+
+	return nil
+}
+
+func (w *world) iAmListeningForLiveReloadEvents(ctx context.Context) error {
+	req, err := http.NewRequest("GET", w.dev.url+"/_kartusche/livereload", nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != 200 {
+		res.Body.Close()
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	events := make(chan string, 20)
+	w.liveReloadEvents = events
+
+	go func() {
+		defer res.Body.Close()
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (w *world) iShouldReceiveALiveReloadEvent(expected string) error {
+	received := []string{}
+	timeout := time.NewTimer(5 * time.Second)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case ev := <-w.liveReloadEvents:
+			if ev == expected {
+				return nil
+			}
+			received = append(received, ev)
+		case <-timeout.C:
+			return fmt.Errorf("did not receive %q live reload event, received %v", expected, received)
+		}
+	}
+}
+
+func (w *world) theLogsOfTheKartuscheShouldContain(expected string) error {
+	out, err := w.runCLIInProject("logs")
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(out, expected) {
+		return fmt.Errorf("expected logs to contain %q, got %q", expected, out)
+	}
+
+	return nil
+}
+
+func (w *world) iFollowTheLogsOfTheKartusche() error {
+	runningCLI, err := startCLIInDir([]string{"logs", "-f"}, nil, w.dir, w.projectDir, w.binaryPath)
+	if err != nil {
+		return err
+	}
+
+	w.followingCLI = runningCLI
+
+	lines := make(chan string, 100)
+	w.followedLogs = lines
+
+	go func() {
+		scanner := bufio.NewScanner(runningCLI.output)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	return nil
+}
+
+func (w *world) theFollowedLogsShouldContain(expected string) error {
+	received := []string{}
+	timeout := time.NewTimer(5 * time.Second)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case line := <-w.followedLogs:
+			if strings.Contains(line, expected) {
+				return nil
+			}
+			received = append(received, line)
+		case <-timeout.C:
+			return fmt.Errorf("followed logs did not contain %q, got %v", expected, received)
+		}
+	}
+}
+
+func (w *world) iRemoveTheKartusche() error {
+	_, err := w.runCLIInProject("rm", projectName)
+	return err
+}
+
+func (w *world) followingTheLogsShouldHaveFinished() error {
+	return w.followingCLI.waitToFinish()
+}
+
+func (w *world) theServerIsRunningWithTheMetricsToken(token string) error {
+	rs, err := startServer(w.binaryPath, fmt.Sprintf("METRICS_TOKEN=%s", token))
+	if err != nil {
+		return fmt.Errorf("while starting server: %w", err)
+	}
+	w.s = rs
+	w.metricsToken = token
+	return nil
+}
+
+func (w *world) gettingTheServerMetricsWithoutTheTokenShouldBeRefused() error {
+	res, err := http.Get(w.s.serverURL + "/metrics")
+	if err != nil {
+		return fmt.Errorf("while getting metrics: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 401 {
+		return fmt.Errorf("expected status 401, got %s", res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) theServerMetricsShouldContain(expected *godog.DocString) error {
+	req, err := http.NewRequest("GET", w.s.serverURL+"/metrics", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.metricsToken)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("while getting metrics: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("while reading metrics: %w", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(expected.Content), "\n") {
+		if !strings.Contains(string(body), line) {
+			return fmt.Errorf("expected metrics to contain %q", line)
+		}
+	}
+
+	return nil
+}
+
+// routeStatsLine returns the fields of the `info routes` output line of the route, if listed.
+func (w *world) routeStatsLine(methodAndRoute string) ([]string, error) {
+	out, err := w.runCLIInProject("info", "routes", projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	method, route, _ := strings.Cut(methodAndRoute, " ")
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 5 && fields[1] == method && fields[2] == route {
+			return fields, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (w *world) theRouteStatsOfShouldShowHitsAndErrors(methodAndRoute string, hits, errors int) error {
+	fields, err := w.routeStatsLine(methodAndRoute)
+	if err != nil {
+		return err
+	}
+
+	if fields == nil {
+		return fmt.Errorf("route %q is not listed", methodAndRoute)
+	}
+
+	actual := fmt.Sprintf("%s hits, %s errors", fields[3], fields[4])
+	expected := fmt.Sprintf("%d hits, %d errors", hits, errors)
+	if actual != expected {
+		return fmt.Errorf("expected %s for %q, got %s", expected, methodAndRoute, actual)
+	}
+
+	return nil
+}
+
+func (w *world) theRouteStatsShouldNotList(methodAndRoute string) error {
+	fields, err := w.routeStatsLine(methodAndRoute)
+	if err != nil {
+		return err
+	}
+
+	if fields != nil {
+		return fmt.Errorf("route %q should not be listed", methodAndRoute)
+	}
+
+	return nil
+}
+
+func (w *world) iResetTheRouteStats() error {
+	_, err := w.runCLIInProject("info", "routes", "--reset", projectName)
+	return err
+}
+
+func (w *world) iPostToOfTheKartusche(body, pth string) error {
+	req, err := http.NewRequest("POST", w.s.contentURL+pth, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Host = fmt.Sprintf("%s.127.0.0.1.nip.io", projectName)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "secret")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// lastFailure gets the most recent failure of the kartusche.
+func (w *world) lastFailure() (*runtime.Failure, error) {
+	failures := []runtime.Failure{}
+	err := w.getServerJSON(path.Join("/kartusches", projectName, "failures"), &failures)
+	if err != nil {
+		return nil, fmt.Errorf("while listing failures: %w", err)
+	}
+
+	if len(failures) == 0 {
+		return nil, errors.New("no failures recorded")
+	}
+
+	f := &runtime.Failure{}
+	err = w.getServerJSON(path.Join("/kartusches", projectName, "failures", failures[0].ID), f)
+	if err != nil {
+		return nil, fmt.Errorf("while getting failure: %w", err)
+	}
+
+	return f, nil
+}
+
+func (w *world) getServerJSON(pth string, v interface{}) error {
+	res, err := w.callServer("GET", pth)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (w *world) theLastFailureShouldHaveTheRequestBody(expected string) error {
+	f, err := w.lastFailure()
+	if err != nil {
+		return err
+	}
+
+	if string(f.Body) != expected {
+		return fmt.Errorf("expected request body %q, got %q", expected, string(f.Body))
+	}
+
+	return nil
+}
+
+func (w *world) theLastFailureShouldNotHaveARequestBody() error {
+	f, err := w.lastFailure()
+	if err != nil {
+		return err
+	}
+
+	if len(f.Body) != 0 {
+		return fmt.Errorf("expected no request body, got %q", string(f.Body))
+	}
+
+	return nil
+}
+
+func (w *world) theHeaderOfTheLastFailureShouldBeRedacted(name string) error {
+	f, err := w.lastFailure()
+	if err != nil {
+		return err
+	}
+
+	if f.Header.Get(name) != runtime.Redacted {
+		return fmt.Errorf("expected header %s to be redacted, got %q", name, f.Header.Get(name))
+	}
+
+	return nil
+}
+
+func (w *world) theFailuresOfTheKartuscheShouldList(expected string) error {
+	out, err := w.runCLIInProject("failures", "ls")
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(out, expected) {
+		return fmt.Errorf("expected failures to contain %q, got %q", expected, out)
+	}
+
+	return nil
+}
+
+func (w *world) theLastFailureShouldHaveTheCodeHashOfVersion(version int) error {
+	failures := []runtime.Failure{}
+	err := w.getServerJSON(path.Join("/kartusches", projectName, "failures"), &failures)
+	if err != nil {
+		return fmt.Errorf("while listing failures: %w", err)
+	}
+
+	if len(failures) == 0 {
+		return errors.New("no failures recorded")
+	}
+
+	versions := []server.CodeVersion{}
+	err = w.getServerJSON(path.Join("/kartusches", projectName, "versions"), &versions)
+	if err != nil {
+		return fmt.Errorf("while listing versions: %w", err)
+	}
+
+	for _, v := range versions {
+		if v.Version != uint64(version) {
+			continue
+		}
+		if v.CodeHash == "" || v.CodeHash != failures[0].CodeHash {
+			return fmt.Errorf("expected failure code hash %q to be %q", failures[0].CodeHash, v.CodeHash)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("version %d not found", version)
+}
+
+func (w *world) iReplayTheLastFailureAgainstTheDevelopmentServer() error {
+	out, err := w.runCLIInProject("failures", "ls")
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 {
+		return fmt.Errorf("no failures recorded:\n%s", out)
+	}
+
+	id := strings.Fields(lines[1])[0]
+
+	w.lastOutput, err = w.runCLIInProject("failures", "replay", "--target", w.dev.url, id)
+	return err
+}
+
+func (w *world) theOutputShouldContain(expected string) error {
+	if !strings.Contains(w.lastOutput, expected) {
+		return fmt.Errorf("expected output to contain %q, got %q", expected, w.lastOutput)
+	}
+	return nil
+}
+
+// auditLogContains checks if the audit log has a line containing all the fields.
+func (w *world) auditLogContains(fields ...string) error {
+	found, out, err := w.auditLogLists(fields...)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("expected audit log to list %q, got:\n%s", fields, out)
+	}
+
+	return nil
+}
+
+// auditLogLists checks if an entry of the audit log contains all fields.
+func (w *world) auditLogLists(fields ...string) (bool, string, error) {
+	out, err := w.runCLIInProject("audit")
+	if err != nil {
+		return false, "", err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		matches := true
+		for _, f := range fields {
+			if !strings.Contains(line, f) {
+				matches = false
+			}
+		}
+		if matches {
+			return true, out, nil
+		}
+	}
+
+	return false, out, nil
+}
+
+func (w *world) theAuditLogShouldNotList(action, subject string) error {
+	found, out, err := w.auditLogLists(action, subject)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		return fmt.Errorf("expected audit log not to list %q of %q, got:\n%s", action, subject, out)
+	}
+
+	return nil
+}
+
+func (w *world) theAuditLogShouldListByWithOutcome(action, actor, outcome string) error {
+	return w.auditLogContains(action, actor, outcome)
+}
+
+func (w *world) theAuditLogShouldListOfWithOutcome(action, kartusche, outcome string) error {
+	return w.auditLogContains(action, kartusche, outcome)
+}
+
+func (w *world) iTryToRollBackTheCodeToVersion(version int) error {
+	_, err := w.runCLIInProject("rollback", fmt.Sprintf("%d", version))
+	if err == nil {
+		return fmt.Errorf("expected rollback to version %d to fail", version)
+	}
+	return nil
+}
+
+func (w *world) theServerIsRunningWithTheTrustedProxies(proxies string) error {
+	rs, err := startServer(w.binaryPath, fmt.Sprintf("TRUSTED_PROXIES=%s", proxies))
+	if err != nil {
+		return fmt.Errorf("while starting server: %w", err)
+	}
+	w.s = rs
+	return nil
+}
+
+func (w *world) iRemoveTheKartuscheThroughAProxyForwardingFor(addr string) error {
+	token, err := w.storedToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("DELETE", w.s.serverURL+"/kartusches/"+projectName, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Forwarded-For", addr)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 204 {
+		return fmt.Errorf("expected status 204, got %s", res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) theAuditLogShouldListFrom(action, addr string) error {
+	return w.auditLogContains(action, addr)
+}
+
+func (w *world) iTryToRemoveTheKartuscheWithAnInvalidToken() error {
+	res, err := w.callServerWithToken("DELETE", "/kartusches/"+projectName, "invalid")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 401 {
+		return fmt.Errorf("expected status 401, got %s", res.Status)
+	}
+
+	return nil
+}
+
+// callServer calls the server API with the token of the last authenticated user.
+func (w *world) callServer(method, pth string) (*http.Response, error) {
+	token, err := w.storedToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return w.callServerWithToken(method, pth, token)
+}
+
+func (w *world) callServerWithToken(method, pth, token string) (*http.Response, error) {
+	return w.callServerWithBody(method, pth, token, nil)
+}
+
+func (w *world) callServerWithBody(method, pth, token string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, w.s.serverURL+pth, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return http.DefaultClient.Do(req)
+}
+
+// storedToken returns the token of the server stored in the user config.
+func (w *world) storedToken() (string, error) {
+	d, err := os.ReadFile(filepath.Join(w.dir, "kartusche", "auth.yaml"))
+	if err != nil {
+		return "", err
+	}
+
+	tokens := map[string]string{}
+	err = yaml.Unmarshal(d, tokens)
+	if err != nil {
+		return "", err
+	}
+
+	return tokens[w.s.serverURL], nil
+}
+
+func (w *world) iGrantAccessToTheKartusche(user string) error {
+	return w.iGrantTheRole(user, "developer")
+}
+
+func (w *world) iGrantTheRole(user, role string) error {
+	_, err := w.runCLIInProject("access", "grant", "--role", role, user)
+	return err
+}
+
+func (w *world) iRevokeTheAccessOf(user string) error {
+	_, err := w.runCLIInProject("access", "revoke", user)
+	return err
+}
+
+func (w *world) theAccessListShouldShowWithRole(user, role string) error {
+	out, err := w.runCLIInProject("access", "ls")
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == user && fields[1] == role {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected %s to have role %s, got:\n%s", user, role, out)
+}
+
+func (w *world) iWriteToOverWebDAV(content, pth string) error {
+	token, err := w.storedToken()
+	if err != nil {
+		return err
+	}
+
+	res, err := w.callServerWithBody("PUT", "/dav/"+projectName+"/"+pth, token, strings.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("expected status 2xx, got %s", res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) writingOverWebDAVShouldBeDenied(pth string) error {
+	res, err := w.callServer("PUT", "/dav/"+projectName+"/"+pth)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 403 {
+		return fmt.Errorf("expected status 403, got %s", res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) removingTheKartuscheShouldBeDenied() error {
+	_, err := w.runCLIInProject("rm", projectName)
+	if err == nil {
+		return errors.New("expected removing the kartusche to fail")
+	}
+
+	if !strings.Contains(err.Error(), "403") {
+		return fmt.Errorf("expected removing the kartusche to be denied, got %w", err)
+	}
+
+	return nil
+}
+
+func (w *world) uploadingTheKartuscheShouldBeDenied() error {
+	_, err := w.runCLIInProject("upload")
+	if err == nil {
+		return errors.New("expected uploading the kartusche to fail")
+	}
+
+	if !strings.Contains(err.Error(), "403") {
+		return fmt.Errorf("expected uploading the kartusche to be denied, got %w", err)
+	}
+
+	return nil
+}
+
+func (w *world) uploadingTheKartuscheShouldFailWith(expected string) error {
+	_, err := w.runCLIInProject("upload")
+	if err == nil {
+		return errors.New("expected uploading the kartusche to fail")
+	}
+
+	if !strings.Contains(err.Error(), expected) {
+		return fmt.Errorf("expected uploading the kartusche to fail with %q, got %w", expected, err)
+	}
+
+	return nil
+}
+
+func (w *world) claimingTheKartuscheShouldFailWith(expected string) error {
+	_, err := w.runCLIInProject("access", "claim")
+	if err == nil {
+		return errors.New("expected claiming the kartusche to fail")
+	}
+
+	if !strings.Contains(err.Error(), expected) {
+		return fmt.Errorf("expected claiming the kartusche to fail with %q, got %w", expected, err)
+	}
+
+	return nil
+}
+
+func (w *world) theKartuscheFileShouldStillBeOnTheServer() error {
+	_, err := os.Stat(filepath.Join(w.s.workDir, "kartusches", projectName))
+	return err
+}
+
+func (w *world) updatingTheCodeShouldBeDenied() error {
+	err := os.WriteFile(filepath.Join(w.projectDir, "handler", "GET.js"), []byte(`w.write("denied")`), 0700)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.runCLIInProject("update", "code")
+	if err == nil {
+		return errors.New("expected code update to fail")
+	}
+
+	if !strings.Contains(err.Error(), "403") {
+		return fmt.Errorf("expected code update to be denied, got %w", err)
+	}
+
+	return nil
+}
+
+// theKartuscheWasUploadedBeforeOwnershipWasRecorded removes the owner of the kartusche from the state of the stopped server.
+func (w *world) theKartuscheWasUploadedBeforeOwnershipWasRecorded() error {
+	err := w.s.stop()
+	if err != nil {
+		return err
+	}
+
+	db, err := embedded.Open(filepath.Join(w.s.workDir, "state"), 0700, embedded.Options{})
+	if err != nil {
+		return fmt.Errorf("while opening state db: %w", err)
+	}
+
+	err = bolted.SugaredWrite(db, func(tx bolted.SugaredWriteTx) error {
+		kp := dbpath.ToPath("kartusches", projectName)
+		k := map[string]interface{}{}
+		err := json.Unmarshal(tx.Get(kp), &k)
+		if err != nil {
+			return err
+		}
+		delete(k, "owner")
+		d, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		tx.Put(kp, d)
+		return nil
+	})
+
+	return multierr.Append(err, db.Close())
+}
+
+func (w *world) theServerIsRestarted() error {
+	return w.restartServer()
+}
+
+func (w *world) theServerIsRestartedWithTheLegacyOwner(owner string) error {
+	return w.restartServer("LEGACY_OWNER=" + owner)
+}
+
+func (w *world) restartServer(env ...string) error {
+	rs, err := restartServer(w.binaryPath, w.s, env...)
+	if err != nil {
+		return err
+	}
+
+	w.s = rs
+	return nil
+}
+
+func (w *world) theKartuscheShouldNotBeListed() error {
+	out, err := w.runCLIInProject("ls", "origin")
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(out, projectName) {
+		return fmt.Errorf("expected %s not to be listed, got %q", projectName, out)
+	}
+
+	return nil
+}
+
+func (w *world) theKartuscheShouldNotBeAccessibleOverWebDAV() error {
+	res, err := w.callServer("PROPFIND", "/dav/"+projectName+"/")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 404 {
+		return fmt.Errorf("expected status 404, got %s", res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) theTokensShouldListTheCurrentToken() error {
+	out, err := w.runCLIInProject("auth", "tokens", "ls")
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(out, "(current)") {
+		return fmt.Errorf("expected the current token to be listed, got %q", out)
+	}
+
+	return nil
+}
+
+func (w *world) iLogOut() error {
+	token, err := w.storedToken()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = runCLI([]string{"auth", "logout", w.s.serverURL}, nil, w.dir, w.binaryPath)
+	if err != nil {
+		return err
+	}
+
+	w.revokedToken = token
+
+	stored, err := w.storedToken()
+	if err != nil {
+		return err
+	}
+
+	if stored != "" {
+		return errors.New("expected the token to be removed from the user config")
+	}
+
+	return nil
+}
+
+// expectStatus calls the server with the token and checks the status of the response.
+func (w *world) expectStatus(token, pth string, expected int) error {
+	res, err := w.callServerWithToken("GET", pth, token)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != expected {
+		return fmt.Errorf("expected status %d for %s, got %s", expected, pth, res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) theRevokedTokenShouldBeRejected() error {
+	return w.expectStatus(w.revokedToken, "/kartusches", 401)
+}
+
+func (w *world) theStoredTokenHasBeenRevoked() error {
+	token, err := w.storedToken()
+	if err != nil {
+		return err
+	}
+
+	res, err := w.callServerWithToken("DELETE", "/tokens/current", token)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 204 {
+		return fmt.Errorf("expected status 204, got %s", res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) iStoreTheCreatedToken() error {
+	d, err := yaml.Marshal(map[string]string{w.s.serverURL: w.createdToken})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(w.dir, "kartusche", "auth.yaml"), d, 0600)
+}
+
+func (w *world) iCreateATokenAllowedTo(action string) error {
+	return w.iCreateATokenAllowedToExpiringAfter(action, "1h")
+}
+
+func (w *world) iCreateATokenAllowedToExpiringAfter(action, ttl string) error {
+	out, err := w.runCLIInProject("auth", "tokens", "create", "--action", action, "--ttl", ttl)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	w.createdToken = lines[len(lines)-1]
+
+	_, expiresAt, _ := strings.Cut(lines[0], "expiring at ")
+	w.createdTokenExpiresAt, err = time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return fmt.Errorf("while parsing expiry of the created token: %w", err)
+	}
+
+	return nil
+}
+
+func (w *world) theCreatedTokenShouldExpireWithin(d string) error {
+	maxTTL, err := time.ParseDuration(d)
+	if err != nil {
+		return err
+	}
+
+	if time.Until(w.createdTokenExpiresAt) > maxTTL {
+		return fmt.Errorf("expected the created token to expire within %s, it expires at %s", d, w.createdTokenExpiresAt)
+	}
+
+	return nil
+}
+
+func (w *world) iUseTheCreatedToken() error {
+	w.env = map[string]string{
+		"KARTUSCHE_TOKEN": w.createdToken,
+	}
+	return nil
+}
+
+func (w *world) theCreatedTokenShouldBeAccepted() error {
+	return w.expectStatus(w.createdToken, "/kartusches/"+projectName+"/versions", 200)
+}
+
+func (w *world) theCreatedTokenShouldBeRejectedAfterItExpires() error {
+	time.Sleep(1100 * time.Millisecond)
+	return w.expectStatus(w.createdToken, "/kartusches/"+projectName+"/versions", 401)
+}
+
+func (w *world) anOIDCIdentityProvider() error {
+	idp, err := startIdP()
+	if err != nil {
+		return err
+	}
+	w.idp = idp
+	return nil
+}
+
+func (w *world) theServerIsRunningWithOIDCAuthenticationAllowingTheGroup(group string) error {
+	rs, err := startServer(
+		w.binaryPath,
+		"AUTH_PROVIDER=oidc",
+		fmt.Sprintf("OIDC_ISSUER_URL=%s", w.idp.url),
+		fmt.Sprintf("OIDC_CLIENT_ID=%s", idpClientID),
+		fmt.Sprintf("OIDC_CLIENT_SECRET=%s", idpClientSecret),
+		fmt.Sprintf("OIDC_ALLOWED_GROUPS=%s", group),
+	)
+	if err != nil {
+		return fmt.Errorf("while starting server: %w", err)
+	}
+	w.s = rs
+	return nil
+}
+
+func (w *world) theIdentityProviderSignsIDTokensWith(alg string) error {
+	w.idp.signWith(alg)
+	return nil
+}
+
+func (w *world) theIdentityProviderAuthenticatesInTheGroup(email, group string) error {
+	w.idp.authenticateAs(email, group)
+	return nil
+}
+
+func (w *world) authenticatingUsingBrowserShouldBeDenied() error {
+	err := w.authenticate("")
+	if err == nil {
+		return errors.New("expected authentication to fail")
+	}
+
+	if !strings.Contains(err.Error(), "403") {
+		return fmt.Errorf("expected authentication to be denied, got %w", err)
+	}
+
+	return nil
+}
+
+func (w *world) theServerIsRunningWithALoginRequestTtlOf(ttl string) (err error) {
+	w.loginRequestTTL, err = time.ParseDuration(ttl)
+	if err != nil {
+		return err
+	}
+
+	rs, err := startServer(w.binaryPath, fmt.Sprintf("LOGIN_REQUEST_TTL=%s", ttl))
+	if err != nil {
+		return fmt.Errorf("while starting server: %w", err)
+	}
+	w.s = rs
+	return nil
+}
+
+func (w *world) iStartALogin() error {
+	res, err := http.Post(w.s.serverURL+"/auth/login", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	lsr := map[string]string{}
+	err = json.NewDecoder(res.Body).Decode(&lsr)
+	if err != nil {
+		return err
+	}
+
+	w.loginRequestID = lsr["token_request_id"]
+
+	return nil
+}
+
+// iCompleteTheLoginInTheBrowser authenticates the last started login, without fetching the token.
+func (w *world) iCompleteTheLoginInTheBrowser() error {
+	res, err := http.Get(w.s.serverURL + "/auth/verify?request_id=" + url.QueryEscape(w.loginRequestID))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) theUserShouldHaveTokens(count int) error {
+	res, err := w.callServer("GET", "/tokens")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	tokens := []map[string]interface{}{}
+	err = json.NewDecoder(res.Body).Decode(&tokens)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) != count {
+		return fmt.Errorf("expected %d tokens, got %d", count, len(tokens))
+	}
+
+	return nil
+}
+
+// requestAccessToken polls the access token of the last login once.
+func (w *world) requestAccessToken() (*http.Response, error) {
+	body, err := json.Marshal(map[string]string{"token_request_id": w.loginRequestID})
+	if err != nil {
+		return nil, err
+	}
+
+	return http.Post(w.s.serverURL+"/auth/access_token", "application/json", bytes.NewReader(body))
+}
+
+func (w *world) requestingTheAccessTokenShouldRespondWith(expectedError string) error {
+	res, err := w.requestAccessToken()
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	atr := map[string]string{}
+	err = json.NewDecoder(res.Body).Decode(&atr)
+	if err != nil {
+		return err
+	}
+
+	if atr["error"] != expectedError {
+		return fmt.Errorf("expected error %q, got %q", expectedError, atr["error"])
+	}
+
+	return nil
+}
+
+func (w *world) theLoginRequestShouldExpire() error {
+	time.Sleep(w.loginRequestTTL + 100*time.Millisecond)
+	return w.requestingTheAccessTokenShouldRespondWith("expired_token")
+}
+
+func (w *world) requestingTheAccessTokenShouldFailWithStatus(status int) error {
+	res, err := w.requestAccessToken()
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != status {
+		return fmt.Errorf("expected status %d, got %s", status, res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) startingLoginsShouldBeRateLimited(count int) error {
+	return expectRateLimited(count, func() (*http.Response, error) {
+		return http.Post(w.s.serverURL+"/auth/login", "application/json", nil)
+	})
+}
+
+func (w *world) startingLoginsForwardedForDifferentAddressesShouldBeRateLimited(count int) error {
+	i := 0
+	return expectRateLimited(count, func() (*http.Response, error) {
+		i++
+		req, err := http.NewRequest("POST", w.s.serverURL+"/auth/login", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		return http.DefaultClient.Do(req)
+	})
+}
+
+func (w *world) openingTheVerificationPageForTheLoginRequestShouldFailWithStatus(requestID string, status int) error {
+	res, err := http.Get(w.s.serverURL + "/auth/verify?request_id=" + url.QueryEscape(requestID))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != status {
+		return fmt.Errorf("expected status %d, got %s", status, res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) openingTheVerificationPageTimesShouldBeRateLimited(count int) error {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return expectRateLimited(count, func() (*http.Response, error) {
+		return client.Get(w.s.serverURL + "/auth/verify?request_id=rate-limited")
+	})
+}
+
+// expectRateLimited sends up to count requests and expects one of them to be rate limited.
+func expectRateLimited(count int, send func() (*http.Response, error)) error {
+	for i := 0; i < count; i++ {
+		res, err := send()
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		if res.StatusCode == http.StatusTooManyRequests {
+			if res.Header.Get("Retry-After") == "" {
+				return errors.New("expected Retry-After header")
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected one of %d requests to be rate limited", count)
+}
+
+// writeKartuscheFile creates a kartusche file from the files, keyed by their path in the project.
+func (w *world) writeKartuscheFile(files map[string]string) error {
+	dir := filepath.Join(w.dir, "run-project")
+	for pth, code := range files {
+		fileName := filepath.Join(dir, filepath.FromSlash(pth))
+		err := os.MkdirAll(filepath.Dir(fileName), 0700)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(fileName, []byte(code), 0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.kartuscheFile = filepath.Join(w.dir, "run.kartusche")
+
+	return runtime.InitializeNew(w.kartuscheFile, dir)
+}
+
+func (w *world) aKartuscheFileRespondingWith(response string) error {
+	return w.writeKartuscheFile(map[string]string{
+		"handler/GET.js": fmt.Sprintf("w.write(%q)", response),
+	})
+}
+
+func (w *world) aKartuscheFileWithAHandlerForRespondingWithAfterMs(pth, response string, delay int) error {
+	return w.writeKartuscheFile(map[string]string{
+		path.Join("handler", pth, "GET.js"): fmt.Sprintf("log.info(%q); const until = Date.now() + %d; while (Date.now() < until) {}; w.write(%q)", "started "+pth, delay, response),
+	})
+}
+
+func (w *world) aKartuscheFileWithAJobRunningForever() error {
+	return w.writeKartuscheFile(map[string]string{
+		"handler/start/POST.js": `write(tx => scheduleJob("forever", {})); w.write("scheduled")`,
+		"jobs/forever.js":       `log.info("started job"); while (true) {}`,
+	})
+}
+
+func (w *world) iStartTheJobOfTheRunningKartusche() error {
+	res, err := runningClient.Post(w.running.url+"/start", "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return w.running.waitForOutput("started job")
+}
+
+func (w *world) iRunTheKartuscheFile() error {
+	rk, err := startRun(w.binaryPath, w.kartuscheFile, "http")
+	if err != nil {
+		return err
+	}
+	w.running = rk
+	return nil
+}
+
+func (w *world) iRunTheKartuscheFileWithATLSCertificate() error {
+	certFile, keyFile, err := writeSelfSignedCertificate(w.dir)
+	if err != nil {
+		return fmt.Errorf("while creating certificate: %w", err)
+	}
+
+	rk, err := startRun(w.binaryPath, w.kartuscheFile, "https", "--tls-cert-file", certFile, "--tls-key-file", keyFile)
+	if err != nil {
+		return err
+	}
+	w.running = rk
+	return nil
+}
+
+// runningClient trusts the self-signed certificate of the running kartusche.
+var runningClient = &http.Client{
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+func (w *world) getFromRunningKartusche(pth string) (string, error) {
+	res, err := runningClient.Get(w.running.url + pth)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	d, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("unexpected status %s: %s", res.Status, string(d))
+	}
+
+	return string(d), nil
+}
+
+func (w *world) theRunningKartuscheShouldRespondWith(expected string) error {
+	if !strings.HasPrefix(w.running.url, "https://") {
+		return fmt.Errorf("expected kartusche to be served over HTTPS, got %s", w.running.url)
+	}
+
+	body, err := w.getFromRunningKartusche("/")
+	if err != nil {
+		return err
+	}
+
+	if body != expected {
+		return fmt.Errorf("expected %q, got %q", expected, body)
+	}
+
+	return nil
+}
+
+func (w *world) iRequestFromTheRunningKartusche(pth string) error {
+	w.runningResponses = make(chan string, 1)
+	go func() {
+		body, err := w.getFromRunningKartusche(pth)
+		if err != nil {
+			body = err.Error()
+		}
+		w.runningResponses <- body
+	}()
+
+	// the request has to reach the handler before shutting down
+	return w.running.waitForOutput("started " + pth)
+}
+
+func (w *world) iTerminateTheRunningKartusche() error {
+	code, err := w.running.terminate()
+	if err != nil {
+		return err
+	}
+	w.exitCode = code
+	return nil
+}
+
+func (w *world) theRequestShouldHaveBeenAnsweredWith(expected string) error {
+	select {
+	case body := <-w.runningResponses:
+		if body != expected {
+			return fmt.Errorf("expected %q, got %q", expected, body)
+		}
+		return nil
+	case <-time.After(5 * time.Second):
+		return errors.New("request was not answered")
+	}
+}
+
+func (w *world) theRunningKartuscheShouldHaveExitedCleanly() error {
+	if w.exitCode != 0 {
+		return fmt.Errorf("expected exit code 0, got %d:\n%s", w.exitCode, w.running.output.String())
+	}
+
+	if !strings.Contains(w.running.output.String(), "shutting down") {
+		return fmt.Errorf("expected graceful shutdown:\n%s", w.running.output.String())
+	}
+
+	return nil
+}
+
+func (w *world) iChangeTheResponseToWithADevelopPatch(response string) error {
+	token, err := w.storedToken()
+	if err != nil {
+		return err
+	}
+
+	current, err := os.ReadFile(filepath.Join(w.projectDir, "handler", "GET.js"))
+	if err != nil {
+		return err
+	}
+
+	base := sha256.Sum256(current)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"files":   map[string][]byte{"handler/GET.js": []byte(fmt.Sprintf("w.write(%q)", response))},
+		"base":    map[string]string{"handler/GET.js": hex.EncodeToString(base[:])},
+		"develop": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := w.callServerWithBody("PATCH", "/kartusches/"+projectName+"/code/patch", token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 204 {
+		return fmt.Errorf("expected status 204, got %s", res.Status)
+	}
+
+	return nil
+}
+
+func (w *world) patchingBasedOnAStaleVersionShouldBeRejected(pth string) error {
+	token, err := w.storedToken()
+	if err != nil {
+		return err
+	}
+
+	stale := sha256.Sum256([]byte("stale"))
+
+	body, err := json.Marshal(map[string]interface{}{
+		"files": map[string][]byte{pth: []byte(`w.write("patched")`)},
+		"base":  map[string]string{pth: hex.EncodeToString(stale[:])},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := w.callServerWithBody("PATCH", "/kartusches/"+projectName+"/code/patch", token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 409 {
+		return fmt.Errorf("expected status 409, got %s", res.Status)
+	}
+
+	return nil
+}
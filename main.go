@@ -1,23 +1,38 @@
 package main
 
 import (
+	"github.com/draganm/kartusche/command/access"
+	"github.com/draganm/kartusche/command/audit"
 	"github.com/draganm/kartusche/command/auth"
+	"github.com/draganm/kartusche/command/bundle"
 	"github.com/draganm/kartusche/command/clone"
 	"github.com/draganm/kartusche/command/develop"
+	"github.com/draganm/kartusche/command/failures"
 	"github.com/draganm/kartusche/command/info"
 	initCmd "github.com/draganm/kartusche/command/init"
+	"github.com/draganm/kartusche/command/logs"
 	"github.com/draganm/kartusche/command/ls"
 	"github.com/draganm/kartusche/command/remote"
 	"github.com/draganm/kartusche/command/rm"
+	"github.com/draganm/kartusche/command/rollback"
+	"github.com/draganm/kartusche/command/run"
 	"github.com/draganm/kartusche/command/server"
 	"github.com/draganm/kartusche/command/test"
 	"github.com/draganm/kartusche/command/update"
 	"github.com/draganm/kartusche/command/upload"
+	"github.com/draganm/kartusche/command/versions"
+	commonBundle "github.com/draganm/kartusche/common/bundle"
 	"github.com/urfave/cli/v2"
 )
 
 func main() {
 
+	b, err := commonBundle.OpenSelf()
+	if err == nil {
+		bundle.RunBundled(b)
+		return
+	}
+
 	app := &cli.App{
 		Commands: []*cli.Command{
 			test.Command,
@@ -32,6 +47,14 @@ func main() {
 			clone.Command,
 			info.Command,
 			remote.Command,
+			run.Command,
+			bundle.Command,
+			versions.Command,
+			rollback.Command,
+			logs.Command,
+			failures.Command,
+			audit.Command,
+			access.Command,
 		},
 	}
 	app.RunAndExitOnError()
@@ -0,0 +1,171 @@
+package main_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runningKartusche is a kartusche file served by the run command.
+type runningKartusche struct {
+	url             string
+	cmd             *exec.Cmd
+	output          *syncBuffer
+	processDoneChan chan struct{}
+	exitCode        int
+}
+
+func startRun(binaryPath, kartuscheFile, scheme string, args ...string) (*runningKartusche, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("while finding a free port: %w", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cmd := exec.Command(binaryPath, append([]string{"run", "--addr", addr}, append(args, kartuscheFile)...)...)
+
+	output := &syncBuffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("while starting run: %w", err)
+	}
+
+	rk := &runningKartusche{
+		url:             fmt.Sprintf("%s://%s", scheme, addr),
+		cmd:             cmd,
+		output:          output,
+		processDoneChan: make(chan struct{}),
+	}
+
+	go func() {
+		st, err := cmd.Process.Wait()
+		if err != nil {
+			fmt.Println(fmt.Errorf("while waiting for the process: %w", err))
+			return
+		}
+		rk.exitCode = st.ExitCode()
+		close(rk.processDoneChan)
+	}()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(50 * time.Millisecond) {
+		select {
+		case <-rk.processDoneChan:
+			return nil, fmt.Errorf("run has died before properly starting:\n%s\n", output.String())
+		default:
+		}
+
+		if strings.Contains(output.String(), "listening for HTTP requests") {
+			return rk, nil
+		}
+	}
+
+	rk.shutdown()
+
+	return nil, fmt.Errorf("run did not start within 5 seconds:\n%s\n", output.String())
+}
+
+// waitForOutput waits until the output of run contains s.
+func (rk *runningKartusche) waitForOutput(s string) error {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if strings.Contains(rk.output.String(), s) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected output to contain %q within 5 seconds:\n%s", s, rk.output.String())
+}
+
+// terminate sends SIGTERM and waits for the exit code.
+func (rk *runningKartusche) terminate() (int, error) {
+	err := rk.cmd.Process.Signal(syscall.SIGTERM)
+	if err != nil {
+		return 0, fmt.Errorf("while sending SIGTERM: %w", err)
+	}
+
+	select {
+	case <-rk.processDoneChan:
+		return rk.exitCode, nil
+	case <-time.After(5 * time.Second):
+		return 0, fmt.Errorf("run did not exit within 5 seconds:\n%s\n", rk.output.String())
+	}
+}
+
+func (rk *runningKartusche) shutdown() error {
+	select {
+	case <-rk.processDoneChan:
+		// all good, run has exited
+		return nil
+	default:
+	}
+
+	err := rk.cmd.Process.Kill()
+	if err != nil {
+		return fmt.Errorf("while killing process: %w", err)
+	}
+
+	select {
+	case <-time.After(3 * time.Second):
+		return fmt.Errorf("timed out while shutting down run")
+	case <-rk.processDoneChan:
+		return nil
+	}
+}
+
+// writeSelfSignedCertificate writes a certificate for 127.0.0.1 and its key to dir.
+func writeSelfSignedCertificate(dir string) (certFile, keyFile string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		return "", "", err
+	}
+
+	return certFile, keyFile, nil
+}
@@ -0,0 +1,122 @@
+package runtime
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/cbroglie/mustache"
+	"github.com/dop251/goja"
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/manifest"
+	"github.com/draganm/kartusche/runtime/cronjobs"
+	"github.com/draganm/kartusche/runtime/jslib"
+)
+
+type CompileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+var errCheckRollback = errors.New("rolling back check transaction")
+
+func (r *runtime) Check(fn func(tx bolted.SugaredWriteTx) error) ([]CompileError, error) {
+	var compileErrors []CompileError
+	err := bolted.SugaredWrite(r.db, func(tx bolted.SugaredWriteTx) error {
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+		compileErrors = checkCode(tx)
+		return errCheckRollback
+	})
+
+	if err != nil && !errors.Is(err, errCheckRollback) {
+		return nil, err
+	}
+
+	return compileErrors, nil
+}
+
+// checkCode validates the manifest, compiles handlers, libs, cronjobs, jobs, init.js and templates
+// and returns all compile errors found.
+func checkCode(tx bolted.SugaredReadTx) []CompileError {
+	compileErrors := []CompileError{}
+
+	addError := func(p dbpath.Path, err error) {
+		compileErrors = append(compileErrors, CompileError{
+			Path:  path.Join(p...),
+			Error: err.Error(),
+		})
+	}
+
+	checkJS := func(p dbpath.Path, src []byte) {
+		if !strings.HasSuffix(p[len(p)-1], ".js") {
+			return
+		}
+		_, err := goja.Compile(p.String(), string(src), false)
+		if err != nil {
+			addError(p, err)
+		}
+	}
+
+	m, err := manifest.FromTx(tx)
+	if err != nil {
+		addError(manifest.Path, err)
+		m = &manifest.Manifest{}
+	}
+
+	forEachFile(tx, dbpath.ToPath("handler"), checkJS)
+	forEachFile(tx, dbpath.ToPath("jobs"), checkJS)
+
+	forEachFile(tx, dbpath.ToPath("lib"), func(p dbpath.Path, src []byte) {
+		_, err := jslib.Compile(p, string(src))
+		if err != nil {
+			addError(p, err)
+		}
+	})
+
+	forEachFile(tx, dbpath.ToPath("cronjobs"), func(p dbpath.Path, src []byte) {
+		name := p[len(p)-1]
+		_, _, err := cronjobs.ParseCronjob(name, string(src), m.Cronjobs[strings.TrimSuffix(name, ".js")])
+		if err != nil {
+			addError(p, err)
+		}
+	})
+
+	forEachFile(tx, dbpath.ToPath("templates"), func(p dbpath.Path, src []byte) {
+		_, err := mustache.ParseString(string(src))
+		if err != nil {
+			addError(p, err)
+		}
+	})
+
+	initPath := dbpath.ToPath("init.js")
+	if tx.Exists(initPath) && !tx.IsMap(initPath) {
+		checkJS(initPath, tx.Get(initPath))
+	}
+
+	return compileErrors
+}
+
+func forEachFile(tx bolted.SugaredReadTx, root dbpath.Path, fn func(p dbpath.Path, data []byte)) {
+	if !tx.Exists(root) || !tx.IsMap(root) {
+		return
+	}
+
+	toDo := []dbpath.Path{root}
+
+	for len(toDo) > 0 {
+		current := toDo[0]
+		toDo = toDo[1:]
+		for it := tx.Iterator(current); !it.IsDone(); it.Next() {
+			fullPath := current.Append(it.GetKey())
+			if tx.IsMap(fullPath) {
+				toDo = append(toDo, fullPath)
+				continue
+			}
+			fn(fullPath, it.GetValue())
+		}
+	}
+}
@@ -1,32 +1,38 @@
 package cronjobs
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/manifest"
 	"github.com/draganm/kartusche/runtime/jslib"
+	"github.com/draganm/kartusche/runtime/metrics"
 	"github.com/draganm/kartusche/runtime/stdlib"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/go-logr/logr"
 	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var cronjobsPath = dbpath.ToPath("cronjobs")
 var scheduleRegExp = regexp.MustCompile(`^\s*(#|\/\/)\s+(.+)$`)
 
-func CreateCron(tx bolted.SugaredReadTx, jslib *jslib.Libs, db bolted.Database, logger logr.Logger) (*cron.Cron, error) {
+var parser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+func CreateCron(tx bolted.SugaredReadTx, jslib *jslib.Libs, db bolted.Database, m *manifest.Manifest, km *metrics.Kartusche, t *tracing.Tracer, logger logr.Logger) (*cron.Cron, error) {
 
 	cr := cron.New(
 		// cron.WithLogger(cronLogger),
 		cron.WithSeconds(),
-		cron.WithParser(
-			cron.NewParser(
-				cron.SecondOptional|cron.Minute|cron.Hour|cron.Dom|cron.Month|cron.Dow|cron.Descriptor,
-			),
-		),
+		cron.WithParser(parser),
 		cron.WithChain(
 			cron.Recover(logger),
 		),
@@ -37,39 +43,74 @@ func CreateCron(tx bolted.SugaredReadTx, jslib *jslib.Libs, db bolted.Database,
 	}
 
 	for it := tx.Iterator(cronjobsPath); !it.IsDone(); it.Next() {
-		if !strings.HasSuffix(it.GetKey(), ".js") {
-			return nil, fmt.Errorf("non js file found in 'cronjobs': %s", it.GetKey())
+		name := it.GetKey()
+		schedule, prg, err := ParseCronjob(name, string(it.GetValue()), m.Cronjobs[strings.TrimSuffix(name, ".js")])
+		if err != nil {
+			return nil, err
 		}
 
-		src := string(it.GetValue())
+		cronName := strings.TrimSuffix(name, ".js")
+		cronLogger := logger.WithValues("cron", cronName)
+
+		cr.AddFunc(schedule, func() {
+			start := time.Now()
 
+			ctx, span := t.Start(context.Background(), "cron "+cronName, trace.SpanKindInternal)
+
+			vm := goja.New()
+			stdlib.SetStandardLibMethods(ctx, vm, jslib, db, cronjobsPath, m.Env, cronLogger)
+
+			if m.Timeouts.Cronjob > 0 {
+				t := time.AfterFunc(m.Timeouts.Cronjob, func() {
+					vm.Interrupt(fmt.Errorf("cron did not finish within %s", m.Timeouts.Cronjob))
+				})
+				defer t.Stop()
+			}
+
+			_, err := vm.RunProgram(prg)
+			if err != nil {
+				cronLogger.Error(err, "failed to execute cron")
+			}
+
+			km.ObserveCron(cronName, err, time.Since(start))
+			tracing.End(span, err)
+		})
+	}
+
+	return cr, nil
+
+}
+
+// ParseCronjob compiles the cronjob.
+// If schedule is empty, it is extracted from the first line of the cronjob.
+func ParseCronjob(name, src, schedule string) (string, *goja.Program, error) {
+	if !strings.HasSuffix(name, ".js") {
+		return "", nil, fmt.Errorf("non js file found in 'cronjobs': %s", name)
+	}
+
+	if schedule == "" {
 		lines := strings.Split(src, "\n")
 		if len(lines) < 1 {
-			return nil, fmt.Errorf("could not find schedule for cron %s", it.GetKey())
+			return "", nil, fmt.Errorf("could not find schedule for cron %s", name)
 		}
 
 		matches := scheduleRegExp.FindStringSubmatch(lines[0])
 		if len(matches) == 0 {
-			return nil, fmt.Errorf("could not find schedule for cron %s", it.GetKey())
-		}
-
-		prg, err := goja.Compile(it.GetKey(), src, true)
-
-		if err != nil {
-			return nil, fmt.Errorf("while compiling cronjob %s: %w", it.GetKey(), err)
+			return "", nil, fmt.Errorf("could not find schedule for cron %s", name)
 		}
 
-		cr.AddFunc(matches[2], func() {
+		schedule = matches[2]
+	}
 
-			vm := goja.New()
-			stdlib.SetStandardLibMethods(vm, jslib, db, cronjobsPath, logger)
-			_, err = vm.RunProgram(prg)
-			if err != nil {
-				logger.Error(err, "failed to execute cron", "cron", it.GetKey())
-			}
-		})
+	_, err := parser.Parse(schedule)
+	if err != nil {
+		return "", nil, fmt.Errorf("while parsing schedule of cronjob %s: %w", name, err)
 	}
 
-	return cr, nil
+	prg, err := goja.Compile(name, src, true)
+	if err != nil {
+		return "", nil, fmt.Errorf("while compiling cronjob %s: %w", name, err)
+	}
 
+	return schedule, prg, nil
 }
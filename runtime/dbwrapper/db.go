@@ -1,27 +1,36 @@
 package dbwrapper
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
 	"github.com/dop251/goja"
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/multierr"
 )
 
 type DB struct {
+	ctx    context.Context
 	db     bolted.Database
 	vm     *goja.Runtime
 	logger logr.Logger
 }
 
-func New(db bolted.Database, vm *goja.Runtime, logger logr.Logger) *DB {
-	return &DB{db: db, vm: vm}
+func New(ctx context.Context, db bolted.Database, vm *goja.Runtime, logger logr.Logger) *DB {
+	return &DB{ctx: ctx, db: db, vm: vm}
 }
 
 func (db *DB) Read(f func(*readTxWrapper) (interface{}, error)) (res interface{}, err error) {
+	_, span := tracing.Start(db.ctx, "db read", trace.SpanKindInternal)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	tx, err := db.db.BeginRead()
 	if err != nil {
 		return nil, fmt.Errorf("while beginning read tx: %w", err)
@@ -147,6 +156,11 @@ func (i *iteratorWrapper) GetValue() (string, error) {
 }
 
 func (db *DB) Write(f func(*WriteTxWrapper) (interface{}, error)) (res interface{}, err error) {
+	ctx, span := tracing.Start(db.ctx, "db write", trace.SpanKindInternal)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	tx, err := db.db.BeginWrite()
 	if err != nil {
 		return nil, fmt.Errorf("while beginning write tx: %w", err)
@@ -154,7 +168,7 @@ func (db *DB) Write(f func(*WriteTxWrapper) (interface{}, error)) (res interface
 
 	wtxw := &WriteTxWrapper{WriteTx: tx, VM: db.vm}
 
-	db.vm.GlobalObject().Set("scheduleJob", ScheduleJob(wtxw))
+	db.vm.GlobalObject().Set("scheduleJob", ScheduleJob(ctx, wtxw))
 
 	defer func() {
 		db.vm.GlobalObject().Delete("scheduleJob")
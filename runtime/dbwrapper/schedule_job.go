@@ -1,17 +1,20 @@
 package dbwrapper
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/gofrs/uuid"
 )
 
 var jobsDefinitionsPath = dbpath.ToPath("jobs")
 var jobQueuePath = dbpath.ToPath("job-queue")
 
-func ScheduleJob(txw *WriteTxWrapper) func(name string, params interface{}) error {
+// ScheduleJob schedules a job, the job run is a part of the trace of the span in ctx.
+func ScheduleJob(ctx context.Context, txw *WriteTxWrapper) func(name string, params interface{}) error {
 	return func(name string, params interface{}) error {
 
 		tx := txw.WriteTx
@@ -82,6 +85,12 @@ func ScheduleJob(txw *WriteTxWrapper) func(name string, params interface{}) erro
 		tx.CreateMap(scheduledJobPath)
 		tx.Put(scheduledJobPath.Append("name"), []byte(name))
 		tx.Put(scheduledJobPath.Append("params"), pd)
+
+		traceparent := tracing.Traceparent(ctx)
+		if traceparent != "" {
+			tx.Put(scheduledJobPath.Append("traceparent"), []byte(traceparent))
+		}
+
 		return nil
 
 	}
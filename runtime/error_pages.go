@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/manifest"
+)
+
+// notFoundHandlerName is the name of the handler in the root of `handler`
+// responding to requests not matching any route.
+const notFoundHandlerName = "_404.js"
+
+var staticPath = dbpath.ToPath("static")
+
+type errorPage struct {
+	contentType string
+	content     []byte
+}
+
+func (p *errorPage) write(w http.ResponseWriter, code int) {
+	w.Header().Set("content-type", p.contentType)
+	w.WriteHeader(code)
+	w.Write(p.content)
+}
+
+// errorPages are the optional `404.html` and `500.html` static files.
+type errorPages struct {
+	notFoundPage      *errorPage
+	internalErrorPage *errorPage
+}
+
+func loadErrorPages(tx bolted.SugaredReadTx) *errorPages {
+	load := func(name string) *errorPage {
+		p := staticPath.Append(name)
+		if !tx.Exists(p) || tx.IsMap(p) {
+			return nil
+		}
+		return &errorPage{
+			contentType: mime.TypeByExtension(".html"),
+			content:     tx.Get(p),
+		}
+	}
+
+	return &errorPages{
+		notFoundPage:      load("404.html"),
+		internalErrorPage: load("500.html"),
+	}
+}
+
+func (p *errorPages) notFound(w http.ResponseWriter, r *http.Request) {
+	if p.notFoundPage == nil {
+		http.NotFound(w, r)
+		return
+	}
+	p.notFoundPage.write(w, http.StatusNotFound)
+}
+
+// internalError responds without revealing details of the error.
+// The request id allows finding the error in the logs.
+func (p *errorPages) internalError(w http.ResponseWriter, r *http.Request) {
+	if p.internalErrorPage == nil {
+		http.Error(w, fmt.Sprintf("Internal Server Error\nRequest ID: %s", r.Header.Get(requestIDHeader)), http.StatusInternalServerError)
+		return
+	}
+	p.internalErrorPage.write(w, http.StatusInternalServerError)
+}
+
+// notFoundHandler responds to requests not matching any route.
+// In SPA mode, GET requests accepting HTML are responded with the SPA index.
+// Otherwise `handler/_404.js` or the `404.html` static file are used, if present.
+func notFoundHandler(tx bolted.SugaredReadTx, db bolted.Database, m *manifest.Manifest, notFoundJS http.Handler, pages *errorPages) (http.Handler, error) {
+	var spa http.Handler
+	if m.SPA != nil {
+		var err error
+		spa, err = spaHandler(tx, db, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if spa != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) && acceptsHTML(r) {
+			spa.ServeHTTP(w, r)
+			return
+		}
+
+		if notFoundJS != nil {
+			notFoundJS.ServeHTTP(&defaultStatusWriter{ResponseWriter: w, status: http.StatusNotFound}, r)
+			return
+		}
+
+		pages.notFound(w, r)
+	}), nil
+}
+
+func spaHandler(tx bolted.SugaredReadTx, db bolted.Database, m *manifest.Manifest) (http.Handler, error) {
+	index := m.SPA.Index
+	indexPath := staticPath.Append(strings.Split(strings.Trim(index, "/"), "/")...)
+	if !tx.Exists(indexPath) || tx.IsMap(indexPath) {
+		return nil, fmt.Errorf("spa index %s does not exist in static", index)
+	}
+
+	handler, err := staticContentHandler(tx, db, path.Join(indexPath[1:]...), m.Static)
+	if err != nil {
+		return nil, fmt.Errorf("while creating spa handler: %w", err)
+	}
+
+	return handler, nil
+}
+
+func acceptsHTML(r *http.Request) bool {
+	for _, v := range r.Header.Values("accept") {
+		if strings.Contains(v, "text/html") {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultStatusWriter responds with status unless the handler sets a different one.
+type defaultStatusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *defaultStatusWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *defaultStatusWriter) Write(d []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(d)
+}
@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	_ "embed"
 
@@ -16,20 +17,31 @@ import (
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
 	"github.com/draganm/bolted/embedded"
+	"github.com/draganm/kartusche/common/manifest"
 	"github.com/draganm/kartusche/runtime/cronjobs"
 	"github.com/draganm/kartusche/runtime/dbwrapper"
 	"github.com/draganm/kartusche/runtime/jobs"
 	"github.com/draganm/kartusche/runtime/jslib"
+	"github.com/draganm/kartusche/runtime/logring"
 	"github.com/draganm/kartusche/runtime/stdlib"
 	"github.com/draganm/kartusche/runtime/template"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/multierr"
 )
 
 const maxJobHistorySize = 100
 
+// DefaultShutdownTimeout is the time Shutdown waits for running cron jobs and jobs, unless set WithShutdownTimeout.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// unmatchedRoute is the route of requests not matching any handler or static file.
+const unmatchedRoute = "unmatched"
+
 type Runtime interface {
 	http.Handler
 	Shutdown() error
@@ -41,26 +53,66 @@ type Runtime interface {
 	Write(func(tx bolted.SugaredWriteTx) error) error
 	Read(func(tx bolted.SugaredReadTx) error) error
 	GetDBStats() (*DBStats, error)
+
+	// Check applies fn in a transaction that is always rolled back
+	// and returns compile errors of the resulting code.
+	// The running code is not affected.
+	Check(fn func(tx bolted.SugaredWriteTx) error) ([]CompileError, error)
+
+	// Logs returns the most recent log entries of the kartusche.
+	Logs() *logring.Ring
+
+	// RouteStats returns the request counters of all handlers and static files.
+	// Counters of routes survive code updates as long as the route exists.
+	RouteStats() []RouteStats
+	ResetRouteStats()
 }
 
 type runtime struct {
-	db     bolted.Database
-	r      *mux.Router
-	mu     *sync.Mutex
-	cron   *cron.Cron
-	logger logr.Logger
-	ctx    context.Context
-	cancel func()
+	db            bolted.Database
+	r             *mux.Router
+	manifest      *manifest.Manifest
+	mu            *sync.Mutex
+	cron          *cron.Cron
+	logger        logr.Logger
+	ctx           context.Context
+	cancel        func()
+	schedulerDone chan struct{}
+	opts          options
+	logs          *logring.Ring
+	routeStats    *routeStats
 }
 
+// logRingSize is the number of log entries retained by the runtime.
+const logRingSize = 1000
+
 func (r *runtime) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.mu.Lock()
 	rt := r.r
+	m := r.manifest
 	r.mu.Unlock()
 
+	ensureRequestID(w, req)
+
+	for k, v := range m.HeadersFor(req.URL.Path) {
+		w.Header().Set(k, v)
+	}
+
 	rt.ServeHTTP(w, req)
 }
 
+func (r *runtime) Logs() *logring.Ring {
+	return r.logs
+}
+
+func (r *runtime) RouteStats() []RouteStats {
+	return r.routeStats.list()
+}
+
+func (r *runtime) ResetRouteStats() {
+	r.routeStats.reset()
+}
+
 func (r *runtime) GetDBStats() (*DBStats, error) {
 	dbs, err := r.db.Stats()
 	if err != nil {
@@ -92,9 +144,38 @@ func (r *runtime) GetDBStats() (*DBStats, error) {
 }
 
 func (r *runtime) Shutdown() error {
-	ctx := r.cron.Stop()
-	<-ctx.Done()
-	return r.db.Close()
+	timeout := r.opts.shutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+
+	r.mu.Lock()
+	cr := r.cron
+	r.mu.Unlock()
+
+	select {
+	case <-cr.Stop().Done():
+	case <-deadline.Done():
+		err = multierr.Append(err, fmt.Errorf("cron jobs did not finish within %s", timeout))
+	}
+
+	// stop the job scheduler, running jobs are interrupted
+	r.cancel()
+
+	select {
+	case <-r.schedulerDone:
+	case <-deadline.Done():
+		err = multierr.Append(err, fmt.Errorf("jobs did not finish within %s", timeout))
+	}
+
+	r.logs.Close()
+
+	return multierr.Append(err, r.db.Close())
 }
 
 func (r *runtime) Read(fn func(tx bolted.SugaredReadTx) error) error {
@@ -112,28 +193,40 @@ func (r *runtime) Update(fn func(tx bolted.SugaredWriteTx) error) error {
 	<-stCtx.Done()
 
 	var cron *cron.Cron
+	var m *manifest.Manifest
+	routes := r.routeStats.newTable()
 	err := bolted.SugaredWrite(r.db, func(tx bolted.SugaredWriteTx) error {
 		err := fn(tx)
 		if err != nil {
 			return err
 		}
 
+		m, err = manifest.FromTx(tx)
+		if err != nil {
+			return err
+		}
+
 		err = runInit(tx, r.db, r.logger)
 		if err != nil {
 			return fmt.Errorf("while running init.js: %w", err)
 		}
 
+		err = updateStaticMeta(tx)
+		if err != nil {
+			return fmt.Errorf("while updating static files metadata: %w", err)
+		}
+
 		jslib, err := jslib.Load(tx)
 		if err != nil {
 			return fmt.Errorf("while loading libs: %w", err)
 		}
 
-		rt, err = initializeRouter(tx, jslib, r.db, r.logger)
+		rt, err = initializeRouter(tx, jslib, r.db, m, r.opts, routes, r.logger)
 		if err != nil {
 			return fmt.Errorf("while initializing router: %w", err)
 		}
 
-		cron, err = cronjobs.CreateCron(tx, jslib, r.db, r.logger)
+		cron, err = cronjobs.CreateCron(tx, jslib, r.db, m, r.opts.metrics, r.opts.tracer, r.logger)
 		if err != nil {
 			return fmt.Errorf("while initializing cron: %w", err)
 		}
@@ -147,8 +240,10 @@ func (r *runtime) Update(fn func(tx bolted.SugaredWriteTx) error) error {
 
 	r.mu.Lock()
 	r.r = rt
+	r.manifest = m
 	r.cron = cron
 	r.mu.Unlock()
+	r.routeStats.activate(routes)
 	r.cron.Start()
 
 	return nil
@@ -161,6 +256,11 @@ func runInit(tx bolted.SugaredWriteTx, db bolted.Database, logger logr.Logger) (
 	if ex {
 		initScript := tx.Get(initPath)
 
+		m, err := manifest.FromTx(tx)
+		if err != nil {
+			return err
+		}
+
 		initScriptProgram, err := goja.Compile("init.js", string(initScript), false)
 		if err != nil {
 			return fmt.Errorf("while parsing init: %w", err)
@@ -172,7 +272,7 @@ func runInit(tx bolted.SugaredWriteTx, db bolted.Database, logger logr.Logger) (
 			return fmt.Errorf("while loading jslib: %w", err)
 		}
 
-		stdlib.SetStandardLibMethods(vm, lib, db, dbpath.ToPath(), logger)
+		stdlib.SetStandardLibMethods(context.Background(), vm, lib, db, dbpath.ToPath(), m.Env, logger.WithValues("script", "init.js"))
 		vm.Set("tx", &dbwrapper.WriteTxWrapper{WriteTx: tx.GetRawWriteTX(), VM: vm})
 		vm.GlobalObject().Delete("read")
 		vm.GlobalObject().Delete("write")
@@ -188,20 +288,25 @@ func runInit(tx bolted.SugaredWriteTx, db bolted.Database, logger logr.Logger) (
 
 }
 
-func initializeRouter(tx bolted.SugaredReadTx, jslib *jslib.Libs, db bolted.Database, logger logr.Logger) (*mux.Router, error) {
+func initializeRouter(tx bolted.SugaredReadTx, jslib *jslib.Libs, db bolted.Database, m *manifest.Manifest, o options, routes *routeTable, logger logr.Logger) (*mux.Router, error) {
 	r := mux.NewRouter()
 	r.StrictSlash(false)
 
-	err := addStaticHandlers(r, tx)
+	err := addStaticHandlers(r, tx, db, m, o, routes)
 	if err != nil {
 		return nil, fmt.Errorf("while adding static handlers: %w", err)
 	}
 
+	pages := loadErrorPages(tx)
+	hash := CodeHash(tx)
+
+	var notFoundJS http.Handler
+
 	handlersPath := dbpath.ToPath("handler")
-	if !tx.Exists(handlersPath) {
-		return r, nil
+	toDo := []dbpath.Path{}
+	if tx.Exists(handlersPath) {
+		toDo = append(toDo, handlersPath)
 	}
-	toDo := []dbpath.Path{handlersPath}
 
 	for len(toDo) > 0 {
 		current := toDo[0]
@@ -225,157 +330,249 @@ func initializeRouter(tx bolted.SugaredReadTx, jslib *jslib.Libs, db bolted.Data
 					return nil, fmt.Errorf("while compiling %s: %w", current.Append(key).String(), err)
 				}
 
-				handlerFunc := func(w http.ResponseWriter, r *http.Request) {
-					vars := mux.Vars(r)
-					vm := goja.New()
-					stdlib.SetStandardLibMethods(vm, jslib, db, current, logger)
-					dbw := dbwrapper.New(db, vm, logger)
-
-					vm.Set("vars", vars)
-					vm.Set("r", r)
-					vm.Set("w", w)
-					vm.Set("render_template", template.RenderTemplate(db, current, w))
-					vm.Set("watch", func(path []string, fn func(interface{}) (bool, error)) selectable {
-						os, _ := dbw.Watch(path, fn)
-						return os
-					})
-
-					vm.Set("requestBody", func() (string, error) {
-						d, err := io.ReadAll(r.Body)
-						if err != nil {
-							return "", fmt.Errorf("while reading request body: %w", err)
-						}
-
-						return string(d), nil
-					})
-
-					vm.Set("select", func(selectables ...selectable) (err error) {
-
-						// reflect.SelectCase
-						cases := make([]reflect.SelectCase, len(selectables))
-						for i, s := range selectables {
-							cases[i] = reflect.SelectCase{
-								Dir:  reflect.SelectRecv,
-								Chan: s.SelectChan(),
-							}
-						}
-						for {
-							chosen, val, ok := reflect.Select(cases)
-							if !ok {
-								// TODO - return something else?
-								return nil
-
-							}
-							done, err := selectables[chosen].Fn()(val.Interface())
-							if err != nil {
-								logger.Error(err, "while running selectable")
-								continue
-							}
-							if done {
-								return nil
-							}
-						}
-
-					})
-
-					vm.Set("upgradeToWebsocket", func(handler func(interface{}) (bool, error)) (selectable, error) {
-						upgrader := websocket.Upgrader{
-							ReadBufferSize:  1024,
-							WriteBufferSize: 1024,
-						}
-
-						conn, err := upgrader.Upgrade(w, r, nil)
-						if err != nil {
-							return nil, err
-						}
-
-						ch := make(chan interface{}, 1)
-
-						go func() {
-							defer conn.Close()
-							defer close(ch)
-
-							for {
-								var v interface{}
-								err = conn.ReadJSON(&v)
-								if err != nil {
-									return
-								}
-								ch <- v
-							}
-
-						}()
-
-						vm.Set("wsSendJson", func(msg interface{}) error {
-							return conn.WriteJSON(msg)
-						})
-
-						vm.Set("wsSendHtml", func(msg string) error {
-							return conn.WriteMessage(websocket.TextMessage, []byte(msg))
-						})
-
-						return &defaultSelectable{ch: ch, fn: handler}, nil
-
-					})
-
-					ctx := r.Context()
-
-					go func() {
-						<-ctx.Done()
-						e := ctx.Err()
-						if e != nil {
-							vm.Interrupt(ctx.Err())
-						}
-					}()
-
-					_, err := vm.RunProgram(program)
-					if err != nil {
-						fmt.Println(err)
-						http.Error(w, err.Error(), 500)
-						return
+				handlerFunc := jsHandler(program, current.Append(key), jslib, db, m, pages, hash, o, logger)
+
+				// handlers starting with `_` are not routed
+				if strings.HasPrefix(key, "_") {
+					if len(current) == 1 && key == notFoundHandlerName {
+						notFoundJS = handlerFunc
 					}
+					continue
 				}
 
-				r.Methods(method).Path("/" + path).HandlerFunc(handlerFunc)
-				r.Methods(method).Path("/" + path + "/").HandlerFunc(handlerFunc)
+				route := "/" + path
+				counter := routes.counter(routeKindHandler, method, route)
+				handler := instrumented(traced(o.tracer, method+" "+route, handlerFunc), func(status int, d time.Duration) {
+					o.metrics.ObserveRequest(route, method, status, d)
+					counter.observe(status, d)
+				})
+
+				r.Methods(method).Path("/" + path).Handler(handler)
+				r.Methods(method).Path("/" + path + "/").Handler(handler)
 			}
 		}
 
 	}
 
+	notFound, err := notFoundHandler(tx, db, m, notFoundJS, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	r.NotFoundHandler = instrumented(notFound, func(status int, d time.Duration) {
+		o.metrics.ObserveRequest(unmatchedRoute, "", status, d)
+	})
+
 	return r, nil
 
 }
 
-func Open(fileName string, logger logr.Logger) (Runtime, error) {
+// jsHandler creates a HTTP handler executing the compiled handler program.
+func jsHandler(program *goja.Program, handlerPath dbpath.Path, jslib *jslib.Libs, db bolted.Database, m *manifest.Manifest, pages *errorPages, codeHash string, o options, logger logr.Logger) http.HandlerFunc {
+	current := handlerPath[:len(handlerPath)-1]
+	logger = logger.WithValues("handler", handlerPath.String())
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logger.WithValues("method", r.Method, "requestId", r.Header.Get(requestIDHeader))
+		body := newBodyRecorder(r.Body)
+		r.Body = body
+		vars := mux.Vars(r)
+		vm := goja.New()
+		stdlib.SetStandardLibMethods(r.Context(), vm, jslib, db, current, m.Env, logger)
+		dbw := dbwrapper.New(r.Context(), db, vm, logger)
+
+		vm.Set("vars", vars)
+		vm.Set("r", r)
+		vm.Set("w", w)
+		vm.Set("render_template", template.RenderTemplate(r.Context(), db, current, w))
+		vm.Set("watch", func(path []string, fn func(interface{}) (bool, error)) selectable {
+			os, _ := dbw.Watch(path, fn)
+			return os
+		})
+
+		vm.Set("requestBody", func() (string, error) {
+			d, err := io.ReadAll(r.Body)
+			if err != nil {
+				return "", fmt.Errorf("while reading request body: %w", err)
+			}
+
+			return string(d), nil
+		})
+
+		vm.Set("select", func(selectables ...selectable) (err error) {
+
+			// reflect.SelectCase
+			cases := make([]reflect.SelectCase, len(selectables))
+			for i, s := range selectables {
+				cases[i] = reflect.SelectCase{
+					Dir:  reflect.SelectRecv,
+					Chan: s.SelectChan(),
+				}
+			}
+			for {
+				chosen, val, ok := reflect.Select(cases)
+				if !ok {
+					// TODO - return something else?
+					return nil
+
+				}
+				done, err := selectables[chosen].Fn()(val.Interface())
+				if err != nil {
+					logger.Error(err, "while running selectable")
+					continue
+				}
+				if done {
+					return nil
+				}
+			}
+
+		})
+
+		vm.Set("upgradeToWebsocket", func(handler func(interface{}) (bool, error)) (selectable, error) {
+			upgrader := websocket.Upgrader{
+				ReadBufferSize:  1024,
+				WriteBufferSize: 1024,
+			}
+
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			o.metrics.WebsocketOpened()
+
+			ch := make(chan interface{}, 1)
+
+			go func() {
+				defer o.metrics.WebsocketClosed()
+				defer conn.Close()
+				defer close(ch)
+
+				for {
+					var v interface{}
+					err = conn.ReadJSON(&v)
+					if err != nil {
+						return
+					}
+					ch <- v
+				}
+
+			}()
+
+			vm.Set("wsSendJson", func(msg interface{}) error {
+				return conn.WriteJSON(msg)
+			})
+
+			vm.Set("wsSendHtml", func(msg string) error {
+				return conn.WriteMessage(websocket.TextMessage, []byte(msg))
+			})
+
+			return &defaultSelectable{ch: ch, fn: handler}, nil
+
+		})
+
+		ctx := r.Context()
+
+		if m.Timeouts.Handler > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, m.Timeouts.Handler)
+			defer cancel()
+		}
+
+		go func() {
+			<-ctx.Done()
+			e := ctx.Err()
+			if e != nil {
+				vm.Interrupt(ctx.Err())
+			}
+		}()
+
+		_, err := vm.RunProgram(program)
+		if err != nil {
+			logger.Error(err, "handler failed", "url", r.URL.String())
+			tracing.RecordError(trace.SpanFromContext(r.Context()), err)
+			he := newHandlerError(db, err, handlerPath.String(), r)
+
+			f := &Failure{
+				Time:         time.Now(),
+				CodeHash:     codeHash,
+				handlerError: *he,
+			}
+			f.Body, f.BodyTruncated = body.excerpt()
+
+			err = recordFailure(db, f)
+			if err != nil {
+				logger.Error(err, "while recording failure")
+			}
+
+			if o.devMode {
+				he.write(w, r)
+				return
+			}
+			pages.internalError(w, r)
+			return
+		}
+	}
+}
+
+func Open(fileName string, logger logr.Logger, opts ...Option) (Runtime, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	logs := logring.New(logRingSize)
+	logger = logring.Logger(logger, logs)
+
+	stats := newRouteStats()
+	routes := stats.newTable()
+
 	db, err := embedded.Open(fileName, 0700, embedded.Options{})
 	if err != nil {
 		return nil, fmt.Errorf("while opening database: %w", err)
 	}
 
 	var r *mux.Router
+	var m *manifest.Manifest
 
 	var cron *cron.Cron
 	ctx, cancel := context.WithCancel(context.Background())
+	schedulerDone := make(chan struct{})
+
+	// kartusches created without the runtime, e.g. by InitializeNew,
+	// don't have the static files metadata yet
+	err = bolted.SugaredWrite(db, updateStaticMeta)
+	if err != nil {
+		db.Close()
+		cancel()
+		return nil, fmt.Errorf("while updating static files metadata: %w", err)
+	}
 
 	err = bolted.SugaredRead(db, func(tx bolted.SugaredReadTx) error {
 
+		m, err = manifest.FromTx(tx)
+		if err != nil {
+			return err
+		}
+
 		jslib, err := jslib.Load(tx)
 		if err != nil {
 			return fmt.Errorf("while loading libs: %w", err)
 		}
 
-		r, err = initializeRouter(tx, jslib, db, logger)
+		r, err = initializeRouter(tx, jslib, db, m, o, routes, logger)
 		if err != nil {
 			return fmt.Errorf("while initializing router: %w", err)
 		}
 
-		cron, err = cronjobs.CreateCron(tx, jslib, db, logger)
+		cron, err = cronjobs.CreateCron(tx, jslib, db, m, o.metrics, o.tracer, logger)
 		if err != nil {
 			return fmt.Errorf("while initializing cron: %w", err)
 		}
 
-		go jobs.JobScheduler(ctx, db, maxJobHistorySize, jslib, logger)
+		go func() {
+			defer close(schedulerDone)
+			jobs.JobScheduler(ctx, db, maxJobHistorySize, jslib, o.metrics, o.tracer, logger)
+		}()
 
 		return err
 	})
@@ -387,14 +584,21 @@ func Open(fileName string, logger logr.Logger) (Runtime, error) {
 
 	cron.Start()
 
+	stats.activate(routes)
+
 	return &runtime{
-		db:     db,
-		r:      r,
-		mu:     new(sync.Mutex),
-		logger: logger,
-		cron:   cron,
-		ctx:    ctx,
-		cancel: cancel,
+		db:            db,
+		r:             r,
+		manifest:      m,
+		mu:            new(sync.Mutex),
+		logger:        logger,
+		cron:          cron,
+		ctx:           ctx,
+		cancel:        cancel,
+		schedulerDone: schedulerDone,
+		opts:          o,
+		logs:          logs,
+		routeStats:    stats,
 	}, nil
 
 }
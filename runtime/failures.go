@@ -0,0 +1,188 @@
+package runtime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/paths"
+)
+
+var failuresPath = dbpath.ToPath(paths.Failures)
+
+// maxFailures is the number of failures kept, older ones are deleted.
+const maxFailures = 100
+
+// maxFailureBodySize is the number of bytes of the request body recorded with a failure.
+const maxFailureBodySize = 64 * 1024
+
+// Failure is a recorded failure of a handler, together with the request that caused it.
+type Failure struct {
+	ID            string    `json:"id"`
+	Time          time.Time `json:"time"`
+	CodeHash      string    `json:"codeHash"`
+	Body          []byte    `json:"body,omitempty"`
+	BodyTruncated bool      `json:"bodyTruncated,omitempty"`
+	handlerError
+}
+
+// bodyRecorder keeps the first bytes of the request body read by the handler.
+type bodyRecorder struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func newBodyRecorder(body io.ReadCloser) *bodyRecorder {
+	if body == nil {
+		body = http.NoBody
+	}
+	return &bodyRecorder{ReadCloser: body}
+}
+
+func (br *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := br.ReadCloser.Read(p)
+	remaining := maxFailureBodySize - br.buf.Len()
+	switch {
+	case n <= remaining:
+		br.buf.Write(p[:n])
+	default:
+		br.buf.Write(p[:remaining])
+		br.truncated = true
+	}
+	return n, err
+}
+
+// excerpt returns the recorded body, reading the part the handler did not read.
+func (br *bodyRecorder) excerpt() ([]byte, bool) {
+	if !br.truncated {
+		io.Copy(io.Discard, io.LimitReader(br, int64(maxFailureBodySize-br.buf.Len()+1)))
+	}
+	return br.buf.Bytes(), br.truncated
+}
+
+// CodeHash identifies the code of the kartusche.
+// It is recorded with failures and with the code versions on the server.
+func CodeHash(tx bolted.SugaredReadTx) string {
+	h := sha256.New()
+
+	toDo := []dbpath.Path{dbpath.NilPath}
+	for len(toDo) > 0 {
+		current := toDo[0]
+		toDo = toDo[1:]
+		for it := tx.Iterator(current); !it.IsDone(); it.Next() {
+			p := current.Append(it.GetKey())
+			if len(p) == 1 && !paths.IsCode(p[0]) {
+				continue
+			}
+			if tx.IsMap(p) {
+				toDo = append(toDo, p)
+				continue
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00", p.String(), len(it.GetValue()))
+			h.Write(it.GetValue())
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+func failureKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// recordFailure appends the failure to the failure log, deleting the oldest failures if needed.
+func recordFailure(db bolted.Database, f *Failure) error {
+	return bolted.SugaredWrite(db, func(tx bolted.SugaredWriteTx) error {
+		if !tx.Exists(failuresPath) {
+			tx.CreateMap(failuresPath)
+		}
+
+		var seq uint64 = 1
+		it := tx.Iterator(failuresPath)
+		it.Last()
+		if !it.IsDone() {
+			last, err := strconv.ParseUint(it.GetKey(), 10, 64)
+			if err != nil {
+				return fmt.Errorf("while parsing last failure id: %w", err)
+			}
+			seq = last + 1
+		}
+
+		f.ID = strconv.FormatUint(seq, 10)
+
+		d, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("while marshalling failure: %w", err)
+		}
+
+		tx.Put(failuresPath.Append(failureKey(seq)), d)
+
+		if seq <= maxFailures {
+			return nil
+		}
+
+		oldestKept := failureKey(seq - maxFailures + 1)
+
+		toDelete := []string{}
+		for it := tx.Iterator(failuresPath); !it.IsDone() && it.GetKey() < oldestKept; it.Next() {
+			toDelete = append(toDelete, it.GetKey())
+		}
+
+		for _, k := range toDelete {
+			tx.Delete(failuresPath.Append(k))
+		}
+
+		return nil
+	})
+}
+
+// ListFailures returns the recorded failures, the most recent one first.
+func ListFailures(tx bolted.SugaredReadTx) ([]Failure, error) {
+	failures := []Failure{}
+
+	if !tx.Exists(failuresPath) {
+		return failures, nil
+	}
+
+	it := tx.Iterator(failuresPath)
+	for it.Last(); !it.IsDone(); it.Prev() {
+		f := Failure{}
+		err := json.Unmarshal(it.GetValue(), &f)
+		if err != nil {
+			return nil, fmt.Errorf("while unmarshalling failure %s: %w", it.GetKey(), err)
+		}
+		failures = append(failures, f)
+	}
+
+	return failures, nil
+}
+
+// GetFailure returns the recorded failure with the id or nil if there is none.
+func GetFailure(tx bolted.SugaredReadTx, id string) (*Failure, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	p := failuresPath.Append(failureKey(seq))
+	if !tx.Exists(p) {
+		return nil, nil
+	}
+
+	f := &Failure{}
+	err = json.Unmarshal(tx.Get(p), f)
+	if err != nil {
+		return nil, fmt.Errorf("while unmarshalling failure %s: %w", id, err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,55 @@
+Feature: SPA fallback and error pages
+
+    Scenario: SPA index is served for unmatched requests accepting HTML
+        Given the kartusche has "static/index.html" with content:
+            """
+            app
+            """
+        And the kartusche has "kartusche.yaml" with content:
+            """
+            spa:
+              index: index.html
+            """
+        When the kartusche receives GET request for "/some/deep/link" accepting HTML
+        Then the kartusche should respond with "app"
+
+    Scenario: SPA index is not served for requests not accepting HTML
+        Given the kartusche has "static/index.html" with content:
+            """
+            app
+            """
+        And the kartusche has "kartusche.yaml" with content:
+            """
+            spa:
+              index: index.html
+            """
+        When the kartusche receives GET request for "/missing.js"
+        Then the kartusche should respond with 404 status code
+
+    Scenario: 404.html static file
+        Given the kartusche has "static/404.html" with content:
+            """
+            not here
+            """
+        When the kartusche receives GET request for "/missing"
+        Then the kartusche should respond with 404 status code and "not here"
+
+    Scenario: 404 handler
+        Given the kartusche has "handler/_404.js" with content:
+            """
+            w.write("custom " + r.requestURI)
+            """
+        When the kartusche receives GET request for "/missing"
+        Then the kartusche should respond with 404 status code and "custom /missing"
+
+    Scenario: 500.html static file
+        Given the kartusche has "static/500.html" with content:
+            """
+            oops
+            """
+        And the kartusche has "handler/GET.js" with content:
+            """
+            throw new Error("failed")
+            """
+        When the kartusche receives GET request for "/"
+        Then the kartusche should respond with 500 status code and "oops"
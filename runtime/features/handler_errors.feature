@@ -0,0 +1,52 @@
+Feature: handler errors
+
+    Scenario: details of errors are not revealed
+        Given the kartusche has "handler/GET.js" with content:
+            """
+            throw new Error("secret detail")
+            """
+        When the kartusche receives GET request for "/"
+        Then the kartusche should respond with 500 status code
+        And the response should not contain "secret detail"
+        And the response should contain the request id
+
+    Scenario: request id provided by the client is used
+        Given the kartusche has "handler/GET.js" with content:
+            """
+            throw new Error("failed")
+            """
+        When the kartusche receives GET request for "/" with request id "abc-123"
+        Then the response should have header "X-Request-Id" with value "abc-123"
+        And the response should contain "abc-123"
+
+    @dev
+    Scenario: stack trace and source excerpt in development mode
+        Given the kartusche has "lib/greet.js" with content:
+            """
+            exports.greet = (name) => {
+                throw new Error("no greeting for " + name)
+            }
+            """
+        And the kartusche has "handler/GET.js" with content:
+            """
+            const { greet } = require("lib/greet")
+            w.write(greet("world"))
+            """
+        When the kartusche receives GET request for "/" accepting HTML
+        Then the kartusche should respond with 500 status code
+        And the response should contain "no greeting for world"
+        And the response should contain "lib/greet.js"
+        And the response should contain "handler/GET.js:2"
+        And the response should contain "throw new Error(&#34;no greeting for &#34; &#43; name)"
+
+    @dev
+    Scenario: JSON error response in development mode
+        Given the kartusche has "handler/GET.js" with content:
+            """
+            throw new Error("failed")
+            """
+        When the kartusche receives GET request for "/"
+        Then the kartusche should respond with 500 status code
+        And the response should have header "Content-Type" with value "application/json"
+        And the response should contain "Error: failed"
+        And the response should contain "excerpt"
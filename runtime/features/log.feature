@@ -0,0 +1,28 @@
+Feature: logging
+
+    @logs
+    Scenario: handlers log with the request context
+        Given the kartusche has "handler/GET.js" with content:
+            """
+            log.info("greeting", {name: "world"})
+            w.write("ok")
+            """
+        When the kartusche receives GET request for "/" with request id "req-1"
+        Then the log entry "greeting" should have "name" set to "world"
+        And the log entry "greeting" should have "handler" set to "handler/GET.js"
+        And the log entry "greeting" should have "method" set to "GET"
+        And the log entry "greeting" should have "requestId" set to "req-1"
+
+    @logs
+    Scenario: log levels
+        Given the kartusche has "handler/GET.js" with content:
+            """
+            log.debug("details", {})
+            log.warn("careful")
+            log.error("failed", {error: new Error("boom")})
+            w.write("ok")
+            """
+        When the kartusche receives GET request for "/"
+        Then the log entry "details" should have "level" set to "1"
+        And the log entry "careful" should have "severity" set to "warning"
+        And the log entry "failed" should have "error" set to "Error: boom"
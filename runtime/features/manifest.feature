@@ -0,0 +1,43 @@
+Feature: kartusche manifest
+
+    Scenario: environment from the manifest
+        Given the kartusche has "kartusche.yaml" with content:
+            """
+            env:
+              GREETING: hello
+            """
+        And the kartusche has "handler/GET.js" with content:
+            """
+            w.write(env.GREETING)
+            """
+        When the kartusche receives GET request for "/"
+        Then the kartusche should respond with "hello"
+
+    Scenario: headers from the manifest
+        Given the kartusche has "kartusche.yaml" with content:
+            """
+            headers:
+              - path: /assets/**
+                values:
+                  Cache-Control: max-age=3600
+            """
+        And the kartusche has "static/assets/app.js" with content:
+            """
+            console.log("app")
+            """
+        When the kartusche receives GET request for "/assets/app.js"
+        Then the kartusche should respond with 200 status code
+        And the response should have header "Cache-Control" with value "max-age=3600"
+
+    Scenario: handler timeout
+        Given the kartusche has "kartusche.yaml" with content:
+            """
+            timeouts:
+              handler: 100ms
+            """
+        And the kartusche has "handler/GET.js" with content:
+            """
+            while (true) {}
+            """
+        When the kartusche receives GET request for "/"
+        Then the kartusche should respond with 500 status code
@@ -0,0 +1,72 @@
+Feature: static files
+
+    Scenario: precompressed static file
+        Given the kartusche has "static/app.js" with content:
+            """
+            function greet(name) { console.log("hello " + name) }
+            function greet(name) { console.log("hello " + name) }
+            function greet(name) { console.log("hello " + name) }
+            function greet(name) { console.log("hello " + name) }
+            function greet(name) { console.log("hello " + name) }
+            function greet(name) { console.log("hello " + name) }
+            """
+        When the kartusche receives GET request for "/app.js" accepting encoding "gzip, br"
+        Then the kartusche should respond with 200 status code
+        And the response should have header "Content-Encoding" with value "br"
+        And the response should have header "Vary" with value "Accept-Encoding"
+        When the kartusche receives GET request for "/app.js" accepting encoding "gzip"
+        Then the response should have header "Content-Encoding" with value "gzip"
+        When the kartusche receives GET request for "/app.js" accepting encoding "identity"
+        Then the response should not have header "Content-Encoding"
+
+    Scenario: modification time of unchanged static files is kept
+        Given the kartusche has "static/index.html" with content:
+            """
+            hello
+            """
+        When the kartusche receives GET request for "/index.html"
+        And I remember the Last-Modified header
+        And a second later the kartusche has "static/other.html" with content:
+            """
+            other
+            """
+        And the kartusche receives GET request for "/index.html"
+        Then the Last-Modified header should be unchanged
+
+    Scenario: fingerprinted static files are immutable
+        Given the kartusche has "kartusche.yaml" with content:
+            """
+            static:
+              cache_control: no-cache
+            """
+        And the kartusche has "static/app.0123abcd.js" with content:
+            """
+            console.log("app")
+            """
+        And the kartusche has "static/app.js" with content:
+            """
+            console.log("app")
+            """
+        When the kartusche receives GET request for "/app.0123abcd.js"
+        Then the response should have header "Cache-Control" with value "public, max-age=31536000, immutable"
+        When the kartusche receives GET request for "/app.js"
+        Then the response should have header "Cache-Control" with value "no-cache"
+
+    Scenario: large static files are read from the database
+        Given the kartusche has "kartusche.yaml" with content:
+            """
+            static:
+              max_cached_size: 10
+            """
+        And the kartusche has "static/large.txt" with content:
+            """
+            larger than ten bytes
+            """
+        When the kartusche receives GET request for "/large.txt"
+        Then the kartusche should respond with "larger than ten bytes"
+        When the kartusche has "static/large.txt" with content:
+            """
+            changed content of the large file
+            """
+        And the kartusche receives GET request for "/large.txt"
+        Then the kartusche should respond with "changed content of the large file"
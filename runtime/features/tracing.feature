@@ -0,0 +1,78 @@
+Feature: tracing
+
+    @tracing
+    Scenario: handler spans include database transactions, templates and outgoing requests
+        Given an upstream HTTP server
+        And the kartusche has "templates/page.html" with content:
+            """
+            <p>{{greeting}}</p>
+            """
+        And the kartusche has "handler/GET.js" calling the upstream server with content:
+            """
+            write(tx => tx.put(["greeting"], "hello"))
+            const greeting = read(tx => tx.get(["greeting"]))
+            http_do("GET", "UPSTREAM_URL", {})
+            render_template("page.html", {greeting})
+            """
+        When the kartusche receives GET request for "/"
+        Then the span "db write" should be a child of "GET /"
+        And the span "db read" should be a child of "GET /"
+        And the span "render template" should be a child of "GET /"
+        And the span "http_do GET" should be a child of "GET /"
+        And the upstream server should have received the traceparent of "http_do GET"
+
+    @tracing
+    Scenario: incoming traceparent is continued
+        Given the kartusche has "handler/GET.js" with content:
+            """
+            w.write("ok")
+            """
+        When the kartusche receives GET request for "/" with traceparent "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+        Then the span "GET /" should be in the trace "4bf92f3577b34da6a3ce929d0e0e4736"
+        And the span "GET /" should be a child of the remote span "00f067aa0ba902b7"
+
+    @tracing
+    Scenario: incoming trace that is not sampled is not recorded
+        Given an upstream HTTP server
+        And the kartusche has "handler/GET.js" calling the upstream server with content:
+            """
+            http_do("GET", "UPSTREAM_URL", {})
+            """
+        When the kartusche receives GET request for "/" with traceparent "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+        Then the upstream server should have received an unsampled traceparent in the trace "4bf92f3577b34da6a3ce929d0e0e4736"
+        And no spans should have been recorded
+
+    @tracing
+    Scenario: failing handler marks the span as failed
+        Given the kartusche has "handler/GET.js" with content:
+            """
+            throw new Error("boom")
+            """
+        When the kartusche receives GET request for "/"
+        Then the span "GET /" should have failed with "boom"
+
+    @tracing
+    Scenario: job scheduled by a handler is part of the trace
+        Given the kartusche has "jobs/greet.js" with content:
+            """
+            write(tx => tx.put(["greeted"], params.name))
+            """
+        And the kartusche has "handler/GET.js" with content:
+            """
+            write(tx => scheduleJob("greet", {name: "world"}))
+            """
+        When the kartusche receives GET request for "/"
+        Then the job "greet" should have succeeded
+        And the span "job greet" should be in the trace of "GET /"
+
+    Scenario: job scheduled without tracing runs
+        Given the kartusche has "jobs/greet.js" with content:
+            """
+            write(tx => tx.put(["greeted"], params.name))
+            """
+        And the kartusche has "handler/GET.js" with content:
+            """
+            write(tx => scheduleJob("greet", {name: "world"}))
+            """
+        When the kartusche receives GET request for "/"
+        Then the job "greet" should have succeeded
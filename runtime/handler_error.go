@@ -0,0 +1,226 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+)
+
+// excerptContext is the number of source lines shown before and after the failing line.
+const excerptContext = 3
+
+// handlerError describes a failed handler in development mode.
+type handlerError struct {
+	Message   string         `json:"message"`
+	Stack     []stackFrame   `json:"stack,omitempty"`
+	Excerpt   *sourceExcerpt `json:"excerpt,omitempty"`
+	Handler   string         `json:"handler"`
+	RequestID string         `json:"requestId"`
+	Method    string         `json:"method"`
+	URL       string         `json:"url"`
+	Header    http.Header    `json:"header"`
+}
+
+type stackFrame struct {
+	Function string `json:"function,omitempty"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+type sourceExcerpt struct {
+	File  string       `json:"file"`
+	Lines []sourceLine `json:"lines"`
+}
+
+type sourceLine struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+	Failed bool   `json:"failed,omitempty"`
+}
+
+func newHandlerError(db bolted.Database, err error, handler string, r *http.Request) *handlerError {
+	he := &handlerError{
+		Message:   err.Error(),
+		Handler:   handler,
+		RequestID: r.Header.Get(requestIDHeader),
+		Method:    r.Method,
+		URL:       r.URL.String(),
+		Header:    redactedHeader(r.Header),
+	}
+
+	var ex *goja.Exception
+	var ie *goja.InterruptedError
+	switch {
+	case errors.As(err, &ie):
+		he.Message = ie.Error()
+		he.Stack = parseStack(ie.String())
+	case errors.As(err, &ex):
+		if ex.Value() != nil {
+			he.Message = ex.Value().String()
+		}
+		he.Stack = parseStack(ex.String())
+	}
+
+	for _, f := range he.Stack {
+		excerpt := readExcerpt(db, f)
+		if excerpt != nil {
+			he.Excerpt = excerpt
+			break
+		}
+	}
+
+	return he
+}
+
+// Redacted replaces the values of headers containing credentials.
+const Redacted = "[redacted]"
+
+// credentialHeaderParts are parts of the names of headers that can contain credentials,
+// e.g. `Authorization`, `Proxy-Authorization`, `Set-Cookie`, `X-Api-Key` or `X-Auth-Token`.
+var credentialHeaderParts = []string{"auth", "cookie", "token", "key", "secret", "password", "session", "signature"}
+
+// isCredentialHeader returns true if the header can contain credentials.
+func isCredentialHeader(name string) bool {
+	lower := strings.ToLower(name)
+	for _, part := range credentialHeaderParts {
+		if strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedHeader returns a copy of the header without credentials.
+func redactedHeader(h http.Header) http.Header {
+	redacted := h.Clone()
+	for name := range redacted {
+		if isCredentialHeader(name) {
+			redacted.Set(name, Redacted)
+		}
+	}
+	return redacted
+}
+
+// stackFrameRegexp matches frames of goja stack traces, e.g. `at fn (handler/GET.js:3:7(12))`.
+var stackFrameRegexp = regexp.MustCompile(`^\s*at (?:(.*) \()?(.+):(\d+):(\d+)\(\d+\)\)?$`)
+
+func parseStack(stack string) []stackFrame {
+	frames := []stackFrame{}
+	for _, line := range strings.Split(stack, "\n") {
+		m := stackFrameRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		lineNumber, _ := strconv.Atoi(m[3])
+		column, _ := strconv.Atoi(m[4])
+		frames = append(frames, stackFrame{
+			Function: m[1],
+			File:     m[2],
+			Line:     lineNumber,
+			Column:   column,
+		})
+	}
+	return frames
+}
+
+// readExcerpt reads the source lines around the frame from the kartusche.
+// It returns nil if the source is not part of the kartusche.
+func readExcerpt(db bolted.Database, f stackFrame) *sourceExcerpt {
+	p, err := dbpath.Parse(f.File)
+	if err != nil || len(p) == 0 {
+		return nil
+	}
+
+	var excerpt *sourceExcerpt
+	bolted.SugaredRead(db, func(tx bolted.SugaredReadTx) error {
+		if !tx.Exists(p) || tx.IsMap(p) {
+			return nil
+		}
+
+		lines := strings.Split(string(tx.Get(p)), "\n")
+		if f.Line < 1 || f.Line > len(lines) {
+			return nil
+		}
+
+		excerpt = &sourceExcerpt{File: f.File}
+		from := f.Line - excerptContext
+		if from < 1 {
+			from = 1
+		}
+
+		to := f.Line + excerptContext
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		for i := from; i <= to; i++ {
+			excerpt.Lines = append(excerpt.Lines, sourceLine{
+				Number: i,
+				Text:   lines[i-1],
+				Failed: i == f.Line,
+			})
+		}
+		return nil
+	})
+
+	return excerpt
+}
+
+func (he *handlerError) write(w http.ResponseWriter, r *http.Request) {
+	if acceptsHTML(r) {
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		handlerErrorTemplate.Execute(w, he)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(he)
+}
+
+var handlerErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Error in {{.Handler}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+pre { background: #f6f6f6; padding: 1em; overflow: auto; }
+.failed { background: #ffd7d7; }
+th { text-align: left; padding-right: 1em; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>{{.Message}}</h1>
+<p>in <code>{{.Handler}}</code> while handling <code>{{.Method}} {{.URL}}</code></p>
+{{with .Excerpt}}
+<h2>{{.File}}</h2>
+<pre>{{range .Lines}}<span{{if .Failed}} class="failed"{{end}}>{{printf "%4d" .Number}}  {{.Text}}</span>
+{{end}}</pre>
+{{end}}
+{{with .Stack}}
+<h2>Stack</h2>
+<pre>{{range .}}at {{with .Function}}{{.}} {{end}}{{.File}}:{{.Line}}:{{.Column}}
+{{end}}</pre>
+{{end}}
+<h2>Request</h2>
+<table>
+<tr><th>Request ID</th><td>{{.RequestID}}</td></tr>
+{{range $name, $values := .Header}}<tr><th>{{$name}}</th><td>{{range $values}}{{.}} {{end}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
@@ -2,10 +2,15 @@ package httprequest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"mime"
 	"net/http"
+
+	"github.com/draganm/kartusche/runtime/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Response struct {
@@ -22,7 +27,24 @@ type Options struct {
 	Json bool
 }
 
-func Request(method, url string, options Options) (*Response, error) {
+// Request returns the `http_do` function.
+// Requests are traced as children of the span in ctx, with the `traceparent` header set accordingly.
+func Request(ctx context.Context) func(method, url string, options Options) (*Response, error) {
+	return func(method, url string, options Options) (res *Response, err error) {
+		ctx, span := tracing.Start(ctx, "http_do "+method, trace.SpanKindClient)
+		span.SetAttributes(attribute.String("http.method", method), attribute.String("http.url", url))
+		defer func() {
+			if res != nil {
+				span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+			}
+			tracing.End(span, err)
+		}()
+
+		return request(ctx, method, url, options)
+	}
+}
+
+func request(ctx context.Context, method, url string, options Options) (*Response, error) {
 	bb := new(bytes.Buffer)
 	if options.Json {
 		err := json.NewEncoder(bb).Encode(options.Body)
@@ -48,6 +70,8 @@ func Request(method, url string, options Options) (*Response, error) {
 		req.Header.Set("content-type", "application/json")
 	}
 
+	tracing.Inject(ctx, req.Header)
+
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("while performing request: %w", err)
@@ -11,6 +11,8 @@ import (
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
 	"github.com/draganm/bolted/embedded"
+	"github.com/draganm/kartusche/common/ignore"
+	"github.com/draganm/kartusche/common/manifest"
 	"github.com/draganm/kartusche/common/paths"
 	"github.com/draganm/kartusche/common/util/path"
 	"github.com/go-logr/logr"
@@ -24,12 +26,19 @@ func InitializeNew(fileName, dir string) (err error) {
 	}
 	defer db.Close()
 
+	ignored, err := ignore.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	m, err := manifest.Load(dir)
+	if err != nil {
+		return err
+	}
+
 	err = bolted.SugaredWrite(db, func(tx bolted.SugaredWriteTx) error {
 		for _, p := range paths.WellKnown {
-			if !filepath.IsAbs(p) {
-				p = filepath.Join(dir, p)
-			}
-			err = loadFromPath(p, tx, dbpath.ToPath(filepath.Base(p)))
+			err = loadFromPath(dir, m.SourceDir(p), tx, dbpath.ToPath(p), ignored)
 			if err != nil {
 				return fmt.Errorf("while loading %s: %w", p, err)
 			}
@@ -76,12 +85,15 @@ func InitializeEmpty(fileName string) error {
 
 }
 
-func loadFromPath(dir string, wtx bolted.SugaredWriteTx, prefix dbpath.Path) error {
-	absDir, err := filepath.Abs(dir)
+// loadFromPath loads the source dir, relative to the kartusche root dir, into prefix.
+func loadFromPath(root, source string, wtx bolted.SugaredWriteTx, prefix dbpath.Path, ignored *ignore.Matcher) error {
+	absRoot, err := filepath.Abs(root)
 	if err != nil {
 		return fmt.Errorf("while getting abs path: %w", err)
 	}
 
+	absDir := filepath.Join(absRoot, source)
+
 	_, err = os.Stat(absDir)
 	if os.IsNotExist(err) {
 		return nil
@@ -107,6 +119,18 @@ func loadFromPath(dir string, wtx bolted.SugaredWriteTx, prefix dbpath.Path) err
 			return nil
 		}
 
+		rel, err := filepath.Rel(absRoot, file)
+		if err != nil {
+			return fmt.Errorf("while getting relative path of %s: %w", file, err)
+		}
+
+		if ignored.Match(filepath.ToSlash(rel), fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		if fi.IsDir() {
 			wtx.CreateMap(dbp)
 			return nil
@@ -0,0 +1,48 @@
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/draganm/kartusche/common/util/statusrecorder"
+	"github.com/draganm/kartusche/runtime/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumented calls observe with the status and duration of every request served by h.
+func instrumented(h http.Handler, observe func(status int, d time.Duration)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := statusrecorder.New(w)
+		h.ServeHTTP(sr, r)
+		observe(sr.StatusCode(), time.Since(start))
+	}
+}
+
+// traced records a span for every request served by h,
+// continuing the trace of the `traceparent` request header.
+func traced(t *tracing.Tracer, name string, h http.Handler) http.Handler {
+	if t == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := t.Start(tracing.Extract(r.Context(), r.Header), name, trace.SpanKindServer)
+		span.SetAttributes(attribute.String("http.method", r.Method), attribute.String("http.target", r.URL.RequestURI()))
+
+		sr := statusrecorder.New(w)
+		h.ServeHTTP(sr, r.WithContext(ctx))
+
+		status := sr.StatusCode()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+
+		// the error of a failed handler is recorded as an event of the span already
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("responded with status %d", status))
+		}
+		span.End()
+	})
+}
@@ -2,22 +2,35 @@ package runtime_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"regexp"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cucumber/godog"
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	kruntime "github.com/draganm/kartusche/runtime"
 	"github.com/draganm/kartusche/runtime/testrig"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
 	"github.com/go-logr/zapr"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.uber.org/zap"
 )
 
@@ -59,32 +72,104 @@ type State struct {
 	ti             testrig.TestKartuscheInstance
 	lastStatusCode int
 	lastResponse   string
+	lastHeader     http.Header
+	lastModified   string
+	logs           *logRecorder
+	spans          *spanRecorder
+	upstream       *httptest.Server
+	traceparents   chan string
+}
+
+// spanRecorder collects the spans of scenarios tagged with @tracing.
+type spanRecorder struct {
+	tracer   *tracing.Tracer
+	recorder *tracetest.SpanRecorder
+}
+
+func newSpanRecorder() *spanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	return &spanRecorder{
+		tracer:   tracing.New(sdktrace.WithSpanProcessor(recorder)),
+		recorder: recorder,
+	}
+}
+
+// find waits for the span with the name to end.
+func (r *spanRecorder) find(name string) (sdktrace.ReadOnlySpan, error) {
+	names := []string{}
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(50 * time.Millisecond) {
+		names = names[:0]
+		for _, s := range r.recorder.Ended() {
+			if s.Name() == name {
+				return s, nil
+			}
+			names = append(names, s.Name())
+		}
+	}
+
+	return nil, fmt.Errorf("span %q was not recorded, got %v", name, names)
+}
+
+type logRecorder struct {
+	mu      sync.Mutex
+	entries []map[string]interface{}
+}
+
+func (l *logRecorder) record(obj string) {
+	entry := map[string]interface{}{}
+	err := json.Unmarshal([]byte(obj), &entry)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+func (l *logRecorder) find(msg string) map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e["msg"] == msg {
+			return e
+		}
+	}
+	return nil
 }
 
 func (s *State) get(path string) (int, string, error) {
+	statusCode, _, body, err := s.getWithHeader(path, nil)
+	return statusCode, body, err
+}
+
+func (s *State) getWithHeader(path string, header http.Header) (int, http.Header, string, error) {
 	u, err := url.JoinPath(s.ti.GetURL(), path)
 	if err != nil {
-		return -1, "", fmt.Errorf("could not join path for GET request: %w", err)
+		return -1, nil, "", fmt.Errorf("could not join path for GET request: %w", err)
 	}
 
 	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
-		return -1, "", fmt.Errorf("could not create GET request: %w", err)
+		return -1, nil, "", fmt.Errorf("could not create GET request: %w", err)
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
 	}
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return -1, "", fmt.Errorf("could not perform GET request: %w", err)
+		return -1, nil, "", fmt.Errorf("could not perform GET request: %w", err)
 	}
 
 	defer res.Body.Close()
 
 	d, err := io.ReadAll(res.Body)
 	if err != nil {
-		return -1, "", fmt.Errorf("could not read response body: %w", err)
+		return -1, nil, "", fmt.Errorf("could not read response body: %w", err)
 	}
 
-	return res.StatusCode, string(d), nil
+	return res.StatusCode, res.Header, string(d), nil
 
 }
 
@@ -102,16 +187,45 @@ func InitializeScenario(ctx *godog.ScenarioContext) {
 
 	})
 
+	state := &State{}
+
 	ctx.After(func(ctx context.Context, sc *godog.Scenario, err error) (context.Context, error) {
 		cancel()
+		if state.upstream != nil {
+			state.upstream.Close()
+		}
+		if state.spans != nil {
+			state.spans.tracer.Shutdown()
+		}
 		return ctx, nil
 	})
 
-	state := &State{}
-
 	ctx.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
 
-		tri, err := testrig.StartTestKartuscheInstance(ctx)
+		rtOpts := []kruntime.Option{}
+		for _, t := range sc.Tags {
+			if t.Name == "@dev" {
+				rtOpts = append(rtOpts, kruntime.WithDevMode())
+			}
+		}
+
+		// logs are only recorded for scenarios checking them
+		rtCtx := logr.NewContext(ctx, logr.Discard())
+		for _, t := range sc.Tags {
+			if t.Name == "@logs" {
+				state.logs = &logRecorder{}
+				rtCtx = logr.NewContext(ctx, funcr.NewJSON(state.logs.record, funcr.Options{Verbosity: 1}))
+			}
+		}
+
+		for _, t := range sc.Tags {
+			if t.Name == "@tracing" {
+				state.spans = newSpanRecorder()
+				rtOpts = append(rtOpts, kruntime.WithTracer(state.spans.tracer))
+			}
+		}
+
+		tri, err := testrig.StartTestKartuscheInstance(rtCtx, rtOpts...)
 		if err != nil {
 			return ctx, fmt.Errorf("could not start test rig: %w", err)
 		}
@@ -144,6 +258,34 @@ func InitializeScenario(ctx *godog.ScenarioContext) {
 	ctx.Step(`^when I generate a v6 UUID$`, whenIGenerateAVUUID)
 	ctx.Step(`^the result should be a Date$`, theResultShouldBeADate)
 	ctx.Step(`^when I generate and parse a v6 UUID$`, whenIGenerateAndParseAVUUID)
+	ctx.Step(`^the kartusche has "([^"]*)" with content:$`, theKartuscheHasWithContent)
+	ctx.Step(`^the kartusche receives GET request for "([^"]*)"$`, theKartuscheReceivesGETRequestFor)
+	ctx.Step(`^the kartusche should respond with "([^"]*)"$`, theKartuscheShouldRespondWith)
+	ctx.Step(`^the kartusche receives GET request for "([^"]*)" accepting HTML$`, theKartuscheReceivesGETRequestForAcceptingHTML)
+	ctx.Step(`^the kartusche receives GET request for "([^"]*)" accepting encoding "([^"]*)"$`, theKartuscheReceivesGETRequestForAcceptingEncoding)
+	ctx.Step(`^the response should not have header "([^"]*)"$`, theResponseShouldNotHaveHeader)
+	ctx.Step(`^I remember the Last-Modified header$`, iRememberTheLastModifiedHeader)
+	ctx.Step(`^a second later the kartusche has "([^"]*)" with content:$`, aSecondLaterTheKartuscheHasWithContent)
+	ctx.Step(`^the Last-Modified header should be unchanged$`, theLastModifiedHeaderShouldBeUnchanged)
+	ctx.Step(`^the kartusche should respond with (\d+) status code and "([^"]*)"$`, theKartuscheShouldRespondWithStatusCodeAndBody)
+	ctx.Step(`^the response should have header "([^"]*)" with value "([^"]*)"$`, theResponseShouldHaveHeaderWithValue)
+	ctx.Step(`^the kartusche receives GET request for "([^"]*)" with request id "([^"]*)"$`, theKartuscheReceivesGETRequestForWithRequestID)
+	ctx.Step(`^the response should contain "([^"]*)"$`, theResponseShouldContain)
+	ctx.Step(`^the response should not contain "([^"]*)"$`, theResponseShouldNotContain)
+	ctx.Step(`^the response should contain the request id$`, theResponseShouldContainTheRequestID)
+	ctx.Step(`^the log entry "([^"]*)" should have "([^"]*)" set to "([^"]*)"$`, theLogEntryShouldHaveSetTo)
+	ctx.Step(`^an upstream HTTP server$`, anUpstreamHTTPServer)
+	ctx.Step(`^the kartusche has "([^"]*)" calling the upstream server with content:$`, theKartuscheHasCallingTheUpstreamServerWithContent)
+	ctx.Step(`^the kartusche receives GET request for "([^"]*)" with traceparent "([^"]*)"$`, theKartuscheReceivesGETRequestForWithTraceparent)
+	ctx.Step(`^the span "([^"]*)" should be in the trace "([^"]*)"$`, theSpanShouldBeInTheTrace)
+	ctx.Step(`^the span "([^"]*)" should be a child of "([^"]*)"$`, theSpanShouldBeAChildOf)
+	ctx.Step(`^the span "([^"]*)" should be in the trace of "([^"]*)"$`, theSpanShouldBeInTheTraceOf)
+	ctx.Step(`^the span "([^"]*)" should be a child of the remote span "([^"]*)"$`, theSpanShouldBeAChildOfTheRemoteSpan)
+	ctx.Step(`^the span "([^"]*)" should have failed with "([^"]*)"$`, theSpanShouldHaveFailedWith)
+	ctx.Step(`^the upstream server should have received the traceparent of "([^"]*)"$`, theUpstreamServerShouldHaveReceivedTheTraceparentOf)
+	ctx.Step(`^the upstream server should have received an unsampled traceparent in the trace "([^"]*)"$`, theUpstreamServerShouldHaveReceivedAnUnsampledTraceparentInTheTrace)
+	ctx.Step(`^no spans should have been recorded$`, noSpansShouldHaveBeenRecorded)
+	ctx.Step(`^the job "([^"]*)" should have succeeded$`, theJobShouldHaveSucceeded)
 
 }
 
@@ -416,3 +558,341 @@ func theResultShouldBeADate(ctx context.Context) error {
 
 	return nil
 }
+
+func theKartuscheHasWithContent(ctx context.Context, pth string, content *godog.DocString) error {
+	s := getState(ctx)
+	return s.ti.AddContent(pth, content.Content)
+}
+
+func theKartuscheReceivesGETRequestFor(ctx context.Context, pth string) error {
+	s := getState(ctx)
+	var err error
+	s.lastStatusCode, s.lastHeader, s.lastResponse, err = s.getWithHeader(pth, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func theKartuscheReceivesGETRequestForAcceptingHTML(ctx context.Context, pth string) error {
+	s := getState(ctx)
+	var err error
+	s.lastStatusCode, s.lastHeader, s.lastResponse, err = s.getWithHeader(pth, http.Header{"Accept": {"text/html"}})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func theKartuscheShouldRespondWithStatusCodeAndBody(ctx context.Context, expectedStatusCode int, expected string) error {
+	s := getState(ctx)
+	if s.lastStatusCode != expectedStatusCode {
+		return fmt.Errorf("expected status code %d but got %d: %s", expectedStatusCode, s.lastStatusCode, s.lastResponse)
+	}
+
+	if s.lastResponse != expected {
+		return fmt.Errorf("unexpected response %q (expected %q)", s.lastResponse, expected)
+	}
+	return nil
+}
+
+func theKartuscheShouldRespondWith(ctx context.Context, expected string) error {
+	s := getState(ctx)
+	if s.lastStatusCode != 200 {
+		return fmt.Errorf("unexpected status code %d: %s", s.lastStatusCode, s.lastResponse)
+	}
+
+	if s.lastResponse != expected {
+		return fmt.Errorf("unexpected response %q (expected %q)", s.lastResponse, expected)
+	}
+	return nil
+}
+
+func theResponseShouldHaveHeaderWithValue(ctx context.Context, name, expected string) error {
+	s := getState(ctx)
+	actual := s.lastHeader.Get(name)
+	if actual != expected {
+		return fmt.Errorf("unexpected value %q of header %s (expected %q)", actual, name, expected)
+	}
+	return nil
+}
+
+func theKartuscheReceivesGETRequestForAcceptingEncoding(ctx context.Context, pth, encoding string) error {
+	s := getState(ctx)
+	var err error
+	s.lastStatusCode, s.lastHeader, s.lastResponse, err = s.getWithHeader(pth, http.Header{"Accept-Encoding": {encoding}})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func theResponseShouldNotHaveHeader(ctx context.Context, name string) error {
+	s := getState(ctx)
+	if s.lastHeader.Get(name) != "" {
+		return fmt.Errorf("unexpected header %s: %q", name, s.lastHeader.Get(name))
+	}
+	return nil
+}
+
+func iRememberTheLastModifiedHeader(ctx context.Context) error {
+	s := getState(ctx)
+	s.lastModified = s.lastHeader.Get("Last-Modified")
+	if s.lastModified == "" {
+		return fmt.Errorf("response has no Last-Modified header")
+	}
+	return nil
+}
+
+func aSecondLaterTheKartuscheHasWithContent(ctx context.Context, pth string, content *godog.DocString) error {
+	time.Sleep(time.Second)
+	return theKartuscheHasWithContent(ctx, pth, content)
+}
+
+func theLastModifiedHeaderShouldBeUnchanged(ctx context.Context) error {
+	s := getState(ctx)
+	actual := s.lastHeader.Get("Last-Modified")
+	if actual != s.lastModified {
+		return fmt.Errorf("Last-Modified changed from %q to %q", s.lastModified, actual)
+	}
+	return nil
+}
+
+func theKartuscheReceivesGETRequestForWithRequestID(ctx context.Context, path, requestID string) error {
+	s := getState(ctx)
+	var err error
+	s.lastStatusCode, s.lastHeader, s.lastResponse, err = s.getWithHeader(path, http.Header{"X-Request-Id": []string{requestID}})
+	return err
+}
+
+func theResponseShouldContain(ctx context.Context, expected string) error {
+	s := getState(ctx)
+	if !strings.Contains(s.lastResponse, expected) {
+		return fmt.Errorf("expected response to contain %q, got %q", expected, s.lastResponse)
+	}
+	return nil
+}
+
+func theResponseShouldNotContain(ctx context.Context, unexpected string) error {
+	s := getState(ctx)
+	if strings.Contains(s.lastResponse, unexpected) {
+		return fmt.Errorf("expected response not to contain %q, got %q", unexpected, s.lastResponse)
+	}
+	return nil
+}
+
+func theResponseShouldContainTheRequestID(ctx context.Context) error {
+	s := getState(ctx)
+	requestID := s.lastHeader.Get("X-Request-Id")
+	if requestID == "" {
+		return fmt.Errorf("response has no X-Request-Id header")
+	}
+	return theResponseShouldContain(ctx, requestID)
+}
+
+func theLogEntryShouldHaveSetTo(ctx context.Context, msg, key, expected string) error {
+	s := getState(ctx)
+	entry := s.logs.find(msg)
+	if entry == nil {
+		return fmt.Errorf("log entry %q not found in %v", msg, s.logs.entries)
+	}
+
+	actual := fmt.Sprint(entry[key])
+	if actual != expected {
+		return fmt.Errorf("expected %s of log entry %q to be %q, got %q", key, msg, expected, actual)
+	}
+
+	return nil
+}
+
+func anUpstreamHTTPServer(ctx context.Context) error {
+	s := getState(ctx)
+	s.traceparents = make(chan string, 10)
+	s.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.traceparents <- r.Header.Get("traceparent")
+		w.Write([]byte("ok"))
+	}))
+	return nil
+}
+
+func theKartuscheHasCallingTheUpstreamServerWithContent(ctx context.Context, pth string, content *godog.DocString) error {
+	s := getState(ctx)
+	return s.ti.AddContent(pth, strings.ReplaceAll(content.Content, "UPSTREAM_URL", s.upstream.URL))
+}
+
+func theKartuscheReceivesGETRequestForWithTraceparent(ctx context.Context, path, traceparent string) error {
+	s := getState(ctx)
+	var err error
+	s.lastStatusCode, s.lastHeader, s.lastResponse, err = s.getWithHeader(path, http.Header{"Traceparent": []string{traceparent}})
+	return err
+}
+
+func theSpanShouldBeInTheTrace(ctx context.Context, name, traceID string) error {
+	span, err := getState(ctx).spans.find(name)
+	if err != nil {
+		return err
+	}
+
+	if span.SpanContext().TraceID().String() != traceID {
+		return fmt.Errorf("expected span %q to be in trace %s, got %s", name, traceID, span.SpanContext().TraceID())
+	}
+
+	return nil
+}
+
+func theSpanShouldBeAChildOf(ctx context.Context, name, parentName string) error {
+	s := getState(ctx)
+	span, err := s.spans.find(name)
+	if err != nil {
+		return err
+	}
+
+	parent, err := s.spans.find(parentName)
+	if err != nil {
+		return err
+	}
+
+	if span.SpanContext().TraceID() != parent.SpanContext().TraceID() || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		return fmt.Errorf("expected span %q to be a child of %q", name, parentName)
+	}
+
+	return nil
+}
+
+func theSpanShouldBeInTheTraceOf(ctx context.Context, name, otherName string) error {
+	s := getState(ctx)
+	span, err := s.spans.find(name)
+	if err != nil {
+		return err
+	}
+
+	other, err := s.spans.find(otherName)
+	if err != nil {
+		return err
+	}
+
+	if span.SpanContext().TraceID() != other.SpanContext().TraceID() {
+		return fmt.Errorf("expected span %q to be in the trace of %q", name, otherName)
+	}
+
+	return nil
+}
+
+func theSpanShouldBeAChildOfTheRemoteSpan(ctx context.Context, name, spanID string) error {
+	span, err := getState(ctx).spans.find(name)
+	if err != nil {
+		return err
+	}
+
+	if span.Parent().SpanID().String() != spanID {
+		return fmt.Errorf("expected parent of span %q to be %s, got %s", name, spanID, span.Parent().SpanID())
+	}
+
+	return nil
+}
+
+func theSpanShouldHaveFailedWith(ctx context.Context, name, expected string) error {
+	span, err := getState(ctx).spans.find(name)
+	if err != nil {
+		return err
+	}
+
+	if span.Status().Code != codes.Error {
+		return fmt.Errorf("expected span %q to have failed, got status %v", name, span.Status())
+	}
+
+	// errors are recorded as exception events
+	messages := []string{}
+	for _, e := range span.Events() {
+		for _, a := range e.Attributes {
+			if a.Key == semconv.ExceptionMessageKey {
+				messages = append(messages, a.Value.AsString())
+			}
+		}
+	}
+
+	for _, m := range messages {
+		if strings.Contains(m, expected) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected span %q to have failed with %q, got %q", name, expected, messages)
+}
+
+func theUpstreamServerShouldHaveReceivedTheTraceparentOf(ctx context.Context, name string) error {
+	s := getState(ctx)
+
+	var received string
+	select {
+	case received = <-s.traceparents:
+	case <-time.After(time.Second):
+		return errors.New("upstream server did not receive a request")
+	}
+
+	span, err := s.spans.find(name)
+	if err != nil {
+		return err
+	}
+
+	expected := fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID())
+	if received != expected {
+		return fmt.Errorf("expected traceparent %s, got %q", expected, received)
+	}
+
+	return nil
+}
+
+func theJobShouldHaveSucceeded(ctx context.Context, name string) error {
+	s := getState(ctx)
+	succeededPath := dbpath.ToPath("job-queue", "default", "succeeded")
+
+	for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(20 * time.Millisecond) {
+		succeeded := false
+		err := s.ti.GetRuntime().Read(func(tx bolted.SugaredReadTx) error {
+			if !tx.Exists(succeededPath) {
+				return nil
+			}
+			for it := tx.Iterator(succeededPath); !it.IsDone(); it.Next() {
+				if string(tx.Get(succeededPath.Append(it.GetKey(), "name"))) == name {
+					succeeded = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if succeeded {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("job %q did not succeed", name)
+}
+
+func theUpstreamServerShouldHaveReceivedAnUnsampledTraceparentInTheTrace(ctx context.Context, traceID string) error {
+	s := getState(ctx)
+
+	var received string
+	select {
+	case received = <-s.traceparents:
+	case <-time.After(time.Second):
+		return errors.New("upstream server did not receive a request")
+	}
+
+	parts := strings.Split(received, "-")
+	if len(parts) != 4 || parts[1] != traceID || parts[3] != "00" {
+		return fmt.Errorf("expected unsampled traceparent in trace %s, got %q", traceID, received)
+	}
+
+	return nil
+}
+
+func noSpansShouldHaveBeenRecorded(ctx context.Context) error {
+	ended := getState(ctx).spans.recorder.Ended()
+	if len(ended) != 0 {
+		return fmt.Errorf("expected no spans, got %d", len(ended))
+	}
+	return nil
+}
@@ -3,16 +3,23 @@ package jobs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/dop251/goja"
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/manifest"
 	"github.com/draganm/kartusche/runtime/jslib"
+	"github.com/draganm/kartusche/runtime/metrics"
 	"github.com/draganm/kartusche/runtime/stdlib"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TODO when runtime updated, check if jobs are unfinished, reschedule if so
@@ -25,11 +32,16 @@ var defaultQueueRunning = JobQueuePath.Append("default", "running")
 var defaultQueueFailed = JobQueuePath.Append("default", "failed")
 var defaultQueueSucceeded = JobQueuePath.Append("default", "succeeded")
 
-func JobScheduler(ctx context.Context, db bolted.Database, maxHistorySize uint64, libs *jslib.Libs, logger logr.Logger) {
+func JobScheduler(ctx context.Context, db bolted.Database, maxHistorySize uint64, libs *jslib.Libs, km *metrics.Kartusche, t *tracing.Tracer, logger logr.Logger) {
 
 	logger.Info("job scheduler started")
 	defer logger.Info("job scheduler terminated")
 
+	// running jobs are interrupted when ctx is done,
+	// the scheduler terminates after they have stopped
+	running := new(sync.WaitGroup)
+	defer running.Wait()
+
 	changes, close := db.Observe(defaultQueueScheduled.ToMatcher().AppendAnySubpathMatcher().AppendAnyElementMatcher())
 	defer close()
 
@@ -55,6 +67,12 @@ func JobScheduler(ctx context.Context, db bolted.Database, maxHistorySize uint64
 					name := string(tx.Get(jobPath.Append("name")))
 					params := tx.Get(jobPath.Append("params"))
 
+					// jobs scheduled outside of a trace have no traceparent
+					traceparent := ""
+					if tx.Exists(jobPath.Append("traceparent")) {
+						traceparent = string(tx.Get(jobPath.Append("traceparent")))
+					}
+
 					tx.Delete(jobPath)
 					if !tx.Exists(defaultQueueRunning) {
 						tx.CreateMap(defaultQueueRunning)
@@ -63,7 +81,7 @@ func JobScheduler(ctx context.Context, db bolted.Database, maxHistorySize uint64
 					tx.CreateMap(jobRunningPath)
 					tx.Put(jobRunningPath.Append("name"), []byte(name))
 					tx.Put(jobRunningPath.Append("params"), params)
-					routinesToStart = append(routinesToStart, runJob(ctx, db, maxHistorySize, libs, id, name, params, logger))
+					routinesToStart = append(routinesToStart, runJob(ctx, db, maxHistorySize, libs, id, name, params, traceparent, km, t, logger))
 					return nil
 				}
 				return nil
@@ -75,7 +93,11 @@ func JobScheduler(ctx context.Context, db bolted.Database, maxHistorySize uint64
 			}
 
 			for _, r := range routinesToStart {
-				go r()
+				running.Add(1)
+				go func(r func()) {
+					defer running.Done()
+					r()
+				}(r)
 			}
 
 		case <-ctx.Done():
@@ -84,12 +106,16 @@ func JobScheduler(ctx context.Context, db bolted.Database, maxHistorySize uint64
 	}
 }
 
-func runJob(ctx context.Context, db bolted.Database, maxHistorySize uint64, jslib *jslib.Libs, id, name string, params []byte, logger logr.Logger) func() {
-	logger = logger.WithValues("jobId", id, "name", name)
+func runJob(ctx context.Context, db bolted.Database, maxHistorySize uint64, jslib *jslib.Libs, id, name string, params []byte, traceparent string, km *metrics.Kartusche, t *tracing.Tracer, logger logr.Logger) func() {
+	logger = logger.WithValues("jobId", id, "job", name)
 
 	return func() {
+		start := time.Now()
 		vm := goja.New()
-		stdlib.SetStandardLibMethods(vm, jslib, db, JobsDefinitionsPath, logger)
+
+		// the job run is a part of the trace it was scheduled in
+		ctx, span := t.Start(tracing.ExtractTraceparent(ctx, traceparent), "job "+name, trace.SpanKindInternal)
+		span.SetAttributes(attribute.String("job.id", id))
 
 		var err error
 
@@ -109,12 +135,15 @@ func runJob(ctx context.Context, db bolted.Database, maxHistorySize uint64, jsli
 		logger = logger.WithValues("params", p)
 
 		var src string
+		var m *manifest.Manifest
 
 		jobDefinitionPath := JobsDefinitionsPath.Append(fmt.Sprintf("%s.js", name))
 		err = bolted.SugaredRead(db, func(tx bolted.SugaredReadTx) error {
 
 			src = string(tx.Get(jobDefinitionPath))
-			return nil
+
+			m, err = manifest.FromTx(tx)
+			return err
 		})
 
 		if err != nil {
@@ -122,6 +151,26 @@ func runJob(ctx context.Context, db bolted.Database, maxHistorySize uint64, jsli
 			return
 		}
 
+		stdlib.SetStandardLibMethods(ctx, vm, jslib, db, JobsDefinitionsPath, m.Env, logger)
+
+		stopped := make(chan struct{})
+		defer close(stopped)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				vm.Interrupt(errors.New("job interrupted by shutdown"))
+			case <-stopped:
+			}
+		}()
+
+		if m.Timeouts.Job > 0 {
+			t := time.AfterFunc(m.Timeouts.Job, func() {
+				vm.Interrupt(fmt.Errorf("job did not finish within %s", m.Timeouts.Job))
+			})
+			defer t.Stop()
+		}
+
 		err = func() error {
 			var err error
 			defer func() {
@@ -142,6 +191,9 @@ func runJob(ctx context.Context, db bolted.Database, maxHistorySize uint64, jsli
 			return nil
 		}()
 
+		km.ObserveJob(name, err, time.Since(start))
+		tracing.End(span, err)
+
 		if err != nil {
 			logger.Error(err, "job run failed")
 
@@ -41,9 +41,9 @@ func Load(tx bolted.SugaredReadTx) (*Libs, error) {
 			src := string(it.GetValue())
 			libPath := path.Join([]string(fullPath)...)
 
-			pr, err := goja.Compile(fullPath.String(), fmt.Sprintf(`(() => { var exports = {}; var module = { exports: exports}; %s; return module.exports})()`, src), false)
+			pr, err := Compile(fullPath, src)
 			if err != nil {
-				return nil, fmt.Errorf("while compiling %s: %w", fullPath.String(), err)
+				return nil, err
 			}
 
 			libs.byName[libPath] = &library{
@@ -54,6 +54,15 @@ func Load(tx bolted.SugaredReadTx) (*Libs, error) {
 	return libs, nil
 }
 
+// Compile compiles the source of the library wrapping it into a module.
+func Compile(fullPath dbpath.Path, src string) (*goja.Program, error) {
+	pr, err := goja.Compile(fullPath.String(), fmt.Sprintf(`(() => { var exports = {}; var module = { exports: exports}; %s; return module.exports})()`, src), false)
+	if err != nil {
+		return nil, fmt.Errorf("while compiling %s: %w", fullPath.String(), err)
+	}
+	return pr, nil
+}
+
 func (l *Libs) Require(vm *goja.Runtime) func(name string) (goja.Value, error) {
 	loadedByName := map[string]goja.Value{}
 	return func(name string) (goja.Value, error) {
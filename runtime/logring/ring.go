@@ -0,0 +1,116 @@
+package logring
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry is a captured log entry.
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Name    string                 `json:"name,omitempty"`
+	Message string                 `json:"msg"`
+	Error   string                 `json:"error,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+
+	seq uint64
+}
+
+// Ring keeps a bounded number of the most recent log entries
+// and notifies subscribers about new entries.
+type Ring struct {
+	mu          sync.Mutex
+	entries     []Entry
+	start       int
+	seq         uint64
+	subscribers map[chan Entry]struct{}
+	closed      bool
+}
+
+func New(size int) *Ring {
+	return &Ring{
+		entries:     make([]Entry, 0, size),
+		subscribers: map[chan Entry]struct{}{},
+	}
+}
+
+func (r *Ring) Append(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	e.seq = r.seq
+
+	if len(r.entries) < cap(r.entries) {
+		r.entries = append(r.entries, e)
+	} else {
+		r.entries[r.start] = e
+		r.start = (r.start + 1) % len(r.entries)
+	}
+
+	for c := range r.subscribers {
+		select {
+		case c <- e:
+		default:
+			// slow subscribers miss entries rather than blocking logging
+		}
+	}
+}
+
+// Since returns the retained entries logged at or after t, oldest first.
+func (r *Ring) Since(t time.Time) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.since(t)
+}
+
+func (r *Ring) since(t time.Time) []Entry {
+	res := []Entry{}
+	for i := range r.entries {
+		e := r.entries[(r.start+i)%len(r.entries)]
+		if e.Time.Before(t) {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// Follow returns the retained entries logged at or after t and a channel receiving entries logged afterwards.
+// The channel is closed when the ring is closed, cancel must be called to stop receiving before that.
+func (r *Ring) Follow(t time.Time) ([]Entry, <-chan Entry, func()) {
+	c := make(chan Entry, 256)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		close(c)
+	} else {
+		r.subscribers[c] = struct{}{}
+	}
+
+	return r.since(t), c, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.subscribers, c)
+	}
+}
+
+// Close closes the channels of all followers.
+// Entries appended after Close are still retained.
+func (r *Ring) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	r.closed = true
+	for c := range r.subscribers {
+		close(c)
+		delete(r.subscribers, c)
+	}
+}
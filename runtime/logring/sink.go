@@ -0,0 +1,166 @@
+package logring
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// logr has no warning level, warnings are logged at info level with SeverityKey set to SeverityWarning.
+// The entries of warnings in the ring have the level "warning".
+const (
+	SeverityKey     = "severity"
+	SeverityWarning = "warning"
+)
+
+// Logger returns a logger writing to both next and the ring.
+// Debug entries (V(1)) are captured even if next does not log them.
+func Logger(next logr.Logger, r *Ring) logr.Logger {
+	nextSink := next.GetSink()
+
+	// skip the additional frame of this sink when reporting the caller
+	cd, ok := nextSink.(logr.CallDepthLogSink)
+	if ok {
+		nextSink = cd.WithCallDepth(1)
+	}
+
+	return logr.New(&sink{
+		next: nextSink,
+		ring: r,
+	})
+}
+
+type sink struct {
+	next   logr.LogSink
+	ring   *Ring
+	name   string
+	values []interface{}
+}
+
+// Init does nothing, next has already been initialized by its logger.
+func (s *sink) Init(info logr.RuntimeInfo) {
+}
+
+func (s *sink) nextEnabled(level int) bool {
+	return s.next != nil && s.next.Enabled(level)
+}
+
+func (s *sink) Enabled(level int) bool {
+	return level <= 1 || s.nextEnabled(level)
+}
+
+func (s *sink) Info(level int, msg string, keysAndValues ...interface{}) {
+	if s.nextEnabled(level) {
+		s.next.Info(level, msg, keysAndValues...)
+	}
+
+	if level > 1 {
+		return
+	}
+
+	lvl := "info"
+	if level == 1 {
+		lvl = "debug"
+	}
+
+	s.ring.Append(s.entry(lvl, msg, nil, keysAndValues))
+}
+
+func (s *sink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if s.next != nil {
+		s.next.Error(err, msg, keysAndValues...)
+	}
+
+	s.ring.Append(s.entry("error", msg, err, keysAndValues))
+}
+
+func (s *sink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	values := make([]interface{}, 0, len(s.values)+len(keysAndValues))
+	values = append(values, s.values...)
+	values = append(values, keysAndValues...)
+
+	ns := &sink{
+		ring:   s.ring,
+		name:   s.name,
+		values: values,
+	}
+
+	if s.next != nil {
+		ns.next = s.next.WithValues(keysAndValues...)
+	}
+
+	return ns
+}
+
+func (s *sink) WithName(name string) logr.LogSink {
+	ns := &sink{
+		ring:   s.ring,
+		name:   name,
+		values: s.values,
+	}
+
+	if s.name != "" {
+		ns.name = s.name + "/" + name
+	}
+
+	if s.next != nil {
+		ns.next = s.next.WithName(name)
+	}
+
+	return ns
+}
+
+func (s *sink) entry(level, msg string, err error, keysAndValues []interface{}) Entry {
+	e := Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Name:    s.name,
+		Message: msg,
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	kvs := append(append([]interface{}{}, s.values...), keysAndValues...)
+	if len(kvs) > 0 {
+		e.Fields = map[string]interface{}{}
+	}
+
+	for i := 0; i < len(kvs); i += 2 {
+		key := fmt.Sprint(kvs[i])
+		var v interface{}
+		if i+1 < len(kvs) {
+			v = kvs[i+1]
+		}
+		e.Fields[key] = jsonValue(v)
+	}
+
+	if e.Fields[SeverityKey] == SeverityWarning {
+		e.Level = SeverityWarning
+		delete(e.Fields, SeverityKey)
+	}
+
+	return e
+}
+
+// jsonValue makes sure the value can be marshalled when the entry is read.
+func jsonValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return v
+	case error:
+		return tv.Error()
+	case fmt.Stringer:
+		return tv.String()
+	}
+
+	_, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return v
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const kartuscheLabel = "kartusche"
+
+// Metrics are the Prometheus metrics of all kartusches run by a server,
+// labelled by the name of the kartusche.
+type Metrics struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	staticHits      *prometheus.CounterVec
+	jobs            *prometheus.CounterVec
+	jobDuration     *prometheus.HistogramVec
+	crons           *prometheus.CounterVec
+	cronDuration    *prometheus.HistogramVec
+	websockets      *prometheus.GaugeVec
+}
+
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kartusche_handler_requests_total",
+			Help: "Number of requests served by handlers.",
+		}, []string{kartuscheLabel, "route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kartusche_handler_request_duration_seconds",
+			Help:    "Duration of requests served by handlers.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{kartuscheLabel, "route", "method"}),
+		staticHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kartusche_static_requests_total",
+			Help: "Number of requests served from static files.",
+		}, []string{kartuscheLabel, "status"}),
+		jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kartusche_jobs_total",
+			Help: "Number of finished job runs.",
+		}, []string{kartuscheLabel, "job", "result"}),
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kartusche_job_duration_seconds",
+			Help:    "Duration of job runs.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{kartuscheLabel, "job"}),
+		crons: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kartusche_cronjobs_total",
+			Help: "Number of finished cronjob runs.",
+		}, []string{kartuscheLabel, "cron", "result"}),
+		cronDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kartusche_cronjob_duration_seconds",
+			Help:    "Duration of cronjob runs.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{kartuscheLabel, "cron"}),
+		websockets: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kartusche_websocket_connections",
+			Help: "Number of open websocket connections.",
+		}, []string{kartuscheLabel}),
+	}
+
+	reg.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.staticHits,
+		m.jobs,
+		m.jobDuration,
+		m.crons,
+		m.cronDuration,
+		m.websockets,
+	)
+
+	return m
+}
+
+// ForKartusche returns the metrics of a single kartusche.
+func (m *Metrics) ForKartusche(name string) *Kartusche {
+	l := prometheus.Labels{kartuscheLabel: name}
+	return &Kartusche{
+		requests:        m.requests.MustCurryWith(l),
+		requestDuration: m.requestDuration.MustCurryWith(l),
+		staticHits:      m.staticHits.MustCurryWith(l),
+		jobs:            m.jobs.MustCurryWith(l),
+		jobDuration:     m.jobDuration.MustCurryWith(l),
+		crons:           m.crons.MustCurryWith(l),
+		cronDuration:    m.cronDuration.MustCurryWith(l),
+		websockets:      m.websockets.With(l),
+	}
+}
+
+// Remove removes all metrics of the kartusche, e.g. after it has been deleted.
+func (m *Metrics) Remove(name string) {
+	l := prometheus.Labels{kartuscheLabel: name}
+	m.requests.DeletePartialMatch(l)
+	m.requestDuration.DeletePartialMatch(l)
+	m.staticHits.DeletePartialMatch(l)
+	m.jobs.DeletePartialMatch(l)
+	m.jobDuration.DeletePartialMatch(l)
+	m.crons.DeletePartialMatch(l)
+	m.cronDuration.DeletePartialMatch(l)
+	m.websockets.DeletePartialMatch(l)
+}
+
+// Kartusche are the metrics of a single kartusche.
+// All methods can be called on nil, when the kartusche is run without metrics.
+type Kartusche struct {
+	requests        *prometheus.CounterVec
+	requestDuration prometheus.ObserverVec
+	staticHits      *prometheus.CounterVec
+	jobs            *prometheus.CounterVec
+	jobDuration     prometheus.ObserverVec
+	crons           *prometheus.CounterVec
+	cronDuration    prometheus.ObserverVec
+	websockets      prometheus.Gauge
+}
+
+// ObserveRequest records a request served by the handler of the route.
+func (k *Kartusche) ObserveRequest(route, method string, status int, d time.Duration) {
+	if k == nil {
+		return
+	}
+	k.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	k.requestDuration.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+// ObserveStatic records a request served from a static file.
+func (k *Kartusche) ObserveStatic(status int) {
+	if k == nil {
+		return
+	}
+	k.staticHits.WithLabelValues(strconv.Itoa(status)).Inc()
+}
+
+func (k *Kartusche) ObserveJob(name string, err error, d time.Duration) {
+	if k == nil {
+		return
+	}
+	k.jobs.WithLabelValues(name, result(err)).Inc()
+	k.jobDuration.WithLabelValues(name).Observe(d.Seconds())
+}
+
+func (k *Kartusche) ObserveCron(name string, err error, d time.Duration) {
+	if k == nil {
+		return
+	}
+	k.crons.WithLabelValues(name, result(err)).Inc()
+	k.cronDuration.WithLabelValues(name).Observe(d.Seconds())
+}
+
+func (k *Kartusche) WebsocketOpened() {
+	if k == nil {
+		return
+	}
+	k.websockets.Inc()
+}
+
+func (k *Kartusche) WebsocketClosed() {
+	if k == nil {
+		return
+	}
+	k.websockets.Dec()
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	"time"
+
+	"github.com/draganm/kartusche/runtime/metrics"
+	"github.com/draganm/kartusche/runtime/tracing"
+)
+
+type options struct {
+	devMode bool
+	metrics *metrics.Kartusche
+	tracer  *tracing.Tracer
+
+	shutdownTimeout time.Duration
+}
+
+type Option func(o *options)
+
+// WithDevMode makes failing handlers respond with the stack trace,
+// the source lines around the error and the request details.
+// It should only be used by the development server.
+func WithDevMode() Option {
+	return func(o *options) {
+		o.devMode = true
+	}
+}
+
+// WithMetrics records metrics of handlers, static files, jobs, cronjobs and websockets.
+func WithMetrics(m *metrics.Kartusche) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithTracer records spans of handlers, DB transactions, templates, `http_do` calls, jobs and cronjobs.
+func WithTracer(t *tracing.Tracer) Option {
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+// WithShutdownTimeout limits how long Shutdown waits for running cron jobs and jobs,
+// it defaults to DefaultShutdownTimeout.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.shutdownTimeout = d
+	}
+}
@@ -0,0 +1,39 @@
+package runtime
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+const maxRequestIDLength = 128
+
+// ensureRequestID makes sure the request has an id, correlating the response with log entries.
+// Ids provided by the client (e.g. a reverse proxy) are kept.
+func ensureRequestID(w http.ResponseWriter, req *http.Request) string {
+	id := req.Header.Get(requestIDHeader)
+	if !validRequestID(id) {
+		id = uuid.Must(uuid.NewV4()).String()
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	w.Header().Set(requestIDHeader, id)
+
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
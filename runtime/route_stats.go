@@ -0,0 +1,196 @@
+package runtime
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	routeKindHandler = "handler"
+	routeKindStatic  = "static"
+)
+
+// routeSamples is the number of most recent durations used to compute the latency percentiles of a route.
+const routeSamples = 1000
+
+// RouteStats are the request counters of a single handler or static file.
+// Requests responded with a 5xx status are counted as errors.
+type RouteStats struct {
+	Kind    string        `json:"kind" yaml:"kind"`
+	Method  string        `json:"method" yaml:"method"`
+	Route   string        `json:"route" yaml:"route"`
+	Hits    int           `json:"hits" yaml:"hits"`
+	Errors  int           `json:"errors" yaml:"errors"`
+	P50     time.Duration `json:"p50" yaml:"p50"`
+	P95     time.Duration `json:"p95" yaml:"p95"`
+	LastHit *time.Time    `json:"last_hit,omitempty" yaml:"last_hit,omitempty"`
+}
+
+type routeKey struct {
+	kind   string
+	method string
+	route  string
+}
+
+type routeCounter struct {
+	mu        sync.Mutex
+	hits      int
+	errors    int
+	lastHit   time.Time
+	durations []time.Duration
+	next      int
+}
+
+func (c *routeCounter) observe(status int, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hits++
+	if status >= 500 {
+		c.errors++
+	}
+	c.lastHit = time.Now()
+
+	if len(c.durations) < routeSamples {
+		c.durations = append(c.durations, d)
+		return
+	}
+
+	c.durations[c.next] = d
+	c.next = (c.next + 1) % routeSamples
+}
+
+func (c *routeCounter) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hits = 0
+	c.errors = 0
+	c.lastHit = time.Time{}
+	c.durations = nil
+	c.next = 0
+}
+
+func (c *routeCounter) stats(k routeKey) RouteStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rs := RouteStats{
+		Kind:   k.kind,
+		Method: k.method,
+		Route:  k.route,
+		Hits:   c.hits,
+		Errors: c.errors,
+	}
+
+	if !c.lastHit.IsZero() {
+		lastHit := c.lastHit
+		rs.LastHit = &lastHit
+	}
+
+	if len(c.durations) > 0 {
+		sorted := append([]time.Duration{}, c.durations...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		rs.P50 = percentile(sorted, 50)
+		rs.P95 = percentile(sorted, 95)
+	}
+
+	return rs
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	idx := (len(sorted)*p+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// routeStats holds the counters of all routes of the current router.
+type routeStats struct {
+	mu     sync.Mutex
+	routes map[routeKey]*routeCounter
+}
+
+func newRouteStats() *routeStats {
+	return &routeStats{routes: map[routeKey]*routeCounter{}}
+}
+
+// newTable returns a table for the routes of a new router.
+// Counters of the routes that already exist are carried over.
+func (s *routeStats) newTable() *routeTable {
+	return &routeTable{
+		stats:  s,
+		routes: map[routeKey]*routeCounter{},
+	}
+}
+
+// activate replaces the routes with the ones of the table,
+// dropping the counters of routes that don't exist anymore.
+func (s *routeStats) activate(t *routeTable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = t.routes
+}
+
+func (s *routeStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.routes {
+		c.reset()
+	}
+}
+
+func (s *routeStats) list() []RouteStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := make([]RouteStats, 0, len(s.routes))
+	for k, c := range s.routes {
+		l = append(l, c.stats(k))
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		a, b := l[i], l[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.Method < b.Method
+	})
+
+	return l
+}
+
+// routeTable collects the counters of the routes while a router is being initialized.
+type routeTable struct {
+	stats  *routeStats
+	routes map[routeKey]*routeCounter
+}
+
+func (t *routeTable) counter(kind, method, route string) *routeCounter {
+	k := routeKey{kind: kind, method: method, route: route}
+
+	c, found := t.routes[k]
+	if found {
+		return c
+	}
+
+	t.stats.mu.Lock()
+	c, found = t.stats.routes[k]
+	t.stats.mu.Unlock()
+
+	if !found {
+		c = &routeCounter{}
+	}
+
+	t.routes[k] = c
+
+	return c
+}
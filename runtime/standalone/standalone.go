@@ -0,0 +1,109 @@
+package standalone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/draganm/kartusche/runtime"
+	"github.com/draganm/kartusche/runtime/tracing"
+	"github.com/go-logr/logr"
+	"go.uber.org/multierr"
+)
+
+const DefaultShutdownTimeout = 30 * time.Second
+
+type Options struct {
+	// Addr is the `[<hostname|ip>]:<port>` the HTTP server will bind to.
+	Addr string
+
+	// TLSCertFile and TLSKeyFile enable serving HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// ShutdownTimeout limits how long in-flight requests are drained
+	// after ctx is cancelled, and then how long running cron jobs and jobs are waited for.
+	ShutdownTimeout time.Duration
+
+	// Tracer records spans of the kartusche, if set.
+	Tracer *tracing.Tracer
+}
+
+// Serve opens the kartusche file and serves it over HTTP until ctx is cancelled.
+// On cancellation, in-flight requests are drained and the runtime (including cron and jobs)
+// is shut down before returning.
+func Serve(ctx context.Context, fileName string, opts Options, log logr.Logger) (err error) {
+
+	if (opts.TLSCertFile == "") != (opts.TLSKeyFile == "") {
+		return errors.New("both TLS certificate and key files must be provided")
+	}
+
+	rt, err := runtime.Open(fileName, log, runtime.WithTracer(opts.Tracer), runtime.WithShutdownTimeout(opts.ShutdownTimeout))
+	if err != nil {
+		return fmt.Errorf("while starting runtime: %w", err)
+	}
+
+	defer func() {
+		e := rt.Shutdown()
+		if e != nil {
+			err = multierr.Append(err, fmt.Errorf("while shutting down runtime: %w", e))
+		}
+	}()
+
+	l, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return fmt.Errorf("while creating listener: %w", err)
+	}
+
+	s := &http.Server{
+		Handler: rt,
+	}
+
+	serveErr := make(chan error, 1)
+
+	scheme := "http"
+	if opts.TLSCertFile != "" {
+		scheme = "https"
+	}
+
+	log.Info("listening for HTTP requests", "url", fmt.Sprintf("%s://%s/", scheme, l.Addr().String()))
+
+	go func() {
+		if opts.TLSCertFile != "" {
+			serveErr <- s.ServeTLS(l, opts.TLSCertFile, opts.TLSKeyFile)
+			return
+		}
+		serveErr <- s.Serve(l)
+	}()
+
+	select {
+	case err = <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info("shutting down")
+
+	shutdownCtx := context.Background()
+	if opts.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, opts.ShutdownTimeout)
+		defer cancel()
+	}
+
+	err = s.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("while draining HTTP requests: %w", err)
+	}
+
+	err = <-serveErr
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+
+}
@@ -2,21 +2,20 @@ package runtime
 
 import (
 	"bytes"
-	"crypto/sha1"
 	"fmt"
-	"mime"
+	"io"
 	"net/http"
 	"path"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/manifest"
 	"github.com/gorilla/mux"
 )
 
-func addStaticHandlers(r *mux.Router, tx bolted.SugaredReadTx) error {
-	staticPath := dbpath.ToPath("static")
+func addStaticHandlers(r *mux.Router, tx bolted.SugaredReadTx, db bolted.Database, m *manifest.Manifest, o options, routes *routeTable) error {
 	if !tx.Exists(staticPath) {
 		return nil
 	}
@@ -37,15 +36,22 @@ func addStaticHandlers(r *mux.Router, tx bolted.SugaredReadTx) error {
 			fullPathWithoutStatic := []string(fullPath)[1:]
 			requestPath := "/" + path.Join(fullPathWithoutStatic...)
 
-			handler, err := staticContentHandler(fullPath, tx, requestPath)
+			contentHandler, err := staticContentHandler(tx, db, path.Join(fullPathWithoutStatic...), m.Static)
 			if err != nil {
 				return fmt.Errorf("while creating static handler for %s: %w", requestPath, err)
 			}
-			r.Methods("GET").Path(requestPath).HandlerFunc(handler)
+
+			counter := routes.counter(routeKindStatic, "GET", requestPath)
+			handler := instrumented(contentHandler, func(status int, d time.Duration) {
+				o.metrics.ObserveStatic(status)
+				counter.observe(status, d)
+			})
+
+			r.Methods("GET").Path(requestPath).Handler(handler)
 
 			if key == "index.html" {
 				indexRequestPath := "/" + path.Join(fullPathWithoutStatic[:len(fullPathWithoutStatic)-1]...)
-				r.Methods("GET").Path(indexRequestPath).HandlerFunc(handler)
+				r.Methods("GET").Path(indexRequestPath).Handler(handler)
 			}
 
 		}
@@ -55,26 +61,75 @@ func addStaticHandlers(r *mux.Router, tx bolted.SugaredReadTx) error {
 
 }
 
-func staticContentHandler(dbPath dbpath.Path, tx bolted.SugaredReadTx, name string) (http.HandlerFunc, error) {
-	t := time.Now()
+// staticContentHandler serves the static file with the given path within `static`,
+// using the precompressed variant accepted by the client, if any.
+// Files larger than the configured limit are read from the database for every request
+// instead of being kept in memory.
+func staticContentHandler(tx bolted.SugaredReadTx, db bolted.Database, name string, cfg manifest.Static) (http.HandlerFunc, error) {
+	info, err := readStaticFileInfo(tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	contentPath := staticPath.Append(strings.Split(name, "/")...)
 
-	d := tx.Get(dbPath)
+	variantPath := func(enc string) dbpath.Path {
+		if enc == "" {
+			return contentPath
+		}
+		return staticFileMetaPath(name).Append(enc)
+	}
 
-	var contentType string
+	var content func(enc string) (io.ReadSeeker, error)
 
-	ext := filepath.Ext(dbPath.String())
-	if ext == "" {
-		contentType = http.DetectContentType(d)
+	if info.Size > cfg.CacheSizeLimit() {
+		content = func(enc string) (io.ReadSeeker, error) {
+			return newDBContentReader(db, variantPath(enc), name, info.ETag)
+		}
 	} else {
-		contentType = mime.TypeByExtension(ext)
+		variants := map[string][]byte{}
+		for _, enc := range append([]string{""}, info.Encodings...) {
+			variants[enc] = tx.Get(variantPath(enc))
+		}
+		content = func(enc string) (io.ReadSeeker, error) {
+			return bytes.NewReader(variants[enc]), nil
+		}
 	}
 
-	sum := sha1.Sum(d)
-	etag := fmt.Sprintf(`"%x"`, sum[:])
+	cacheControl := cfg.CacheControlFor(name)
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("content-type", contentType)
-		w.Header().Set("etag", etag)
-		http.ServeContent(w, r, name, t, bytes.NewReader(d))
+		h := w.Header()
+
+		if info.ContentType != "" {
+			h.Set("content-type", info.ContentType)
+		}
+
+		if len(info.Encodings) > 0 {
+			h.Add("vary", "Accept-Encoding")
+		}
+
+		// headers from the manifest take precedence
+		if cacheControl != "" && h.Get("cache-control") == "" {
+			h.Set("cache-control", cacheControl)
+		}
+
+		etag := info.ETag
+
+		enc := acceptedEncoding(r, info.Encodings)
+
+		rs, err := content(enc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if enc != "" {
+			etag = etag + "-" + enc
+			h.Set("content-encoding", enc)
+		}
+
+		h.Set("etag", fmt.Sprintf("%q", etag))
+		http.ServeContent(w, r, name, info.ModTime, rs)
 	}, nil
 }
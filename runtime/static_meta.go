@@ -0,0 +1,229 @@
+package runtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+)
+
+// staticMetaPath contains metadata and precompressed variants of the static files,
+// keyed by the slash separated path of the file within `static`.
+var staticMetaPath = dbpath.ToPath("static-meta")
+
+// minCompressSize is the size below which static files are not compressed.
+const minCompressSize = 256
+
+// maxCompressSize is the size above which static files are not compressed,
+// compression runs in the transaction updating the code.
+const maxCompressSize = 4 * 1024 * 1024
+
+// Compression levels trade size for the time it takes to update the code.
+const (
+	brotliLevel = 5
+	gzipLevel   = gzip.DefaultCompression
+)
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+type staticFileInfo struct {
+	ETag        string    `json:"etag"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	ContentType string    `json:"contentType"`
+	// Encodings are the available precompressed variants, in the order of preference.
+	Encodings []string `json:"encodings,omitempty"`
+}
+
+func staticFileMetaPath(name string) dbpath.Path {
+	return staticMetaPath.Append(name)
+}
+
+// updateStaticMeta brings the metadata and precompressed variants in line with the static files.
+// Metadata of unchanged files, including the modification time, is kept.
+func updateStaticMeta(tx bolted.SugaredWriteTx) error {
+
+	files := map[string][]byte{}
+	forEachFile(tx, staticPath, func(p dbpath.Path, d []byte) {
+		files[path.Join(p[1:]...)] = d
+	})
+
+	if !tx.Exists(staticMetaPath) {
+		tx.CreateMap(staticMetaPath)
+	}
+
+	toDelete := []dbpath.Path{}
+	for it := tx.Iterator(staticMetaPath); !it.IsDone(); it.Next() {
+		_, found := files[it.GetKey()]
+		if !found {
+			toDelete = append(toDelete, staticFileMetaPath(it.GetKey()))
+		}
+	}
+
+	for _, p := range toDelete {
+		tx.Delete(p)
+	}
+
+	for name, d := range files {
+		sum := sha1.Sum(d)
+		etag := fmt.Sprintf("%x", sum[:])
+
+		mp := staticFileMetaPath(name)
+
+		if tx.Exists(mp) {
+			info, err := readStaticFileInfo(tx, name)
+			if err == nil && info.ETag == etag {
+				continue
+			}
+			tx.Delete(mp)
+		}
+
+		info := staticFileInfo{
+			ETag:        etag,
+			Size:        int64(len(d)),
+			ModTime:     time.Now().UTC().Truncate(time.Second),
+			ContentType: contentTypeOf(name, d),
+		}
+
+		tx.CreateMap(mp)
+
+		if isCompressible(info.ContentType) && len(d) >= minCompressSize && len(d) <= maxCompressSize {
+			for _, enc := range []string{encodingBrotli, encodingGzip} {
+				compressed, err := compress(enc, d)
+				if err != nil {
+					return fmt.Errorf("while compressing %s: %w", name, err)
+				}
+
+				if len(compressed) >= len(d) {
+					continue
+				}
+
+				tx.Put(mp.Append(enc), compressed)
+				info.Encodings = append(info.Encodings, enc)
+			}
+		}
+
+		infoJSON, err := json.Marshal(info)
+		if err != nil {
+			return fmt.Errorf("while marshalling info of %s: %w", name, err)
+		}
+
+		tx.Put(mp.Append("info"), infoJSON)
+	}
+
+	return nil
+}
+
+func readStaticFileInfo(tx bolted.SugaredReadTx, name string) (*staticFileInfo, error) {
+	p := staticFileMetaPath(name).Append("info")
+	if !tx.Exists(p) {
+		return nil, fmt.Errorf("metadata of static file %s not found", name)
+	}
+
+	info := &staticFileInfo{}
+	err := json.Unmarshal(tx.Get(p), info)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing metadata of static file %s: %w", name, err)
+	}
+
+	return info, nil
+}
+
+func contentTypeOf(name string, d []byte) string {
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		return http.DetectContentType(d)
+	}
+	return contentType
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+xml"), strings.HasSuffix(mediaType, "+json"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml", "application/wasm", "image/svg+xml", "font/ttf", "font/otf":
+		return true
+	}
+
+	return false
+}
+
+func compress(encoding string, d []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	var err error
+	switch encoding {
+	case encodingBrotli:
+		bw := brotli.NewWriterLevel(buf, brotliLevel)
+		_, err = bw.Write(d)
+		if err == nil {
+			err = bw.Close()
+		}
+	case encodingGzip:
+		gw, _ := gzip.NewWriterLevel(buf, gzipLevel)
+		_, err = gw.Write(d)
+		if err == nil {
+			err = gw.Close()
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", encoding)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// acceptedEncoding returns the first of the available encodings accepted by the client,
+// or an empty string if the content should not be encoded.
+func acceptedEncoding(r *http.Request, available []string) string {
+	if len(available) == 0 {
+		return ""
+	}
+
+	accepted := map[string]bool{}
+	for _, v := range r.Header.Values("accept-encoding") {
+		for _, part := range strings.Split(v, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			params = strings.TrimSpace(params)
+			if strings.HasPrefix(params, "q=") {
+				qv, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+				if err != nil || qv == 0 {
+					continue
+				}
+			}
+			accepted[strings.ToLower(strings.TrimSpace(coding))] = true
+		}
+	}
+
+	for _, enc := range available {
+		if accepted[enc] {
+			return enc
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+)
+
+var errStaticFileChanged = errors.New("static file changed while reading")
+
+// dbContentReader reads a value from the database, one read transaction per Read call,
+// without keeping the whole value in memory.
+// Reading fails if the content of the static file changes between the calls.
+type dbContentReader struct {
+	db     bolted.Database
+	path   dbpath.Path
+	name   string
+	etag   string
+	size   int64
+	offset int64
+}
+
+func newDBContentReader(db bolted.Database, p dbpath.Path, name, etag string) (*dbContentReader, error) {
+	r := &dbContentReader{
+		db:   db,
+		path: p,
+		name: name,
+		etag: etag,
+	}
+
+	err := r.withValue(func(v []byte) error {
+		r.size = int64(len(v))
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// withValue calls fn with the value, which is only valid during the call.
+func (r *dbContentReader) withValue(fn func(v []byte) error) error {
+	return bolted.SugaredRead(r.db, func(tx bolted.SugaredReadTx) error {
+		info, err := readStaticFileInfo(tx, r.name)
+		if err != nil {
+			return err
+		}
+
+		if info.ETag != r.etag {
+			return errStaticFileChanged
+		}
+
+		key := r.path[len(r.path)-1]
+
+		// values returned by the iterator are not copied
+		it := tx.Iterator(r.path[:len(r.path)-1])
+		it.Seek(key)
+		if it.IsDone() || it.GetKey() != key {
+			return errStaticFileChanged
+		}
+
+		return fn(it.GetValue())
+	})
+}
+
+func (r *dbContentReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	var n int
+	err := r.withValue(func(v []byte) error {
+		if int64(len(v)) != r.size {
+			return errStaticFileChanged
+		}
+		n = copy(p, v[r.offset:])
+		return nil
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("while reading %s: %w", r.name, err)
+	}
+
+	r.offset += int64(n)
+
+	return n, nil
+}
+
+func (r *dbContentReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	r.offset = offset
+
+	return offset, nil
+}
@@ -0,0 +1,68 @@
+package stdlib
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/dop251/goja"
+	"github.com/draganm/kartusche/runtime/logring"
+	"github.com/go-logr/logr"
+)
+
+// newLog creates the `log` object of the JS code.
+// Fields are logged in addition to the context (kartusche, handler, job, ...) of the logger.
+func newLog(vm *goja.Runtime, logger logr.Logger) map[string]interface{} {
+	return map[string]interface{}{
+		"debug": func(msg string, fields goja.Value) {
+			logger.V(1).Info(msg, keysAndValues(vm, fields)...)
+		},
+		"info": func(msg string, fields goja.Value) {
+			logger.Info(msg, keysAndValues(vm, fields)...)
+		},
+		"warn": func(msg string, fields goja.Value) {
+			logger.Info(msg, append([]interface{}{logring.SeverityKey, logring.SeverityWarning}, keysAndValues(vm, fields)...)...)
+		},
+		"error": func(msg string, fields goja.Value) {
+			var err error
+			kv := []interface{}{}
+			fkv := keysAndValues(vm, fields)
+			for i := 0; i < len(fkv); i += 2 {
+				if fkv[i] == "error" {
+					err = errors.New(fkv[i+1].(string))
+					continue
+				}
+				kv = append(kv, fkv[i], fkv[i+1])
+			}
+			logger.Error(err, msg, kv...)
+		},
+	}
+}
+
+// keysAndValues converts the fields object into sorted logr key/value pairs.
+// JS errors are logged as their message, the value of `error` is always a string.
+func keysAndValues(vm *goja.Runtime, fields goja.Value) []interface{} {
+	if fields == nil || goja.IsUndefined(fields) || goja.IsNull(fields) {
+		return nil
+	}
+
+	obj := fields.ToObject(vm)
+	keys := obj.Keys()
+	sort.Strings(keys)
+
+	kv := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		v := obj.Get(k)
+
+		var value interface{}
+		o, isObject := v.(*goja.Object)
+		switch {
+		case isObject && o.ClassName() == "Error", k == "error":
+			value = v.String()
+		default:
+			value = v.Export()
+		}
+
+		kv = append(kv, k, value)
+	}
+	return kv
+}
@@ -1,6 +1,7 @@
 package stdlib
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net/url"
@@ -16,21 +17,28 @@ import (
 	"github.com/gofrs/uuid"
 )
 
-func SetStandardLibMethods(vm *goja.Runtime, jslib *jslib.Libs, db bolted.Database, handlerParentPath dbpath.Path, logger logr.Logger) {
-	dbw := dbwrapper.New(db, vm, logger)
+// SetStandardLibMethods sets the globals available to all JS code.
+// Spans of DB transactions, templates and HTTP requests are children of the span in ctx.
+func SetStandardLibMethods(ctx context.Context, vm *goja.Runtime, jslib *jslib.Libs, db bolted.Database, handlerParentPath dbpath.Path, env map[string]string, logger logr.Logger) {
+	if env == nil {
+		env = map[string]string{}
+	}
+	dbw := dbwrapper.New(ctx, db, vm, logger)
 	vm.SetFieldNameMapper(newSmartCapFieldNameMapper())
 	vm.Set("require", jslib.Require(vm))
 	vm.Set("println", fmt.Println)
 	vm.Set("read", dbw.Read)
 	vm.Set("write", dbw.Write)
-	vm.Set("http_do", httprequest.Request)
-	vm.Set("render_template_to_s", template.RenderTemplateToString(db, handlerParentPath))
+	vm.Set("http_do", httprequest.Request(ctx))
+	vm.Set("render_template_to_s", template.RenderTemplateToString(ctx, db, handlerParentPath))
 	vm.Set("pathEscape", url.PathEscape)
 	vm.Set("pathUnescape", url.PathUnescape)
 	vm.Set("queryEscape", url.QueryEscape)
 	vm.Set("parseUrl", url.Parse)
 	vm.Set("queryUnescape", url.QueryEscape)
 	vm.Set("base64", base64.StdEncoding)
+	vm.Set("env", env)
+	vm.Set("log", newLog(vm, logger))
 
 	vm.Set("uuidv4", func() (string, error) {
 		id, err := uuid.NewV4()
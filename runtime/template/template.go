@@ -1,6 +1,7 @@
 package template
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -8,6 +9,9 @@ import (
 	"github.com/cbroglie/mustache"
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/runtime/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var basePath = dbpath.ToPath("templates")
@@ -44,9 +48,14 @@ func (pp *partialsProvider) Get(name string) (string, error) {
 
 }
 
-func RenderTemplate(db bolted.Database, currentPath dbpath.Path, w io.Writer) func(name string, data interface{}) error {
+func RenderTemplate(ctx context.Context, db bolted.Database, currentPath dbpath.Path, w io.Writer) func(name string, data interface{}) error {
 
-	return func(name string, data interface{}) error {
+	return func(name string, data interface{}) (err error) {
+		_, span := tracing.Start(ctx, "render template", trace.SpanKindInternal)
+		span.SetAttributes(attribute.String("template.name", name))
+		defer func() {
+			tracing.End(span, err)
+		}()
 
 		if data == nil {
 			data = map[string]interface{}{}
@@ -67,9 +76,14 @@ func RenderTemplate(db bolted.Database, currentPath dbpath.Path, w io.Writer) fu
 
 }
 
-func RenderTemplateToString(db bolted.Database, currentPath dbpath.Path) func(name string, data interface{}) (string, error) {
+func RenderTemplateToString(ctx context.Context, db bolted.Database, currentPath dbpath.Path) func(name string, data interface{}) (string, error) {
 
 	return func(name string, data interface{}) (s string, err error) {
+		_, span := tracing.Start(ctx, "render template", trace.SpanKindInternal)
+		span.SetAttributes(attribute.String("template.name", name))
+		defer func() {
+			tracing.End(span, err)
+		}()
 
 		if data == nil {
 			data = map[string]interface{}{}
@@ -58,7 +58,8 @@ func (tk *testKartuscheInstance) AddContent(pth, content string) error {
 	})
 }
 
-func StartTestKartuscheInstance(ctx context.Context) (TestKartuscheInstance, error) {
+// StartTestKartuscheInstance starts a new empty kartusche, logging to the logger from ctx.
+func StartTestKartuscheInstance(ctx context.Context, opts ...runtime.Option) (TestKartuscheInstance, error) {
 
 	td, err := os.MkdirTemp("", "")
 
@@ -73,7 +74,7 @@ func StartTestKartuscheInstance(ctx context.Context) (TestKartuscheInstance, err
 		return nil, fmt.Errorf("could not initialize empty kartusche: %w", err)
 	}
 
-	rt, err := runtime.Open(dbpath, logr.Discard())
+	rt, err := runtime.Open(dbpath, logr.FromContextOrDiscard(ctx), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("could not open new runtime: %w", err)
 	}
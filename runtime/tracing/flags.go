@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/urfave/cli/v2"
+)
+
+// TraceFileFlag and OTLPEndpointFlag configure the export of spans
+// for the commands running kartusches, see NewFromFlags.
+var TraceFileFlag = &cli.StringFlag{
+	Name:    "trace-file",
+	Usage:   "append spans as newline delimited JSON to this file",
+	EnvVars: []string{"KARTUSCHE_TRACE_FILE"},
+}
+
+var OTLPEndpointFlag = &cli.StringFlag{
+	Name:    "otlp-endpoint",
+	Usage:   "export spans to this OTLP/HTTP collector, e.g. http://localhost:4318",
+	EnvVars: []string{"KARTUSCHE_OTLP_ENDPOINT"},
+}
+
+// NewFromFlags returns the tracer configured by TraceFileFlag and OTLPEndpointFlag.
+// It returns nil if tracing is not enabled.
+func NewFromFlags(c *cli.Context, log logr.Logger) (*Tracer, error) {
+	tracer, err := NewFromConfig(c.String(TraceFileFlag.Name), c.String(OTLPEndpointFlag.Name), func(err error) {
+		log.Error(err, "while exporting spans")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while starting tracing: %w", err)
+	}
+	return tracer, nil
+}
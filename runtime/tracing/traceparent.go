@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const traceparentHeader = "traceparent"
+
+var propagator = propagation.TraceContext{}
+
+// Extract returns a context with the remote parent from the `traceparent` header of an incoming request.
+// Spans started by a Tracer with this context are children of the remote span.
+// Invalid headers are ignored.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// ExtractTraceparent is like Extract, for a `traceparent` value stored elsewhere, e.g. with a scheduled job.
+func ExtractTraceparent(ctx context.Context, traceparent string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier{traceparentHeader: traceparent})
+}
+
+// Traceparent returns the `traceparent` value of the span in ctx, or an empty string if there is none.
+func Traceparent(ctx context.Context) string {
+	c := propagation.MapCarrier{}
+	propagator.Inject(ctx, c)
+	return c[traceparentHeader]
+}
+
+// Inject sets the `traceparent` header of an outgoing request to the span in ctx.
+// The header carries the sampling decision of the span.
+func Inject(ctx context.Context, h http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(h))
+}
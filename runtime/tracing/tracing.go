@@ -0,0 +1,195 @@
+// Package tracing records spans of handlers, database transactions, templates,
+// outgoing HTTP requests, jobs and cronjobs using OpenTelemetry.
+// Spans are propagated using the W3C `traceparent` header and exported
+// as newline delimited JSON or to an OTLP/HTTP collector.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/multierr"
+)
+
+// serviceName is the `service.name` resource attribute of exported spans.
+const serviceName = "kartusche"
+
+const instrumentationName = "github.com/draganm/kartusche/runtime/tracing"
+
+// Tracer starts spans, adding its attributes to every span.
+// All methods can be called on nil, in which case no spans are recorded.
+type Tracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	attributes []attribute.KeyValue
+	closers    []func() error
+}
+
+// New returns a tracer recording spans with a tracer provider configured by opts,
+// e.g. sdktrace.WithBatcher(exporter).
+// Spans are sampled unless the remote parent was not sampled.
+func New(opts ...sdktrace.TracerProviderOption) *Tracer {
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	}, opts...)
+
+	provider := sdktrace.NewTracerProvider(opts...)
+
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer(instrumentationName),
+	}
+}
+
+// With returns a tracer adding the attribute to every span it starts.
+func (t *Tracer) With(key, value string) *Tracer {
+	if t == nil {
+		return nil
+	}
+
+	attributes := append([]attribute.KeyValue{}, t.attributes...)
+	attributes = append(attributes, attribute.String(key, value))
+
+	return &Tracer{
+		provider:   t.provider,
+		tracer:     t.tracer,
+		attributes: attributes,
+	}
+}
+
+// Shutdown exports the remaining spans and shuts the exporters down.
+func (t *Tracer) Shutdown() error {
+	if t == nil {
+		return nil
+	}
+
+	err := t.provider.Shutdown(context.Background())
+	for _, c := range t.closers {
+		err = multierr.Append(err, c())
+	}
+
+	return err
+}
+
+type contextKey int
+
+const tracerKey contextKey = iota
+
+// Start starts a span that is a child of the span in ctx, or of the remote span
+// extracted from an incoming request. Otherwise a new trace is started.
+func (t *Tracer) Start(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(t.attributes...))
+	return context.WithValue(ctx, tracerKey, t), span
+}
+
+// Start starts a child span of the span in ctx.
+// Without a span started by a Tracer in ctx, nothing is recorded.
+func Start(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	t, _ := ctx.Value(tracerKey).(*Tracer)
+	return t.Start(ctx, name, kind)
+}
+
+// RecordError marks the span as failed.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// NewFromConfig returns a tracer exporting to the file and/or the OTLP endpoint.
+// When neither is set, tracing is disabled and nil is returned.
+// Errors exporting spans are passed to onError.
+func NewFromConfig(fileName, otlpEndpoint string, onError func(err error)) (*Tracer, error) {
+	opts := []sdktrace.TracerProviderOption{}
+	closers := []func() error{}
+
+	if fileName != "" {
+		f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("while opening trace file: %w", err)
+		}
+
+		fe, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("while creating file exporter: %w", err)
+		}
+
+		opts = append(opts, sdktrace.WithBatcher(fe))
+		closers = append(closers, f.Close)
+	}
+
+	if otlpEndpoint != "" {
+		oe, err := newOTLPExporter(otlpEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(oe))
+	}
+
+	if len(opts) == 0 {
+		return nil, nil
+	}
+
+	if onError != nil {
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(onError))
+	}
+
+	t := New(opts...)
+	t.closers = closers
+
+	return t, nil
+}
+
+// newOTLPExporter returns an exporter for the collector at endpoint, e.g. `http://localhost:4318`.
+func newOTLPExporter(endpoint string) (*otlptrace.Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing OTLP endpoint: %w", err)
+	}
+
+	urlPath := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(urlPath, "/v1/traces") {
+		urlPath += "/v1/traces"
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(urlPath),
+	}
+
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("unsupported OTLP endpoint scheme %q", u.Scheme)
+	}
+
+	return otlptracehttp.New(context.Background(), opts...)
+}
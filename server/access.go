@@ -0,0 +1,353 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/gorilla/mux"
+)
+
+// accessPath contains the users granted access to a kartusche, under access/<kartusche>/<user id>.
+var accessPath = dbpath.ToPath("access")
+
+// Role determines what a user can do with a kartusche, every role includes the permissions of the previous one:
+// viewers can read info, logs, failures and versions and mount the kartusche read-only over WebDAV,
+// developers can update, roll back and dump the code and write code over WebDAV,
+// admins can delete the kartusche, write data over WebDAV and grant access to other users.
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleDeveloper Role = "developer"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer:    1,
+	RoleDeveloper: 2,
+	RoleAdmin:     3,
+}
+
+func (r Role) IsValid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// includes checks if the role has all permissions of the other role.
+func (r Role) includes(other Role) bool {
+	return roleRanks[r] >= roleRanks[other]
+}
+
+// User is a user that has logged in to the server.
+type User struct {
+	ID          string    `json:"id"`
+	Email       string    `json:"email,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// Grant gives a user who is not the owner access to a kartusche.
+// Grants without a role were made before roles existed and give the developer role.
+type Grant struct {
+	UserID    string    `json:"user_id"`
+	Role      Role      `json:"role,omitempty"`
+	GrantedBy string    `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+type GrantRequest struct {
+	Role Role `json:"role"`
+}
+
+// KartuscheAccess lists the users with access to a kartusche.
+// The owner has the admin role.
+// Kartusches uploaded before ownership was recorded have no owner and no user has access, until the server assigns them to the legacy owner.
+type KartuscheAccess struct {
+	Owner  string  `json:"owner,omitempty"`
+	Grants []Grant `json:"grants"`
+}
+
+// recordLogin creates or updates the user.
+func recordLogin(tx bolted.SugaredWriteTx, userID, email string) error {
+	u := User{
+		ID:        userID,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+
+	userPath := usersPath.Append(userID)
+	if tx.Exists(userPath) {
+		err := json.Unmarshal(tx.Get(userPath), &u)
+		if err != nil {
+			return fmt.Errorf("while unmarshalling user %s: %w", userID, err)
+		}
+		u.Email = email
+	}
+
+	u.LastLoginAt = time.Now()
+	tx.Put(userPath, toJSON(u))
+
+	return nil
+}
+
+// kartuscheOwner returns the owner of the kartusche, or an error with code 404 if it does not exist.
+func kartuscheOwner(tx bolted.SugaredReadTx, name string) (string, error) {
+	kp := kartuschesPath.Append(name)
+	if !tx.Exists(kp) {
+		return "", newErrorWithCode(errors.New("not found"), 404)
+	}
+
+	k := &kartusche{}
+	err := json.Unmarshal(tx.Get(kp), k)
+	if err != nil {
+		return "", fmt.Errorf("while unmarshalling kartusche %s: %w", name, err)
+	}
+
+	return k.Owner, nil
+}
+
+// roleOf returns the role of the user for the kartusche, or an empty role if the user has no access.
+func roleOf(tx bolted.SugaredReadTx, name string, p principal) (Role, error) {
+	owner, err := kartuscheOwner(tx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if owner == "" {
+		return "", nil
+	}
+
+	if owner == p.UserID {
+		return RoleAdmin, nil
+	}
+
+	grantPath := accessPath.Append(name, p.UserID)
+	if !tx.Exists(grantPath) {
+		return "", nil
+	}
+
+	g := Grant{}
+	err = json.Unmarshal(tx.Get(grantPath), &g)
+	if err != nil {
+		return "", fmt.Errorf("while unmarshalling grant of %s: %w", p.UserID, err)
+	}
+
+	if g.Role == "" {
+		return RoleDeveloper, nil
+	}
+
+	return g.Role, nil
+}
+
+// authorizeTx returns an error with code 403 if the user does not have the role for the kartusche.
+func authorizeTx(tx bolted.SugaredReadTx, name string, p principal, required Role) error {
+	role, err := roleOf(tx, name, p)
+	if err != nil {
+		return err
+	}
+
+	if role == "" {
+		return newErrorWithCode(fmt.Errorf("access to kartusche %s denied", name), 403)
+	}
+
+	if !role.includes(required) {
+		return newErrorWithCode(fmt.Errorf("role %s is required for kartusche %s, user has role %s", required, name, role), 403)
+	}
+
+	return nil
+}
+
+// authorize returns an error with code 403 if the principal in ctx does not have the role for the kartusche.
+func (s *Server) authorize(ctx context.Context, name string, required Role) error {
+	return bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		return authorizeTx(tx, name, principalFromContext(ctx), required)
+	})
+}
+
+func (s *Server) listAccess(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	name := mux.Vars(r)["name"]
+
+	err = s.authorize(r.Context(), name, RoleViewer)
+	if err != nil {
+		return
+	}
+
+	ka := KartuscheAccess{
+		Grants: []Grant{},
+	}
+
+	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		ka.Owner, err = kartuscheOwner(tx, name)
+		if err != nil {
+			return err
+		}
+
+		grantsPath := accessPath.Append(name)
+		if !tx.Exists(grantsPath) {
+			return nil
+		}
+
+		for it := tx.Iterator(grantsPath); !it.IsDone(); it.Next() {
+			g := Grant{}
+			err = json.Unmarshal(it.GetValue(), &g)
+			if err != nil {
+				return fmt.Errorf("while unmarshalling grant of %s: %w", it.GetKey(), err)
+			}
+			ka.Grants = append(ka.Grants, g)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	sort.Slice(ka.Grants, func(i, j int) bool {
+		return ka.Grants[i].UserID < ka.Grants[j].UserID
+	})
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(ka)
+}
+
+func (s *Server) grantAccess(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+	userID := vars["user"]
+
+	gr := GrantRequest{}
+	err = json.NewDecoder(r.Body).Decode(&gr)
+	if err != nil {
+		err = newErrorWithCode(fmt.Errorf("while decoding request: %w", err), 400)
+		return
+	}
+
+	if !gr.Role.IsValid() {
+		err = newErrorWithCode(fmt.Errorf("unknown role %q", gr.Role), 400)
+		return
+	}
+
+	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		p := principalFromContext(r.Context())
+		err := authorizeTx(tx, name, p, RoleAdmin)
+		if err != nil {
+			return err
+		}
+
+		owner, err := kartuscheOwner(tx, name)
+		if err != nil {
+			return err
+		}
+
+		if owner == userID {
+			return newErrorWithCode(fmt.Errorf("%s is the owner of kartusche %s", userID, name), 409)
+		}
+
+		grantsPath := accessPath.Append(name)
+		if !tx.Exists(grantsPath) {
+			tx.CreateMap(grantsPath)
+		}
+
+		tx.Put(grantsPath.Append(userID), toJSON(Grant{
+			UserID:    userID,
+			Role:      gr.Role,
+			GrantedBy: p.UserID,
+			GrantedAt: time.Now(),
+		}))
+
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (s *Server) revokeAccess(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+	userID := vars["user"]
+
+	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		err := authorizeTx(tx, name, principalFromContext(r.Context()), RoleAdmin)
+		if err != nil {
+			return err
+		}
+
+		grantPath := accessPath.Append(name, userID)
+		if !tx.Exists(grantPath) {
+			return newErrorWithCode(fmt.Errorf("user %s has no access granted", userID), 404)
+		}
+
+		tx.Delete(grantPath)
+
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// setOwnerOfLegacyKartusches makes owner the owner of the kartusches uploaded before ownership was recorded.
+// It returns the names of the kartusches left without an owner, which are all of them if owner is empty.
+func setOwnerOfLegacyKartusches(tx bolted.SugaredWriteTx, owner string) ([]string, error) {
+	legacy := map[string]*kartusche{}
+	for it := tx.Iterator(kartuschesPath); !it.IsDone(); it.Next() {
+		k := &kartusche{}
+		err := json.Unmarshal(it.GetValue(), k)
+		if err != nil {
+			return nil, fmt.Errorf("while unmarshalling kartusche %s: %w", it.GetKey(), err)
+		}
+
+		if k.Owner == "" {
+			legacy[it.GetKey()] = k
+		}
+	}
+
+	if owner == "" {
+		unowned := []string{}
+		for name := range legacy {
+			unowned = append(unowned, name)
+		}
+		sort.Strings(unowned)
+		return unowned, nil
+	}
+
+	for name, k := range legacy {
+		k.Owner = owner
+		tx.Put(kartuschesPath.Append(name), toJSON(k))
+	}
+
+	return nil, nil
+}
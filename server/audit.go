@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/util/statusrecorder"
+	"github.com/gorilla/mux"
+)
+
+var auditLogPath = dbpath.ToPath("audit_log")
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// defaultAuditLimit is the number of audit entries returned when no limit is requested.
+const defaultAuditLimit = 100
+
+// AuditEntry records an administrative action on the server.
+type AuditEntry struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	UserID    string    `json:"user_id,omitempty"`
+	TokenID   string    `json:"token_id,omitempty"`
+	Action    string    `json:"action"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Kartusche string    `json:"kartusche,omitempty"`
+	SourceIP  string    `json:"source_ip"`
+	Status    int       `json:"status,omitempty"`
+	Outcome   string    `json:"outcome"`
+}
+
+// Actor is the user of the entry or, if there is none, the token.
+func (e AuditEntry) Actor() string {
+	if e.UserID != "" {
+		return e.UserID
+	}
+	return e.TokenID
+}
+
+func auditKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// appendAuditEntry appends the entry to the audit log.
+// Entries are never changed or deleted.
+func (s *Server) appendAuditEntry(e AuditEntry) error {
+	return bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		var seq uint64 = 1
+		it := tx.Iterator(auditLogPath)
+		it.Last()
+		if !it.IsDone() {
+			last, err := strconv.ParseUint(it.GetKey(), 10, 64)
+			if err != nil {
+				return fmt.Errorf("while parsing last audit entry id: %w", err)
+			}
+			seq = last + 1
+		}
+
+		e.ID = strconv.FormatUint(seq, 10)
+		tx.Put(auditLogPath.Append(auditKey(seq)), toJSON(e))
+
+		return nil
+	})
+}
+
+// audit appends the entry to the audit log, failing to do so is only logged.
+func (s *Server) audit(r *http.Request, e AuditEntry) {
+	e.Time = time.Now()
+	e.SourceIP = s.sourceIP(r)
+
+	err := s.appendAuditEntry(e)
+	if err != nil {
+		s.log.Error(err, "while appending audit entry", "action", e.Action, "kartusche", e.Kartusche)
+	}
+}
+
+func auditOutcome(status int) string {
+	if status >= 400 {
+		return AuditOutcomeFailure
+	}
+	return AuditOutcomeSuccess
+}
+
+// webdavWriteMethods are the WebDAV methods changing the content of a kartusche.
+var webdavWriteMethods = map[string]bool{
+	"PUT":       true,
+	"DELETE":    true,
+	"MKCOL":     true,
+	"COPY":      true,
+	"MOVE":      true,
+	"PROPPATCH": true,
+}
+
+// auditedPrincipalKey holds the principal of an audited request, set by authMiddleware.
+const auditedPrincipalKey = contextKey("audited-principal")
+
+// setAuditedPrincipal passes the principal of the request to auditMiddleware.
+func setAuditedPrincipal(ctx context.Context, p principal) {
+	ap, ok := ctx.Value(auditedPrincipalKey).(*principal)
+	if ok {
+		*ap = p
+	}
+}
+
+// auditMiddleware records requests of the routes named with an audited action.
+// The name of a route is the action of its audit entries.
+// It runs before authMiddleware, requests failing authentication are only logged.
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil || route.GetName() == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		action := route.GetName()
+		kartusche := mux.Vars(r)["name"]
+
+		if action == "webdav" {
+			if !webdavWriteMethods[r.Method] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			kartusche, _, _ = strings.Cut(strings.TrimPrefix(path.Clean(strings.TrimPrefix(r.URL.Path, "/dav")), "/"), "/")
+		}
+
+		p := new(principal)
+		sr := statusrecorder.New(w)
+		next.ServeHTTP(sr, r.WithContext(context.WithValue(r.Context(), auditedPrincipalKey, p)))
+
+		// anyone can send unauthenticated requests, recording them would let them grow the audit log without limit
+		if sr.StatusCode() == http.StatusUnauthorized {
+			s.log.Info("request failed authentication", "action", action, "kartusche", kartusche, "method", r.Method, "path", r.URL.Path, "sourceIP", s.sourceIP(r))
+			return
+		}
+
+		s.audit(r, AuditEntry{
+			UserID:    p.UserID,
+			TokenID:   p.TokenID,
+			Action:    action,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Kartusche: kartusche,
+			Status:    sr.StatusCode(),
+			Outcome:   auditOutcome(sr.StatusCode()),
+		})
+	})
+}
+
+// auditVisibility returns a function checking if the principal may see an audit entry:
+// entries of the principal's own actions and entries of kartusches the principal has a role for.
+func auditVisibility(tx bolted.SugaredReadTx, p principal) func(e AuditEntry) (bool, error) {
+	hasRole := map[string]bool{}
+
+	return func(e AuditEntry) (bool, error) {
+		own := (p.UserID != "" && e.UserID == p.UserID) || (p.TokenID != "" && e.TokenID == p.TokenID)
+		if own {
+			return true, nil
+		}
+
+		if e.Kartusche == "" {
+			return false, nil
+		}
+
+		visible, checked := hasRole[e.Kartusche]
+		if !checked {
+			role, err := roleOf(tx, e.Kartusche, p)
+			var ec *errorWithCode
+			switch {
+			case errors.As(err, &ec) && ec.code == 404:
+				// removed kartusches are only visible in the entries of own actions
+			case err != nil:
+				return false, err
+			}
+			visible = role != ""
+			hasRole[e.Kartusche] = visible
+		}
+
+		return visible, nil
+	}
+}
+
+func (s *Server) listAuditEntries(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	q := r.URL.Query()
+
+	limit := defaultAuditLimit
+	if q.Has("limit") {
+		limit, err = strconv.Atoi(q.Get("limit"))
+		if err != nil || limit < 1 {
+			err = newErrorWithCode(errors.New("limit must be a positive number"), 400)
+			return
+		}
+	}
+
+	kartusche := q.Get("kartusche")
+	user := q.Get("user")
+
+	p := principalFromContext(r.Context())
+
+	entries := []AuditEntry{}
+
+	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		visible := auditVisibility(tx, p)
+		it := tx.Iterator(auditLogPath)
+		for it.Last(); !it.IsDone() && len(entries) < limit; it.Prev() {
+			e := AuditEntry{}
+			err := json.Unmarshal(it.GetValue(), &e)
+			if err != nil {
+				return fmt.Errorf("while unmarshalling audit entry %s: %w", it.GetKey(), err)
+			}
+			if kartusche != "" && e.Kartusche != kartusche {
+				continue
+			}
+			if user != "" && e.UserID != user {
+				continue
+			}
+			ok, err := visible(e)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
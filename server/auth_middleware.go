@@ -1,14 +1,40 @@
 package server
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/draganm/bolted"
 )
 
+// principal is the authenticated originator of a controller request.
+type principal struct {
+	TokenID string
+	UserID  string
+}
+
+type contextKey string
+
+const principalKey = contextKey("principal")
+
+func principalFromContext(ctx context.Context) principal {
+	p, _ := ctx.Value(principalKey).(principal)
+	return p
+}
+
+// tokenID is used to refer to a token without revealing it.
+func tokenID(tkn string) string {
+	sum := sha256.Sum256([]byte(tkn))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -20,7 +46,7 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "not authorized", http.StatusUnauthorized)
 		}
 
-		if strings.HasPrefix(r.URL.Path, "/auth") {
+		if strings.HasPrefix(r.URL.Path, "/auth") || r.URL.Path == "/metrics" {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -60,10 +86,15 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 		}
 
 		tokenValid := false
+		ti := authTokenInfo{}
 
 		err := bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
-			tokenValid = tx.Exists(tokensPath.Append(tkn))
-			return nil
+			tokenPath := tokensPath.Append(tkn)
+			tokenValid = tx.Exists(tokenPath)
+			if !tokenValid {
+				return nil
+			}
+			return json.Unmarshal(tx.Get(tokenPath), &ti)
 		})
 
 		if err != nil {
@@ -77,7 +108,27 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if ti.isExpired(time.Now()) {
+			requireAuthentication("token expired")
+			return
+		}
+
+		p := principal{
+			TokenID: tokenID(tkn),
+			UserID:  ti.UserID,
+		}
+
+		setAuditedPrincipal(r.Context(), p)
+
+		if !ti.allows(r) {
+			log.Info("request not allowed by token scope", "tokenId", p.TokenID, "path", r.URL.Path)
+			http.Error(w, "request not allowed by token scope", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey, p)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 
 	})
 }
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/paths"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/gorilla/mux"
+)
+
+// CodeManifest contains hex encoded SHA256 hashes of the client's code files.
+type CodeManifest struct {
+	Files map[string]string `json:"files"`
+}
+
+type CodeManifestResponse struct {
+	// Missing are the files the server does not have or that differ from the client's version.
+	Missing []string `json:"missing"`
+	// Deleted are the files the server has that are not present on the client.
+	Deleted []string `json:"deleted"`
+	// Base contains the hashes of the missing and deleted files on the server,
+	// files the server does not have are not included.
+	Base map[string]string `json:"base"`
+}
+
+// CodePatch changes the files of the code.
+// Base must contain the hashes of the changed files as returned with the manifest response,
+// if any of the files has changed on the server since, the patch is rejected.
+type CodePatch struct {
+	Files   map[string][]byte `json:"files"`
+	Deleted []string          `json:"deleted"`
+	Base    map[string]string `json:"base"`
+	// Develop is set for the patches of `remote develop`, they are not recorded as code versions.
+	Develop bool `json:"develop,omitempty"`
+}
+
+func (s *Server) codeManifest(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	name := mux.Vars(r)["name"]
+
+	err = s.authorize(r.Context(), name, RoleDeveloper)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	k, ok := s.kartusches[name]
+	s.mu.Unlock()
+
+	if !ok {
+		err = newErrorWithCode(errors.New("not found"), 404)
+		return
+	}
+
+	rt := k.runtime
+	if rt == nil {
+		err = newErrorWithCode(errors.New("kartusche is not running"), 409)
+		return
+	}
+
+	cm := &CodeManifest{}
+	err = json.NewDecoder(r.Body).Decode(cm)
+	if err != nil {
+		err = newErrorWithCode(fmt.Errorf("while decoding manifest: %w", err), 400)
+		return
+	}
+
+	serverHashes := map[string]string{}
+
+	err = rt.Read(func(tx bolted.SugaredReadTx) error {
+		for p, d := range codeFiles(tx) {
+			sum := sha256.Sum256(d)
+			serverHashes[p] = hex.EncodeToString(sum[:])
+		}
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	res := &CodeManifestResponse{
+		Missing: []string{},
+		Deleted: []string{},
+		Base:    map[string]string{},
+	}
+
+	for p, h := range cm.Files {
+		if serverHashes[p] != h {
+			res.Missing = append(res.Missing, p)
+			if serverHashes[p] != "" {
+				res.Base[p] = serverHashes[p]
+			}
+		}
+	}
+
+	for p, h := range serverHashes {
+		_, found := cm.Files[p]
+		if !found {
+			res.Deleted = append(res.Deleted, p)
+			res.Base[p] = h
+		}
+	}
+
+	sort.Strings(res.Missing)
+	sort.Strings(res.Deleted)
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(res)
+
+}
+
+func (s *Server) patchCode(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	name := mux.Vars(r)["name"]
+
+	err = s.authorize(r.Context(), name, RoleDeveloper)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	k, ok := s.kartusches[name]
+	s.mu.Unlock()
+
+	if !ok {
+		err = newErrorWithCode(errors.New("not found"), 404)
+		return
+	}
+
+	rt := k.runtime
+	if rt == nil {
+		err = newErrorWithCode(errors.New("kartusche is not running"), 409)
+		return
+	}
+
+	cp := &CodePatch{}
+	err = json.NewDecoder(r.Body).Decode(cp)
+	if err != nil {
+		err = newErrorWithCode(fmt.Errorf("while decoding patch: %w", err), 400)
+		return
+	}
+
+	snapshot := new(bytes.Buffer)
+	var hash string
+
+	err = rt.Update(func(tx bolted.SugaredWriteTx) error {
+		err := checkPatchBase(tx, cp)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range cp.Deleted {
+			dp, err := codePath(p)
+			if err != nil {
+				return err
+			}
+			if !tx.Exists(dp) {
+				continue
+			}
+
+			tx.Delete(dp)
+
+			// remove directories left empty by the deletion
+			for parent := dp[:len(dp)-1]; len(parent) > 0; parent = parent[:len(parent)-1] {
+				if !tx.Iterator(parent).IsDone() {
+					break
+				}
+				tx.Delete(parent)
+			}
+		}
+
+		for p, d := range cp.Files {
+			dp, err := codePath(p)
+			if err != nil {
+				return err
+			}
+
+			for i := 1; i < len(dp); i++ {
+				parent := dp[:i]
+				if !tx.Exists(parent) {
+					tx.CreateMap(parent)
+				}
+			}
+
+			if tx.Exists(dp) && tx.IsMap(dp) {
+				tx.Delete(dp)
+			}
+
+			tx.Put(dp, d)
+		}
+
+		if cp.Develop {
+			return nil
+		}
+
+		hash = runtime.CodeHash(tx)
+		return writeCodeTar(tx, snapshot)
+	})
+
+	if err != nil {
+		return
+	}
+
+	if !cp.Develop {
+		_, err = s.addCodeVersion(name, CodeVersion{CodeHash: hash}, principalFromContext(r.Context()), snapshot.Bytes())
+		if err != nil {
+			err = fmt.Errorf("while recording code version: %w", err)
+			return
+		}
+	}
+
+	w.WriteHeader(204)
+
+}
+
+// checkPatchBase returns an error with code 409 if any of the patched files has changed since the client received the manifest response.
+func checkPatchBase(tx bolted.SugaredReadTx, cp *CodePatch) error {
+	patched := []string{}
+	for p := range cp.Files {
+		patched = append(patched, p)
+	}
+	patched = append(patched, cp.Deleted...)
+	sort.Strings(patched)
+
+	for _, p := range patched {
+		dp, err := codePath(p)
+		if err != nil {
+			return err
+		}
+
+		current := ""
+		if tx.Exists(dp) && !tx.IsMap(dp) {
+			sum := sha256.Sum256(tx.Get(dp))
+			current = hex.EncodeToString(sum[:])
+		}
+
+		if current != cp.Base[p] {
+			return newErrorWithCode(fmt.Errorf("%s has changed on the server, update the code again", p), 409)
+		}
+	}
+
+	return nil
+}
+
+// codePath converts a slash separated path of a code file to a db path.
+// Paths pointing into the data or generated paths are rejected.
+func codePath(p string) (dbpath.Path, error) {
+	dp := dbpath.ToPath(strings.Split(p, "/")...)
+	if len(dp) == 0 || !paths.IsCode(dp[0]) {
+		return nil, newErrorWithCode(fmt.Errorf("invalid code path %q", p), 400)
+	}
+	return dp, nil
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/bolted/embedded"
+	"github.com/draganm/kartusche/common/paths"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/gorilla/mux"
+)
+
+var codeVersionsPath = dbpath.ToPath("code_versions")
+
+const maxCodeVersions = 100
+
+// maxCodeVersionsSize limits the total size of the code stored in the versions of a kartusche.
+// The oldest versions are removed first, the newest version is always kept.
+const maxCodeVersionsSize = 64 * 1024 * 1024
+
+type CodeVersion struct {
+	Version   uint64    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    string    `json:"user_id,omitempty"`
+	TokenID   string    `json:"token_id,omitempty"`
+	// CodeHash identifies the code, failures record the same hash.
+	CodeHash string `json:"code_hash,omitempty"`
+	// RestoredVersion is set when the version was created by a rollback.
+	RestoredVersion uint64 `json:"restored_version,omitempty"`
+}
+
+func versionKey(v uint64) string {
+	return fmt.Sprintf("%020d", v)
+}
+
+// writeCodeTar writes everything apart from the data and generated paths as a tar archive.
+func writeCodeTar(tx bolted.SugaredReadTx, w io.Writer) error {
+	return writeTar(tx, w, func(p dbpath.Path) bool {
+		return len(p) == 1 && !paths.IsCode(p[0])
+	})
+}
+
+// snapshotKartuscheFile creates a code tar of a kartusche file that is not opened by a runtime
+// and returns it together with the hash of the code.
+func snapshotKartuscheFile(fileName string) ([]byte, string, error) {
+	db, err := embedded.Open(fileName, 0700, embedded.Options{})
+	if err != nil {
+		return nil, "", fmt.Errorf("while opening kartusche: %w", err)
+	}
+
+	defer db.Close()
+
+	bb := new(bytes.Buffer)
+	var hash string
+	err = bolted.SugaredRead(db, func(tx bolted.SugaredReadTx) error {
+		hash = runtime.CodeHash(tx)
+		return writeCodeTar(tx, bb)
+	})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return bb.Bytes(), hash, nil
+}
+
+func (s *Server) addCodeVersion(name string, cv CodeVersion, p principal, code []byte) (CodeVersion, error) {
+	err := bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		versionsPath := codeVersionsPath.Append(name)
+		if !tx.Exists(versionsPath) {
+			tx.CreateMap(versionsPath)
+		}
+
+		it := tx.Iterator(versionsPath)
+		it.Last()
+		if !it.IsDone() {
+			last, err := strconv.ParseUint(it.GetKey(), 10, 64)
+			if err != nil {
+				return fmt.Errorf("while parsing last version: %w", err)
+			}
+			cv.Version = last + 1
+		} else {
+			cv.Version = 1
+		}
+
+		cv.CreatedAt = time.Now()
+		cv.UserID = p.UserID
+		cv.TokenID = p.TokenID
+
+		trimToSize(tx, versionsPath, maxCodeVersions-1)
+		trimCodeToSize(tx, versionsPath, maxCodeVersionsSize, uint64(len(code)))
+
+		versionPath := versionsPath.Append(versionKey(cv.Version))
+		tx.CreateMap(versionPath)
+		tx.Put(versionPath.Append("info"), toJSON(cv))
+		tx.Put(versionPath.Append("code"), code)
+
+		return nil
+	})
+
+	return cv, err
+}
+
+// lastCodeHash returns the code hash of the newest version of the kartusche, or an empty string if there is none.
+func (s *Server) lastCodeHash(name string) (string, error) {
+	var hash string
+	err := bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		versionsPath := codeVersionsPath.Append(name)
+		if !tx.Exists(versionsPath) {
+			return nil
+		}
+
+		it := tx.Iterator(versionsPath)
+		it.Last()
+		if it.IsDone() {
+			return nil
+		}
+
+		cv := CodeVersion{}
+		err := json.Unmarshal(tx.Get(versionsPath.Append(it.GetKey(), "info")), &cv)
+		if err != nil {
+			return fmt.Errorf("while unmarshalling version %s: %w", it.GetKey(), err)
+		}
+		hash = cv.CodeHash
+		return nil
+	})
+
+	return hash, err
+}
+
+func (s *Server) listVersions(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	name := mux.Vars(r)["name"]
+
+	versions := []CodeVersion{}
+
+	err = s.authorize(r.Context(), name, RoleViewer)
+	if err != nil {
+		return
+	}
+
+	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		if !tx.Exists(kartuschesPath.Append(name)) {
+			return newErrorWithCode(errors.New("not found"), 404)
+		}
+
+		versionsPath := codeVersionsPath.Append(name)
+		if !tx.Exists(versionsPath) {
+			return nil
+		}
+
+		for it := tx.Iterator(versionsPath); !it.IsDone(); it.Next() {
+			cv := CodeVersion{}
+			err := json.Unmarshal(tx.Get(versionsPath.Append(it.GetKey(), "info")), &cv)
+			if err != nil {
+				return fmt.Errorf("while unmarshalling version %s: %w", it.GetKey(), err)
+			}
+			versions = append(versions, cv)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+
+}
+
+func (s *Server) rollback(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	version, err := strconv.ParseUint(vars["version"], 10, 64)
+	if err != nil {
+		err = newErrorWithCode(fmt.Errorf("while parsing version: %w", err), 400)
+		return
+	}
+
+	err = s.authorize(r.Context(), name, RoleDeveloper)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	k, ok := s.kartusches[name]
+	s.mu.Unlock()
+
+	if !ok {
+		err = newErrorWithCode(errors.New("not found"), 404)
+		return
+	}
+
+	rt := k.runtime
+	if rt == nil {
+		err = newErrorWithCode(errors.New("kartusche is not running"), 409)
+		return
+	}
+
+	var code []byte
+
+	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		codePath := codeVersionsPath.Append(name, versionKey(version), "code")
+		if !tx.Exists(codePath) {
+			return newErrorWithCode(fmt.Errorf("version %d not found", version), 404)
+		}
+		code = tx.Get(codePath)
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	var hash string
+
+	err = rt.Update(func(tx bolted.SugaredWriteTx) error {
+		err := replaceCode(tx, bytes.NewReader(code))
+		if err != nil {
+			return err
+		}
+		hash = runtime.CodeHash(tx)
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	cv, err := s.addCodeVersion(name, CodeVersion{RestoredVersion: version, CodeHash: hash}, principalFromContext(r.Context()), code)
+	if err != nil {
+		err = fmt.Errorf("while recording code version: %w", err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(cv)
+
+}
+
+func trimToSize(tx bolted.SugaredWriteTx, mapPath dbpath.Path, maxSize uint64) {
+	currentSize := tx.Size(mapPath)
+	if currentSize <= maxSize {
+		return
+	}
+
+	toDelete := []dbpath.Path{}
+
+	it := tx.Iterator(mapPath)
+	for currentSize > maxSize && !it.IsDone() {
+		toDelete = append(toDelete, mapPath.Append(it.GetKey()))
+		currentSize--
+		it.Next()
+	}
+
+	for _, p := range toDelete {
+		tx.Delete(p)
+	}
+
+}
+
+// trimCodeToSize removes the oldest versions until the code of the remaining versions
+// and the code of the version being added fit into maxSize bytes.
+func trimCodeToSize(tx bolted.SugaredWriteTx, versionsPath dbpath.Path, maxSize, addedSize uint64) {
+	sizes := []uint64{}
+	keys := []string{}
+	total := addedSize
+
+	for it := tx.Iterator(versionsPath); !it.IsDone(); it.Next() {
+		size := uint64(len(tx.Get(versionsPath.Append(it.GetKey(), "code"))))
+		sizes = append(sizes, size)
+		keys = append(keys, it.GetKey())
+		total += size
+	}
+
+	for i := 0; i < len(keys) && total > maxSize; i++ {
+		tx.Delete(versionsPath.Append(keys[i]))
+		total -= sizes[i]
+	}
+
+}
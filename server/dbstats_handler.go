@@ -17,6 +17,11 @@ func (s *Server) infoDBStats(w http.ResponseWriter, r *http.Request) {
 		handleHttpError(w, err, s.log)
 	}()
 
+	err = s.authorize(r.Context(), name, RoleViewer)
+	if err != nil {
+		return
+	}
+
 	s.mu.Lock()
 	k, ok := s.kartusches[name]
 	s.mu.Unlock()
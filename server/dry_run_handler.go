@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/paths"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/gorilla/mux"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	FileAdded   = "added"
+	FileRemoved = "removed"
+	FileChanged = "changed"
+)
+
+type FileDiff struct {
+	Path   string `json:"path"`
+	Change string `json:"change"`
+	// Diff is the unified diff of the change, set only for text files.
+	Diff string `json:"diff,omitempty"`
+}
+
+type DryRunResult struct {
+	Files         []FileDiff             `json:"files"`
+	CompileErrors []runtime.CompileError `json:"compile_errors"`
+}
+
+func (s *Server) dryRunUpdateCode(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	name := mux.Vars(r)["name"]
+
+	err = s.authorize(r.Context(), name, RoleDeveloper)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	k, ok := s.kartusches[name]
+	s.mu.Unlock()
+
+	if !ok {
+		err = newErrorWithCode(errors.New("not found"), 404)
+		return
+	}
+
+	rt := k.runtime
+	if rt == nil {
+		err = newErrorWithCode(errors.New("kartusche is not running"), 409)
+		return
+	}
+
+	var before, after map[string][]byte
+
+	compileErrors, err := rt.Check(func(tx bolted.SugaredWriteTx) error {
+		before = codeFiles(tx)
+		err := replaceCode(tx, r.Body)
+		if err != nil {
+			return err
+		}
+		after = codeFiles(tx)
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	res := &DryRunResult{
+		Files:         diffFiles(before, after),
+		CompileErrors: compileErrors,
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(res)
+
+}
+
+// codeFiles returns content of all files in the kartusche apart from the data and generated paths.
+func codeFiles(tx bolted.SugaredReadTx) map[string][]byte {
+	files := map[string][]byte{}
+	toDo := []dbpath.Path{dbpath.NilPath}
+
+	for len(toDo) > 0 {
+		current := toDo[0]
+		toDo = toDo[1:]
+		for it := tx.Iterator(current); !it.IsDone(); it.Next() {
+			p := current.Append(it.GetKey())
+			if len(p) == 1 && !paths.IsCode(p[0]) {
+				continue
+			}
+			if tx.IsMap(p) {
+				toDo = append(toDo, p)
+				continue
+			}
+			files[path.Join(p...)] = it.GetValue()
+		}
+	}
+
+	return files
+}
+
+func diffFiles(before, after map[string][]byte) []FileDiff {
+	diffs := []FileDiff{}
+
+	for p, a := range after {
+		b, found := before[p]
+		switch {
+		case !found:
+			diffs = append(diffs, FileDiff{Path: p, Change: FileAdded, Diff: unifiedDiff(p, nil, a)})
+		case !bytes.Equal(a, b):
+			diffs = append(diffs, FileDiff{Path: p, Change: FileChanged, Diff: unifiedDiff(p, b, a)})
+		}
+	}
+
+	for p, b := range before {
+		_, found := after[p]
+		if !found {
+			diffs = append(diffs, FileDiff{Path: p, Change: FileRemoved, Diff: unifiedDiff(p, b, nil)})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+
+	return diffs
+}
+
+func isText(d []byte) bool {
+	return utf8.Valid(d) && bytes.IndexByte(d, 0) < 0
+}
+
+func unifiedDiff(p string, before, after []byte) string {
+	if !isText(before) || !isText(after) {
+		return ""
+	}
+
+	fromFile, toFile := "a/"+p, "b/"+p
+	if before == nil {
+		fromFile = "/dev/null"
+	}
+	if after == nil {
+		toFile = "/dev/null"
+	}
+
+	d, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(before)),
+		B:        difflib.SplitLines(string(after)),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+
+	return d
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/draganm/bolted"
+	"github.com/draganm/kartusche/runtime"
+	"github.com/gorilla/mux"
+)
+
+// listFailures responds with the recorded failures of the kartusche, the most recent one first.
+// Request bodies, stacks and source excerpts are only part of the single failure response.
+func (s *Server) listFailures(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	var name = mux.Vars(r)["name"]
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	err = s.authorize(r.Context(), name, RoleViewer)
+	if err != nil {
+		return
+	}
+
+	rt, err := s.runningRuntime(name)
+	if err != nil {
+		return
+	}
+
+	var failures []runtime.Failure
+	err = rt.Read(func(tx bolted.SugaredReadTx) error {
+		failures, err = runtime.ListFailures(tx)
+		return err
+	})
+
+	if err != nil {
+		return
+	}
+
+	for i := range failures {
+		failures[i].Body = nil
+		failures[i].Stack = nil
+		failures[i].Excerpt = nil
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	json.NewEncoder(w).Encode(failures)
+
+}
+
+// getFailure responds with the failure, the request body is only part of it for users with the developer role.
+func (s *Server) getFailure(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	vars := mux.Vars(r)
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	err = s.authorize(r.Context(), vars["name"], RoleViewer)
+	if err != nil {
+		return
+	}
+
+	var role Role
+	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		role, err = roleOf(tx, vars["name"], principalFromContext(r.Context()))
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	rt, err := s.runningRuntime(vars["name"])
+	if err != nil {
+		return
+	}
+
+	var failure *runtime.Failure
+	err = rt.Read(func(tx bolted.SugaredReadTx) error {
+		failure, err = runtime.GetFailure(tx, vars["id"])
+		return err
+	})
+
+	if err != nil {
+		return
+	}
+
+	if failure == nil {
+		err = newErrorWithCode(errors.New("failure not found"), 404)
+		return
+	}
+
+	if !role.includes(RoleDeveloper) {
+		failure.Body = nil
+		failure.BodyTruncated = false
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	json.NewEncoder(w).Encode(failure)
+
+}
@@ -35,6 +35,11 @@ func (s *Server) infoHandlers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = s.authorize(r.Context(), name, RoleViewer)
+	if err != nil {
+		return
+	}
+
 	s.mu.Lock()
 	k, found := s.kartusches[name]
 	s.mu.Unlock()
@@ -5,19 +5,28 @@ import (
 	"os"
 
 	"github.com/draganm/kartusche/runtime"
+	"github.com/draganm/kartusche/runtime/metrics"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/go-logr/logr"
 	"go.uber.org/multierr"
 )
 
 type kartusche struct {
-	Error   string `json:"error,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Owner is the id of the user who uploaded the kartusche.
+	Owner   string `json:"owner,omitempty"`
 	name    string
 	runtime runtime.Runtime
 	path    string
 }
 
-func (k *kartusche) start(logger logr.Logger) error {
-	rt, err := runtime.Open(k.path, logger)
+func (k *kartusche) start(logger logr.Logger, m *metrics.Metrics, t *tracing.Tracer) error {
+	rt, err := runtime.Open(
+		k.path,
+		logger.WithValues("kartusche", k.name),
+		runtime.WithMetrics(m.ForKartusche(k.name)),
+		runtime.WithTracer(t.With("kartusche", k.name)),
+	)
 	if err != nil {
 		k.Error = err.Error()
 		return fmt.Errorf("while starting: %w", err)
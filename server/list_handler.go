@@ -3,6 +3,9 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
+
+	"github.com/draganm/bolted"
 )
 
 func (s *Server) list(w http.ResponseWriter, r *http.Request) {
@@ -12,12 +15,39 @@ func (s *Server) list(w http.ResponseWriter, r *http.Request) {
 		handleHttpError(w, err, s.log)
 	}()
 
-	kl := []string{}
+	names := []string{}
 
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	for k := range s.kartusches {
-		kl = append(kl, k)
+		names = append(names, k)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(names)
+
+	p := principalFromContext(r.Context())
+
+	kl := []string{}
+
+	// only kartusches the user has access to are listed
+	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		for _, name := range names {
+			if !tx.Exists(kartuschesPath.Append(name)) {
+				continue
+			}
+			role, err := roleOf(tx, name, p)
+			if err != nil {
+				return err
+			}
+			if role != "" {
+				kl = append(kl, name)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return
 	}
 
 	w.Header().Set("content-type", "application/json")
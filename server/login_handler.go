@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,12 +10,18 @@ import (
 	"time"
 
 	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
 	"github.com/gofrs/uuid"
 )
 
 type authTokenInfo struct {
 	CreatedAt time.Time `json:"created_at"`
 	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Kartusche and Actions are set for scoped tokens, see allows.
+	Kartusche   string   `json:"kartusche,omitempty"`
+	Actions     []string `json:"actions,omitempty"`
+	Description string   `json:"description,omitempty"`
 }
 
 type LoginStartResponse struct {
@@ -37,8 +44,12 @@ func (s *Server) loginStart(w http.ResponseWriter, r *http.Request) {
 	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
 		requestPath := openTokenRequests.Append(requestID.String())
 		tx.CreateMap(requestPath)
+		tx.Put(requestPath.Append("created_at"), []byte(time.Now().Format(time.RFC3339Nano)))
 		return nil
 	})
+	if err != nil {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -88,18 +99,30 @@ func (s *Server) accessToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if rp.TokenRequestID == "" {
+		err = newErrorWithCode(errors.New("token request id is missing"), 400)
+		return
+	}
+
 	resp := &AccessTokenResponse{}
 
-	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
 		requestPath := openTokenRequests.Append(rp.TokenRequestID)
 		if !tx.Exists(requestPath) {
 			return newErrorWithCode(errors.New("request not found"), 404)
 		}
 
+		if s.loginRequestExpired(tx, requestPath, time.Now()) {
+			deleteLoginRequest(tx, requestPath)
+			resp.Error = "expired_token"
+			return nil
+		}
+
 		errorPath := requestPath.Append("error")
 
 		if tx.Exists(errorPath) {
 			resp.Error = string(tx.Get(errorPath))
+			tx.Delete(requestPath)
 			return nil
 		}
 
@@ -113,6 +136,9 @@ func (s *Server) accessToken(w http.ResponseWriter, r *http.Request) {
 		tokenBytes := tx.Get(tokenPath)
 		resp.AccessToken = string(tokenBytes)
 
+		// the token is handed out only once
+		tx.Delete(requestPath)
+
 		return nil
 	})
 
@@ -123,3 +149,94 @@ func (s *Server) accessToken(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// loginRequestExpired checks if the open login request is older than loginRequestTTL.
+// Requests opened before their creation time was recorded are expired.
+func (s *Server) loginRequestExpired(tx bolted.SugaredReadTx, requestPath dbpath.Path, now time.Time) bool {
+	createdAtPath := requestPath.Append("created_at")
+	if !tx.Exists(createdAtPath) {
+		return true
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, string(tx.Get(createdAtPath)))
+	if err != nil {
+		return true
+	}
+
+	return now.Sub(createdAt) > s.loginRequestTTL
+}
+
+// sweepInterval is the interval of deleting expired login requests and tokens.
+const sweepInterval = time.Minute
+
+// sweepExpired deletes the expired open login requests and tokens on start and then every sweepInterval,
+// until ctx is done.
+func (s *Server) sweepExpired(ctx context.Context) {
+	log := s.log.WithValues("process", "sweeper")
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for now := time.Now(); ; {
+		deleted, err := s.deleteExpiredLoginRequests(now)
+		if err != nil {
+			log.Error(err, "while deleting expired login requests")
+		}
+
+		if deleted > 0 {
+			log.Info("deleted expired login requests", "count", deleted)
+		}
+
+		deleted, err = s.deleteExpiredTokens(now)
+		if err != nil {
+			log.Error(err, "while deleting expired tokens")
+		}
+
+		if deleted > 0 {
+			log.Info("deleted expired tokens", "count", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+	}
+}
+
+// deleteLoginRequest deletes the login request and the token issued for it, if it has not been fetched.
+func deleteLoginRequest(tx bolted.SugaredWriteTx, requestPath dbpath.Path) {
+	tokenPath := requestPath.Append("token")
+	if tx.Exists(tokenPath) {
+		issued := tokensPath.Append(string(tx.Get(tokenPath)))
+		if tx.Exists(issued) {
+			tx.Delete(issued)
+		}
+	}
+
+	tx.Delete(requestPath)
+}
+
+func (s *Server) deleteExpiredLoginRequests(now time.Time) (int, error) {
+	expired := []dbpath.Path{}
+	err := bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		for it := tx.Iterator(openTokenRequests); !it.IsDone(); it.Next() {
+			requestPath := openTokenRequests.Append(it.GetKey())
+			if s.loginRequestExpired(tx, requestPath, now) {
+				expired = append(expired, requestPath)
+			}
+		}
+
+		for _, p := range expired {
+			deleteLoginRequest(tx, p)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// parseSince parses either a RFC3339 timestamp or a duration relative to now.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+
+	d, err := time.ParseDuration(since)
+	if err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("since must be a RFC3339 timestamp or a duration: %q", since)
+	}
+
+	return t, nil
+}
+
+// logs responds with the recent log entries of the kartusche as newline delimited JSON.
+// In follow mode, entries are streamed until the client disconnects.
+func (s *Server) logs(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	var name = mux.Vars(r)["name"]
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	err = s.authorize(r.Context(), name, RoleViewer)
+	if err != nil {
+		return
+	}
+
+	since, err := parseSince(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		err = newErrorWithCode(err, 400)
+		return
+	}
+
+	follow := false
+	if f := r.URL.Query().Get("follow"); f != "" {
+		follow, err = strconv.ParseBool(f)
+		if err != nil {
+			err = newErrorWithCode(fmt.Errorf("invalid follow parameter: %w", err), 400)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	k, ok := s.kartusches[name]
+	s.mu.Unlock()
+
+	if !ok {
+		err = newErrorWithCode(errors.New("not found"), 404)
+		return
+	}
+
+	rt := k.runtime
+	if rt == nil {
+		err = newErrorWithCode(errors.New("kartusche is not running"), 409)
+		return
+	}
+
+	w.Header().Set("content-type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+
+	if !follow {
+		for _, e := range rt.Logs().Since(since) {
+			if enc.Encode(e) != nil {
+				// client has gone away
+				return
+			}
+		}
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err = errors.New("streaming is not supported")
+		return
+	}
+
+	entries, followed, cancel := rt.Logs().Follow(since)
+	defer cancel()
+
+	for _, e := range entries {
+		if enc.Encode(e) != nil {
+			return
+		}
+	}
+
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-followed:
+			if !ok {
+				// kartusche has been shut down
+				return
+			}
+			if enc.Encode(e) != nil {
+				// client has gone away
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
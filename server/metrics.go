@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requireMetricsToken only passes requests with token as the bearer token to next.
+// The metrics contain the names of all kartusches, so they are not public.
+func requireMetricsToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Kartusche metrics"`)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dbStatsCollector exports the database stats of all running kartusches.
+type dbStatsCollector struct {
+	s *Server
+
+	freePages       *prometheus.Desc
+	pendingPages    *prometheus.Desc
+	freeAllocBytes  *prometheus.Desc
+	freelistInuse   *prometheus.Desc
+	readTxTotal     *prometheus.Desc
+	openReadTx      *prometheus.Desc
+	pageAllocs      *prometheus.Desc
+	pageAllocBytes  *prometheus.Desc
+	nodeSplits      *prometheus.Desc
+	nodeSpills      *prometheus.Desc
+	writesTotal     *prometheus.Desc
+	writingSeconds  *prometheus.Desc
+	spillingSeconds *prometheus.Desc
+}
+
+func newDBStatsCollector(s *Server) *dbStatsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("kartusche_db_"+name, help, []string{"kartusche"}, nil)
+	}
+
+	return &dbStatsCollector{
+		s:               s,
+		freePages:       desc("free_pages", "Number of free pages on the freelist."),
+		pendingPages:    desc("pending_pages", "Number of pending pages on the freelist."),
+		freeAllocBytes:  desc("free_alloc_bytes", "Bytes allocated in free pages."),
+		freelistInuse:   desc("freelist_inuse_bytes", "Bytes used by the freelist."),
+		readTxTotal:     desc("read_transactions_total", "Number of started read transactions."),
+		openReadTx:      desc("open_read_transactions", "Number of open read transactions."),
+		pageAllocs:      desc("page_allocations_total", "Number of page allocations."),
+		pageAllocBytes:  desc("page_allocation_bytes_total", "Bytes allocated for pages."),
+		nodeSplits:      desc("node_splits_total", "Number of node splits."),
+		nodeSpills:      desc("node_spills_total", "Number of node spills."),
+		writesTotal:     desc("writes_total", "Number of writes performed."),
+		writingSeconds:  desc("writing_seconds_total", "Time spent writing to disk."),
+		spillingSeconds: desc("spilling_seconds_total", "Time spent spilling."),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.s.mu.Lock()
+	running := map[string]*kartusche{}
+	for name, k := range c.s.kartusches {
+		if k.runtime != nil {
+			running[name] = k
+		}
+	}
+	c.s.mu.Unlock()
+
+	for name, k := range running {
+		dbs, err := k.runtime.GetDBStats()
+		if err != nil {
+			c.s.log.Error(err, "while collecting db stats", "kartusche", name)
+			continue
+		}
+
+		gauge := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, name)
+		}
+
+		counter := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, name)
+		}
+
+		gauge(c.freePages, float64(dbs.FreePageN))
+		gauge(c.pendingPages, float64(dbs.PendingPageN))
+		gauge(c.freeAllocBytes, float64(dbs.FreeAlloc))
+		gauge(c.freelistInuse, float64(dbs.FreelistInuse))
+		counter(c.readTxTotal, float64(dbs.TxN))
+		gauge(c.openReadTx, float64(dbs.OpenTxN))
+		counter(c.pageAllocs, float64(dbs.TxStats.PageCount))
+		counter(c.pageAllocBytes, float64(dbs.TxStats.PageAlloc))
+		counter(c.nodeSplits, float64(dbs.TxStats.Split))
+		counter(c.nodeSpills, float64(dbs.TxStats.Spill))
+		counter(c.writesTotal, float64(dbs.TxStats.Write))
+		counter(c.writingSeconds, dbs.TxStats.WriteTime.Seconds())
+		counter(c.spillingSeconds, dbs.TxStats.SpillTime.Seconds())
+	}
+}
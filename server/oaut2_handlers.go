@@ -1,48 +1,131 @@
 package server
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/draganm/bolted"
+	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/server/verifier"
 	"github.com/gofrs/uuid"
 )
 
+// authVerify passes open login requests to the authentication provider.
+// Unknown request ids are rejected so that they don't take up the pending logins of the provider.
 func (s *Server) authVerify(w http.ResponseWriter, r *http.Request) {
+	err := bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		_, err := s.openLoginRequest(tx, r.URL.Query().Get("request_id"))
+		return err
+	})
+	if err != nil {
+		handleHttpError(w, err, s.log)
+		return
+	}
+
 	s.verifier.Verify(w, r)
 }
 
 func (s *Server) authOauth2Callback(w http.ResponseWriter, r *http.Request) {
 	var err error
 
+	login := AuditEntry{
+		Action: "login",
+	}
+
+	var res *verifier.AuthResult
+
+	defer func() {
+		// callbacks not belonging to a login request are not recorded, anyone can send them
+		if res == nil && err != nil {
+			s.log.Info("callback of unknown login request", "error", err.Error(), "sourceIP", s.sourceIP(r))
+			return
+		}
+		login.Outcome = AuditOutcomeSuccess
+		if err != nil {
+			login.Outcome = AuditOutcomeFailure
+		}
+		s.audit(r, login)
+	}()
+
 	defer func() {
 		handleHttpError(w, err, s.log)
 	}()
 
-	res, err := s.verifier.Callback(w, r)
+	res, err = s.verifier.Callback(w, r)
+	if res != nil {
+		login.UserID = res.UserID
+	}
 	if err != nil {
 		if res == nil {
 			return
 		}
 		bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
-			requestPath := openTokenRequests.Append(res.Code)
+			requestPath, openErr := s.openLoginRequest(tx, res.Code)
+			if openErr != nil {
+				return openErr
+			}
 			tx.Put(requestPath.Append("error"), []byte(err.Error()))
 			return nil
 		})
+		if errors.Is(err, verifier.ErrAccessDenied) {
+			err = newErrorWithCode(err, 403)
+		}
 		return
 	}
 
-	tokenID, err := uuid.NewV4()
+	token, err := uuid.NewV4()
 	if err != nil {
 		return
 	}
+	if res.UserID == "" {
+		err = errors.New("authentication provider did not return a user id")
+		return
+	}
+
 	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
-		requestPath := openTokenRequests.Append(res.Code)
-		tx.Put(requestPath.Append("token"), []byte(tokenID.String()))
-		tx.Put(tokensPath.Append(tokenID.String()), toJSON(authTokenInfo{
-			CreatedAt: time.Now(),
-			UserID:    "no-auth",
+		requestPath, err := s.openLoginRequest(tx, res.Code)
+		if err != nil {
+			return err
+		}
+		err = recordLogin(tx, res.UserID, res.Email)
+		if err != nil {
+			return err
+		}
+		tx.Put(requestPath.Append("token"), []byte(token.String()))
+		now := time.Now()
+		tx.Put(tokensPath.Append(token.String()), toJSON(authTokenInfo{
+			CreatedAt: now,
+			UserID:    res.UserID,
+			ExpiresAt: now.Add(s.tokenTTL),
 		}))
 		return nil
 	})
+	if err != nil {
+		return
+	}
+
+	login.TokenID = tokenID(token.String())
+}
+
+// openLoginRequest returns the path of the login request, or an error with code 404 if it does not exist,
+// has expired or has already been completed.
+func (s *Server) openLoginRequest(tx bolted.SugaredReadTx, requestID string) (dbpath.Path, error) {
+	requestPath := openTokenRequests.Append(requestID)
+
+	notFound := newErrorWithCode(errors.New("login request not found"), 404)
+
+	if requestID == "" || !tx.Exists(requestPath) {
+		return nil, notFound
+	}
+
+	if s.loginRequestExpired(tx, requestPath, time.Now()) {
+		return nil, notFound
+	}
+
+	if tx.Exists(requestPath.Append("token")) || tx.Exists(requestPath.Append("error")) {
+		return nil, notFound
+	}
+
+	return requestPath, nil
 }
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter limits the requests per client IP, allowing bursts of up to burst requests.
+type rateLimiter struct {
+	perSecond float64
+	burst     float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		perSecond: float64(perMinute) / 60,
+		burst:     float64(burst),
+		buckets:   map[string]*tokenBucket{},
+	}
+}
+
+// allow takes a token from the bucket of the key.
+// If the bucket is empty, it returns false and the time until a token is available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// buckets that have filled up again are the same as no bucket
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if l.tokens(b, now) >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = l.tokens(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.perSecond * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+func (l *rateLimiter) tokens(b *tokenBucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.perSecond)
+}
+
+// rateLimit responds with 429 to clients exceeding the rate of the limiter.
+func (s *Server) rateLimit(l *rateLimiter, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed, retryAfter := l.allow(s.sourceIP(r), time.Now())
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -22,12 +22,27 @@ func (s *Server) rm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = s.authorize(r.Context(), name, RoleAdmin)
+	if err != nil {
+		return
+	}
+
 	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
 		toDeletePath := kartuschesPath.Append(name)
 		if !tx.Exists(toDeletePath) {
 			return newErrorWithCode(errors.New("not found"), 404)
 		}
 		tx.Delete(toDeletePath)
+
+		versionsPath := codeVersionsPath.Append(name)
+		if tx.Exists(versionsPath) {
+			tx.Delete(versionsPath)
+		}
+
+		grantsPath := accessPath.Append(name)
+		if tx.Exists(grantsPath) {
+			tx.Delete(grantsPath)
+		}
 		return nil
 	})
 
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/draganm/kartusche/runtime"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) runningRuntime(name string) (runtime.Runtime, error) {
+	s.mu.Lock()
+	k, ok := s.kartusches[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, newErrorWithCode(errors.New("not found"), 404)
+	}
+
+	rt := k.runtime
+	if rt == nil {
+		return nil, newErrorWithCode(errors.New("kartusche is not running"), 409)
+	}
+
+	return rt, nil
+}
+
+func (s *Server) infoRoutes(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	var name = mux.Vars(r)["name"]
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	err = s.authorize(r.Context(), name, RoleViewer)
+	if err != nil {
+		return
+	}
+
+	rt, err := s.runningRuntime(name)
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	json.NewEncoder(w).Encode(rt.RouteStats())
+
+}
+
+func (s *Server) resetRouteStats(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	var name = mux.Vars(r)["name"]
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	err = s.authorize(r.Context(), name, RoleDeveloper)
+	if err != nil {
+		return
+	}
+
+	rt, err := s.runningRuntime(name)
+	if err != nil {
+		return
+	}
+
+	rt.ResetRouteStats()
+
+	w.WriteHeader(204)
+
+}
@@ -70,7 +70,7 @@ func (s *Server) runtimeManager() (err error) {
 		s.mu.Unlock()
 
 		for _, k := range toAdd {
-			err = k.start(s.log)
+			err = k.start(s.log, s.metrics, s.tracer)
 			s.mu.Lock()
 			s.kartusches[k.name] = k
 			s.mu.Unlock()
@@ -83,6 +83,7 @@ func (s *Server) runtimeManager() (err error) {
 			s.mu.Unlock()
 			if k != nil {
 				err = k.delete()
+				s.metrics.Remove(deleteName)
 				if err != nil {
 					log.Error(err, "while deleting Kartusche", "kartusche", deleteName)
 				}
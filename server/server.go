@@ -1,24 +1,35 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
 	"github.com/draganm/bolted/embedded"
+	"github.com/draganm/kartusche/runtime/metrics"
+	"github.com/draganm/kartusche/runtime/tracing"
 	"github.com/draganm/kartusche/server/verifier"
 	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/net/webdav"
 )
 
 type Server struct {
-	db            bolted.Database
-	mu            *sync.Mutex
-	kartusches    map[string]*kartusche
+	db         bolted.Database
+	mu         *sync.Mutex
+	kartusches map[string]*kartusche
+	// uploads are the names of kartusches being uploaded
+	uploads       map[string]struct{}
 	kartuschesDir string
 	tempDir       string
 	domain        string
@@ -27,6 +38,14 @@ type Server struct {
 	router       *mux.Router
 	log          logr.Logger
 	verifier     verifier.AuthenticationProvider
+	metrics      *metrics.Metrics
+	tracer       *tracing.Tracer
+	tokenTTL     time.Duration
+
+	loginRequestTTL time.Duration
+	trustedProxies  []*net.IPNet
+	// stopSweeping stops sweepExpired
+	stopSweeping context.CancelFunc
 }
 
 func createIfNotExisting(dir string, perm os.FileMode) error {
@@ -44,7 +63,21 @@ func createIfNotExisting(dir string, perm os.FileMode) error {
 	return nil
 }
 
-func Open(path string, domain string, verifier verifier.AuthenticationProvider, log logr.Logger) (*Server, error) {
+// Open opens the server state in path and starts the kartusches.
+// Tokens issued on login expire after tokenTTL, login requests not completed within loginRequestTTL expire.
+// Prometheus metrics are served under /metrics to requests bearing metricsToken, they are not served if metricsToken is empty.
+// X-Forwarded-For is used for the client IP only for requests from trustedProxies.
+// If tracer is not nil, spans of the kartusches are recorded.
+// Kartusches uploaded before ownership was recorded are assigned to legacyOwner, if it is not empty.
+func Open(path string, domain string, verifier verifier.AuthenticationProvider, tokenTTL, loginRequestTTL time.Duration, metricsToken string, trustedProxies []*net.IPNet, legacyOwner string, tracer *tracing.Tracer, log logr.Logger) (*Server, error) {
+	if tokenTTL <= 0 {
+		return nil, errors.New("token ttl must be positive")
+	}
+
+	if loginRequestTTL <= 0 {
+		return nil, errors.New("login request ttl must be positive")
+	}
+
 	err := createIfNotExisting(path, 0700)
 	if err != nil {
 		return nil, err
@@ -74,6 +107,9 @@ func Open(path string, domain string, verifier verifier.AuthenticationProvider,
 		openTokenRequests,
 		tokensPath,
 		usersPath,
+		codeVersionsPath,
+		auditLogPath,
+		accessPath,
 	}
 
 	pathsToCreate := []dbpath.Path{}
@@ -103,11 +139,36 @@ func Open(path string, domain string, verifier verifier.AuthenticationProvider,
 		}
 	}
 
+	err = bolted.SugaredWrite(db, func(tx bolted.SugaredWriteTx) error {
+		return setExpiryOfLegacyTokens(tx, time.Now().Add(tokenTTL))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while setting expiry of legacy tokens: %w", err)
+	}
+
+	var unowned []string
+	err = bolted.SugaredWrite(db, func(tx bolted.SugaredWriteTx) error {
+		unowned, err = setOwnerOfLegacyKartusches(tx, legacyOwner)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while setting owner of legacy kartusches: %w", err)
+	}
+
+	if len(unowned) > 0 {
+		log.Info("kartusches without an owner can't be accessed until the legacy owner is set", "kartusches", unowned)
+	}
+
 	r := mux.NewRouter()
 
+	reg := prometheus.NewRegistry()
+
+	sweepCtx, stopSweeping := context.WithCancel(context.Background())
+
 	s := &Server{
 		db:            db,
 		kartusches:    map[string]*kartusche{},
+		uploads:       map[string]struct{}{},
 		kartuschesDir: kartuschesDir,
 		tempDir:       tempDir,
 		mu:            new(sync.Mutex),
@@ -116,37 +177,85 @@ func Open(path string, domain string, verifier verifier.AuthenticationProvider,
 		ServerRouter:  r,
 		verifier:      verifier,
 		domain:        domain,
+		metrics:       metrics.New(reg),
+		tracer:        tracer,
+		tokenTTL:      tokenTTL,
+
+		loginRequestTTL: loginRequestTTL,
+		trustedProxies:  trustedProxies,
+		stopSweeping:    stopSweeping,
 	}
 
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		newDBStatsCollector(s),
+	)
+
 	// following methods don't require a valid token
 	// ar := r.PathPrefix("auth").Subrouter()
-	r.Methods("POST").Path("/auth/login").HandlerFunc(s.loginStart)
-	r.Methods("POST").Path("/auth/access_token").HandlerFunc(s.accessToken)
-	r.Methods("GET").Path("/auth/verify").HandlerFunc(s.authVerify)
+	// the CLI polls for the access token a few times per second while the user authenticates
+	r.Methods("POST").Path("/auth/login").HandlerFunc(s.rateLimit(newRateLimiter(loginRateLimit, loginRateLimit), s.loginStart))
+	r.Methods("POST").Path("/auth/access_token").HandlerFunc(s.rateLimit(newRateLimiter(accessTokenRateLimit, accessTokenRateLimit/6), s.accessToken))
+	r.Methods("GET").Path("/auth/verify").HandlerFunc(s.rateLimit(newRateLimiter(loginRateLimit, loginRateLimit), s.authVerify))
 	r.Methods("GET").Path("/auth/oauth2/callback").HandlerFunc(s.authOauth2Callback)
+	if metricsToken != "" {
+		r.Methods("GET").Path("/metrics").Handler(requireMetricsToken(metricsToken, promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+	}
 
-	r.Methods("PUT").Path("/kartusches/{name}").HandlerFunc(s.upload)
+	r.Methods("PUT").Path("/kartusches/{name}").HandlerFunc(s.upload).Name("upload")
 	r.Methods("GET").Path("/kartusches").HandlerFunc(s.list)
 	r.Methods("GET").Path("/kartusches/{name}").HandlerFunc(s.tarDump)
 	r.Methods("GET").Path("/kartusches/{name}/info/handlers").HandlerFunc(s.infoHandlers)
 	r.Methods("GET").Path("/kartusches/{name}/info/dbstats").HandlerFunc(s.infoDBStats)
-	r.Methods("DELETE").Path("/kartusches/{name}").HandlerFunc(s.rm)
-	r.Methods("PATCH").Path("/kartusches/{name}/code").HandlerFunc(s.updateCode)
+	r.Methods("GET").Path("/kartusches/{name}/info/routes").HandlerFunc(s.infoRoutes)
+	r.Methods("DELETE").Path("/kartusches/{name}/info/routes").HandlerFunc(s.resetRouteStats).Name("reset-route-stats")
+	r.Methods("GET").Path("/kartusches/{name}/logs").HandlerFunc(s.logs)
+	r.Methods("GET").Path("/kartusches/{name}/failures").HandlerFunc(s.listFailures)
+	r.Methods("GET").Path("/kartusches/{name}/failures/{id}").HandlerFunc(s.getFailure)
+	r.Methods("DELETE").Path("/kartusches/{name}").HandlerFunc(s.rm).Name("rm")
+	r.Methods("PATCH").Path("/kartusches/{name}/code").HandlerFunc(s.updateCode).Name("update-code")
+	r.Methods("POST").Path("/kartusches/{name}/code/dry-run").HandlerFunc(s.dryRunUpdateCode)
+	r.Methods("POST").Path("/kartusches/{name}/code/manifest").HandlerFunc(s.codeManifest)
+	r.Methods("PATCH").Path("/kartusches/{name}/code/patch").HandlerFunc(s.patchCode).Name("patch-code")
+	r.Methods("GET").Path("/kartusches/{name}/versions").HandlerFunc(s.listVersions)
+	r.Methods("GET").Path("/kartusches/{name}/access").HandlerFunc(s.listAccess)
+	r.Methods("PUT").Path("/kartusches/{name}/access/{user}").HandlerFunc(s.grantAccess).Name("grant")
+	r.Methods("DELETE").Path("/kartusches/{name}/access/{user}").HandlerFunc(s.revokeAccess).Name("revoke")
+	r.Methods("GET").Path("/audit").HandlerFunc(s.listAuditEntries)
+	r.Methods("GET").Path("/tokens").HandlerFunc(s.listTokens)
+	r.Methods("POST").Path("/tokens").HandlerFunc(s.createToken).Name("create-token")
+	r.Methods("DELETE").Path("/tokens/current").HandlerFunc(s.revokeCurrentToken).Name("logout")
+	r.Methods("DELETE").Path("/tokens/{id}").HandlerFunc(s.revokeToken).Name("revoke-token")
+	r.Methods("POST").Path("/kartusches/{name}/versions/{version}/rollback").HandlerFunc(s.rollback).Name("rollback")
 
-	r.PathPrefix("/dav").Handler(&webdav.Handler{
+	r.PathPrefix("/dav").Handler(s.authorizeWebdavWrites(&webdav.Handler{
 		Prefix:     "/dav",
 		FileSystem: s.WebdavFilesystem(),
 		LockSystem: webdav.NewMemLS(),
-	})
+	})).Name("webdav")
 
-	r.Use(s.authMiddleware)
+	// named routes are recorded in the audit log, see auditMiddleware
+	r.Use(s.auditMiddleware, s.authMiddleware)
 
 	go s.runtimeManager()
+	go s.sweepExpired(sweepCtx)
 
 	return s, nil
 
 }
 
+// Close stops deleting the expired login requests and tokens.
+func (s *Server) Close() {
+	s.stopSweeping()
+}
+
+// Requests per minute and client IP to start a login, to authenticate with the provider and to get the access token.
+const (
+	loginRateLimit       = 20
+	accessTokenRateLimit = 600
+)
+
 var kartuschesPath = dbpath.ToPath("kartusches")
 var authPath = dbpath.ToPath("auth")
 var openTokenRequests = authPath.Append("open_token_requests")
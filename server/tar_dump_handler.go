@@ -3,12 +3,14 @@ package server
 import (
 	"archive/tar"
 	"errors"
+	"io"
 	"net/http"
 	"path/filepath"
 	"time"
 
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/paths"
 	"github.com/draganm/kartusche/common/util/path"
 	"github.com/gorilla/mux"
 )
@@ -22,6 +24,11 @@ func (s *Server) tarDump(w http.ResponseWriter, r *http.Request) {
 		handleHttpError(w, err, s.log)
 	}()
 
+	err = s.authorize(r.Context(), name, RoleDeveloper)
+	if err != nil {
+		return
+	}
+
 	s.mu.Lock()
 	k, ok := s.kartusches[name]
 	s.mu.Unlock()
@@ -40,58 +47,65 @@ func (s *Server) tarDump(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/x-tar")
 
 	err = rt.Read(func(tx bolted.SugaredReadTx) error {
+		return writeTar(tx, w, func(p dbpath.Path) bool {
+			return len(p) == 1 && (paths.IsGenerated(p[0]) || p[0] == paths.Failures || p[0] == paths.JobQueue)
+		})
+	})
 
-		tw := tar.NewWriter(w)
-		toDo := []dbpath.Path{dbpath.NilPath}
-
-		for len(toDo) > 0 {
-			current := toDo[0]
-			toDo = toDo[1:]
-			for it := tx.Iterator(current); !it.IsDone(); it.Next() {
-				sp := current.Append(it.GetKey())
-				h := &tar.Header{
-					Name:    filepath.ToSlash(path.DBPathToFilePath(sp)),
-					ModTime: time.Now(),
-					Mode:    0700,
-				}
-				isMap := tx.IsMap(sp)
-				if isMap {
-					toDo = append(toDo, sp)
-					h.Typeflag = tar.TypeDir
-					h.Name += "/"
-					err := tw.WriteHeader(h)
-					if err != nil {
-						return err
-					}
-					continue
-				} else {
-					d := tx.Get(sp)
-					h.Typeflag = tar.TypeReg
-					h.Size = int64(len(d))
-					err := tw.WriteHeader(h)
-					if err != nil {
-						return err
-					}
-					_, err = tw.Write(d)
-					if err != nil {
-						return err
-					}
+	if err != nil {
+		s.log.Error(err, "while dumping tar")
+	}
+
+}
 
+// writeTar writes the content of the kartusche as a tar archive.
+// Paths for which skip returns true are not included.
+func writeTar(tx bolted.SugaredReadTx, w io.Writer, skip func(dbpath.Path) bool) error {
+
+	tw := tar.NewWriter(w)
+	toDo := []dbpath.Path{dbpath.NilPath}
+
+	for len(toDo) > 0 {
+		current := toDo[0]
+		toDo = toDo[1:]
+		for it := tx.Iterator(current); !it.IsDone(); it.Next() {
+			sp := current.Append(it.GetKey())
+			if skip != nil && skip(sp) {
+				continue
+			}
+			h := &tar.Header{
+				Name:    filepath.ToSlash(path.DBPathToFilePath(sp)),
+				ModTime: time.Now(),
+				Mode:    0700,
+			}
+			isMap := tx.IsMap(sp)
+			if isMap {
+				toDo = append(toDo, sp)
+				h.Typeflag = tar.TypeDir
+				h.Name += "/"
+				err := tw.WriteHeader(h)
+				if err != nil {
+					return err
+				}
+				continue
+			} else {
+				d := tx.Get(sp)
+				h.Typeflag = tar.TypeReg
+				h.Size = int64(len(d))
+				err := tw.WriteHeader(h)
+				if err != nil {
+					return err
+				}
+				_, err = tw.Write(d)
+				if err != nil {
+					return err
 				}
 
 			}
 
 		}
-		err := tw.Close()
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
 
-	if err != nil {
-		s.log.Error(err, "while dumping tar")
 	}
 
+	return tw.Close()
 }
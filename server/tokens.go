@@ -0,0 +1,386 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/draganm/bolted"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Actions a scoped token can be created for.
+const (
+	// ActionRead allows all GET requests of the kartusche, e.g. info, logs or clone.
+	ActionRead = "read"
+	// ActionUpload allows uploading the kartusche.
+	ActionUpload = "upload"
+	// ActionUpdateCode allows updating the code, including dry runs.
+	ActionUpdateCode = "update-code"
+	// ActionRollback allows rolling back the code to a previous version.
+	ActionRollback = "rollback"
+)
+
+var tokenActions = map[string]bool{
+	ActionRead:       true,
+	ActionUpload:     true,
+	ActionUpdateCode: true,
+	ActionRollback:   true,
+}
+
+// revokeCurrentTokenRoute can be called with any token, including scoped ones.
+const revokeCurrentTokenRoute = "DELETE /tokens/current"
+
+// scopedRouteActions maps the routes that can be called with a scoped token, apart from GET requests, to their actions.
+var scopedRouteActions = map[string]string{
+	"PUT /kartusches/{name}":                              ActionUpload,
+	"PATCH /kartusches/{name}/code":                       ActionUpdateCode,
+	"POST /kartusches/{name}/code/dry-run":                ActionUpdateCode,
+	"POST /kartusches/{name}/code/manifest":               ActionUpdateCode,
+	"PATCH /kartusches/{name}/code/patch":                 ActionUpdateCode,
+	"POST /kartusches/{name}/versions/{version}/rollback": ActionRollback,
+}
+
+// TokenInfo describes a token without revealing it.
+type TokenInfo struct {
+	ID          string     `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Kartusche   string     `json:"kartusche,omitempty"`
+	Actions     []string   `json:"actions,omitempty"`
+	Description string     `json:"description,omitempty"`
+	// Current is set for the token used to list the tokens.
+	Current bool `json:"current,omitempty"`
+}
+
+type CreateTokenRequest struct {
+	Kartusche   string   `json:"kartusche"`
+	Actions     []string `json:"actions"`
+	TTL         string   `json:"ttl,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+type CreateTokenResponse struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// isExpired checks if the token has expired.
+// Tokens without an expiry are expired, Open sets the expiry of tokens created before it was recorded.
+func (ti authTokenInfo) isExpired(now time.Time) bool {
+	return ti.ExpiresAt.IsZero() || now.After(ti.ExpiresAt)
+}
+
+// setExpiryOfLegacyTokens sets the expiry of tokens created before expiry was recorded to expiresAt.
+func setExpiryOfLegacyTokens(tx bolted.SugaredWriteTx, expiresAt time.Time) error {
+	legacy := map[string]authTokenInfo{}
+	for it := tx.Iterator(tokensPath); !it.IsDone(); it.Next() {
+		ti := authTokenInfo{}
+		err := json.Unmarshal(it.GetValue(), &ti)
+		if err != nil {
+			return fmt.Errorf("while unmarshalling token info: %w", err)
+		}
+
+		if ti.ExpiresAt.IsZero() {
+			ti.ExpiresAt = expiresAt
+			legacy[it.GetKey()] = ti
+		}
+	}
+
+	for tkn, ti := range legacy {
+		tx.Put(tokensPath.Append(tkn), toJSON(ti))
+	}
+
+	return nil
+}
+
+func (s *Server) deleteExpiredTokens(now time.Time) (int, error) {
+	expired := []string{}
+	err := bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		for it := tx.Iterator(tokensPath); !it.IsDone(); it.Next() {
+			ti := authTokenInfo{}
+			err := json.Unmarshal(it.GetValue(), &ti)
+			if err != nil {
+				return fmt.Errorf("while unmarshalling token info: %w", err)
+			}
+
+			if ti.isExpired(now) {
+				expired = append(expired, it.GetKey())
+			}
+		}
+
+		for _, tkn := range expired {
+			tx.Delete(tokensPath.Append(tkn))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+// allows checks if the token can be used for the request.
+// Tokens without a kartusche are not scoped and can be used for all requests.
+func (ti authTokenInfo) allows(r *http.Request) bool {
+	if ti.Kartusche == "" {
+		return true
+	}
+
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+
+	if r.Method+" "+tmpl == revokeCurrentTokenRoute {
+		return true
+	}
+
+	if tmpl != "/kartusches/{name}" && !strings.HasPrefix(tmpl, "/kartusches/{name}/") {
+		return false
+	}
+
+	if mux.Vars(r)["name"] != ti.Kartusche {
+		return false
+	}
+
+	action := scopedRouteActions[r.Method+" "+tmpl]
+	if r.Method == "GET" {
+		action = ActionRead
+	}
+
+	for _, a := range ti.Actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) listTokens(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	p := principalFromContext(r.Context())
+
+	tokens := []TokenInfo{}
+
+	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		for it := tx.Iterator(tokensPath); !it.IsDone(); it.Next() {
+			ti := authTokenInfo{}
+			err := json.Unmarshal(it.GetValue(), &ti)
+			if err != nil {
+				return fmt.Errorf("while unmarshalling token info: %w", err)
+			}
+
+			if ti.UserID != p.UserID {
+				continue
+			}
+
+			id := tokenID(it.GetKey())
+
+			info := TokenInfo{
+				ID:          id,
+				CreatedAt:   ti.CreatedAt,
+				Kartusche:   ti.Kartusche,
+				Actions:     ti.Actions,
+				Description: ti.Description,
+				Current:     id == p.TokenID,
+			}
+
+			if !ti.ExpiresAt.IsZero() {
+				expiresAt := ti.ExpiresAt
+				info.ExpiresAt = &expiresAt
+			}
+
+			tokens = append(tokens, info)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	ctr := CreateTokenRequest{}
+	err = json.NewDecoder(r.Body).Decode(&ctr)
+	if err != nil {
+		err = newErrorWithCode(fmt.Errorf("while decoding request: %w", err), 400)
+		return
+	}
+
+	if ctr.Kartusche == "" {
+		err = newErrorWithCode(errors.New("kartusche must be set"), 400)
+		return
+	}
+
+	if len(ctr.Actions) == 0 {
+		err = newErrorWithCode(errors.New("at least one action must be set"), 400)
+		return
+	}
+
+	for _, a := range ctr.Actions {
+		if !tokenActions[a] {
+			err = newErrorWithCode(fmt.Errorf("unknown action %q", a), 400)
+			return
+		}
+	}
+
+	// the ttl defaults to the ttl of tokens issued on login, scoped tokens don't outlive them
+	ttl := s.tokenTTL
+	if ctr.TTL != "" {
+		ttl, err = time.ParseDuration(ctr.TTL)
+		if err != nil || ttl <= 0 {
+			err = newErrorWithCode(fmt.Errorf("invalid ttl %q", ctr.TTL), 400)
+			return
+		}
+	}
+
+	if ttl > s.tokenTTL {
+		ttl = s.tokenTTL
+	}
+
+	token, err := uuid.NewV4()
+	if err != nil {
+		return
+	}
+
+	p := principalFromContext(r.Context())
+	now := time.Now()
+
+	ti := authTokenInfo{
+		CreatedAt:   now,
+		UserID:      p.UserID,
+		ExpiresAt:   now.Add(ttl),
+		Kartusche:   ctr.Kartusche,
+		Actions:     ctr.Actions,
+		Description: ctr.Description,
+	}
+
+	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		// a token for a kartusche that does not exist yet can be used to upload it, the upload makes the user
+		// of the token the owner. Requests made with the token are subject to the role of the user,
+		// if another user uploads the kartusche first they are denied.
+		if tx.Exists(kartuschesPath.Append(ctr.Kartusche)) {
+			err := authorizeTx(tx, ctr.Kartusche, p, RoleDeveloper)
+			if err != nil {
+				return err
+			}
+		}
+
+		tx.Put(tokensPath.Append(token.String()), toJSON(ti))
+		return nil
+	})
+
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(CreateTokenResponse{
+		ID:        tokenID(token.String()),
+		Token:     token.String(),
+		ExpiresAt: ti.ExpiresAt,
+	})
+}
+
+func (s *Server) revokeToken(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	id := mux.Vars(r)["id"]
+	p := principalFromContext(r.Context())
+
+	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		for it := tx.Iterator(tokensPath); !it.IsDone(); it.Next() {
+			if tokenID(it.GetKey()) != id {
+				continue
+			}
+
+			ti := authTokenInfo{}
+			err := json.Unmarshal(it.GetValue(), &ti)
+			if err != nil {
+				return fmt.Errorf("while unmarshalling token info: %w", err)
+			}
+
+			if ti.UserID != p.UserID {
+				break
+			}
+
+			tx.Delete(tokensPath.Append(it.GetKey()))
+			return nil
+		}
+
+		return newErrorWithCode(fmt.Errorf("token %s not found", id), 404)
+	})
+
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// revokeCurrentToken revokes the token used for the request, e.g. on logout.
+func (s *Server) revokeCurrentToken(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		handleHttpError(w, err, s.log)
+	}()
+
+	p := principalFromContext(r.Context())
+
+	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
+		for it := tx.Iterator(tokensPath); !it.IsDone(); it.Next() {
+			if tokenID(it.GetKey()) == p.TokenID {
+				tx.Delete(tokensPath.Append(it.GetKey()))
+				return nil
+			}
+		}
+
+		return newErrorWithCode(errors.New("current token not found"), 404)
+	})
+
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies parses the addresses of the proxies in front of the server, given as IPs or CIDRs.
+func ParseTrustedProxies(addresses []string) ([]*net.IPNet, error) {
+	proxies := []*net.IPNet{}
+	for _, a := range addresses {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", a)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", a, err)
+		}
+
+		proxies = append(proxies, n)
+	}
+
+	return proxies, nil
+}
+
+func (s *Server) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, p := range s.trustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourceIP is the address of the client.
+// X-Forwarded-For is only used for requests from trusted proxies, the client is the last address in it
+// that is not a trusted proxy.
+func (s *Server) sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !s.isTrustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+
+		host = addr
+		if !s.isTrustedProxy(addr) {
+			break
+		}
+	}
+
+	return host
+}
@@ -2,14 +2,19 @@ package server
 
 import (
 	"archive/tar"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
+	"strings"
 
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/paths"
 	"github.com/draganm/kartusche/common/util/path"
+	"github.com/draganm/kartusche/runtime"
 	"github.com/gorilla/mux"
 )
 
@@ -27,6 +32,11 @@ func (s *Server) updateCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = s.authorize(r.Context(), name, RoleDeveloper)
+	if err != nil {
+		return
+	}
+
 	s.mu.Lock()
 	k, ok := s.kartusches[name]
 	s.mu.Unlock()
@@ -42,46 +52,68 @@ func (s *Server) updateCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	snapshot := new(bytes.Buffer)
+	var hash string
+
 	err = rt.Update(func(tx bolted.SugaredWriteTx) error {
-		// step one: delete everything apart from the data
-		for it := tx.Iterator(dbpath.NilPath); !it.IsDone(); it.Next() {
-			if it.GetKey() != "data" {
-				tx.Delete(dbpath.ToPath(it.GetKey()))
-			}
+		err := replaceCode(tx, r.Body)
+		if err != nil {
+			return err
 		}
+		hash = runtime.CodeHash(tx)
+		return writeCodeTar(tx, snapshot)
+	})
 
-		// step two: unpack the tar
-		tr := tar.NewReader(r.Body)
+	if err != nil {
+		return
+	}
 
-		for {
-			h, err := tr.Next()
-			if err == io.EOF {
-				return nil
-			}
+	_, err = s.addCodeVersion(name, CodeVersion{CodeHash: hash}, principalFromContext(r.Context()), snapshot.Bytes())
+	if err != nil {
+		err = fmt.Errorf("while recording code version: %w", err)
+		return
+	}
 
-			if err != nil {
-				return fmt.Errorf("while reading code tar: %w", err)
-			}
+	w.WriteHeader(204)
 
-			dp := path.FilePathToDBPath(h.Name)
-			if h.Typeflag == tar.TypeDir {
-				tx.CreateMap(dp)
-			}
-			if h.Typeflag == tar.TypeReg {
-				d, err := io.ReadAll(tr)
-				if err != nil {
-					return fmt.Errorf("while reading entry %s: %w", h.Name, err)
-				}
-				tx.Put(dp, d)
-			}
+}
+
+// replaceCode deletes all of the code and
+// unpacks the code tar.
+func replaceCode(tx bolted.SugaredWriteTx, r io.Reader) error {
+	// step one: delete everything apart from the data, job queue and generated paths
+	for it := tx.Iterator(dbpath.NilPath); !it.IsDone(); it.Next() {
+		if paths.IsCode(it.GetKey()) {
+			tx.Delete(dbpath.ToPath(it.GetKey()))
 		}
+	}
 
-	})
+	// step two: unpack the tar
+	tr := tar.NewReader(r)
 
-	if err != nil {
-		return
-	}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
 
-	w.WriteHeader(204)
+		if err != nil {
+			return fmt.Errorf("while reading code tar: %w", err)
+		}
 
+		dp := path.FilePathToDBPath(filepath.FromSlash(strings.TrimSuffix(h.Name, "/")))
+		if len(dp) > 0 && (paths.IsGenerated(dp[0]) || dp[0] == paths.JobQueue) {
+			continue
+		}
+		if h.Typeflag == tar.TypeDir {
+			tx.CreateMap(dp)
+		}
+		if h.Typeflag == tar.TypeReg {
+			d, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("while reading entry %s: %w", h.Name, err)
+			}
+			tx.Put(dp, d)
+		}
+	}
 }
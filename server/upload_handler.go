@@ -3,6 +3,7 @@ package server
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -26,13 +27,31 @@ func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tf, err := os.CreateTemp(s.tempDir, "")
-	if err != nil {
+	p := principalFromContext(r.Context())
+
+	if !s.reserveUpload(name) {
+		err = newErrorWithCode(errors.New("already being uploaded"), 419)
 		return
 	}
 
-	_, err = io.Copy(tf, r.Body)
+	defer s.releaseUpload(name)
+
+	// the kartusche file must not be touched unless the name is free
+	err = bolted.SugaredRead(s.db, func(tx bolted.SugaredReadTx) error {
+		if !tx.Exists(kartuschesPath.Append(name)) {
+			return nil
+		}
+		err := authorizeTx(tx, name, p, RoleViewer)
+		if err != nil {
+			return err
+		}
+		return newErrorWithCode(errors.New("already exists"), 419)
+	})
+	if err != nil {
+		return
+	}
 
+	tf, err := os.CreateTemp(s.tempDir, "")
 	if err != nil {
 		return
 	}
@@ -42,11 +61,23 @@ func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
 		os.Remove(tf.Name())
 	}()
 
+	_, err = io.Copy(tf, r.Body)
+
+	if err != nil {
+		return
+	}
+
 	err = tf.Close()
 	if err != nil {
 		return
 	}
 
+	code, hash, err := snapshotKartuscheFile(tf.Name())
+	if err != nil {
+		err = newErrorWithCode(err, 400)
+		return
+	}
+
 	kartuscheFilePath := filepath.Join(s.kartuschesDir, name)
 
 	err = os.Rename(tf.Name(), kartuscheFilePath)
@@ -54,13 +85,17 @@ func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	registered := false
+
 	defer func() {
-		if err != nil {
+		if err != nil && !registered {
 			os.Remove(kartuscheFilePath)
 		}
 	}()
 
-	k := &kartusche{}
+	k := &kartusche{
+		Owner: p.UserID,
+	}
 
 	kb, err := json.Marshal(k)
 	if err != nil {
@@ -68,12 +103,7 @@ func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = bolted.SugaredWrite(s.db, func(tx bolted.SugaredWriteTx) error {
-		newKartuschePath := kartuschesPath.Append(name)
-		if tx.Exists(newKartuschePath) {
-			return newErrorWithCode(errors.New("already exists"), 419)
-		}
-
-		tx.Put(newKartuschePath, kb)
+		tx.Put(kartuschesPath.Append(name), kb)
 		return nil
 	})
 
@@ -81,6 +111,35 @@ func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	registered = true
+
+	_, err = s.addCodeVersion(name, CodeVersion{CodeHash: hash}, p, code)
+	if err != nil {
+		err = fmt.Errorf("while recording code version: %w", err)
+		return
+	}
+
 	w.WriteHeader(204)
 
 }
+
+// reserveUpload reserves the name for an upload in progress.
+// It returns false if the name is already reserved.
+func (s *Server) reserveUpload(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, found := s.uploads[name]
+	if found {
+		return false
+	}
+
+	s.uploads[name] = struct{}{}
+	return true
+}
+
+func (s *Server) releaseUpload(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, name)
+}
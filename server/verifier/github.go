@@ -18,21 +18,7 @@ type githubProvider struct {
 
 func (m *githubProvider) Verify(w http.ResponseWriter, r *http.Request) {
 
-	scheme := r.Header.Get("X-Forwarded-Proto")
-
-	if scheme == "" {
-		if r.TLS != nil {
-			scheme = "https"
-		} else {
-			scheme = "http"
-		}
-	}
-
-	verificationURL := &url.URL{
-		Scheme: scheme,
-		Host:   r.Host,
-		Path:   "/auth/oauth2/callback",
-	}
+	verificationURL := callbackURL(r)
 
 	q := url.Values{}
 	q.Set("state", r.URL.Query().Get("request_id"))
@@ -116,20 +102,7 @@ type UserOrg struct {
 func (m *githubProvider) Callback(w http.ResponseWriter, r *http.Request) (ar *AuthResult, err error) {
 	w.Write([]byte("authentication successful"))
 
-	scheme := r.Header.Get("X-Forwarded-Proto")
-	if scheme == "" {
-		if r.TLS != nil {
-			scheme = "https"
-		} else {
-			scheme = "http"
-		}
-	}
-
-	verificationURL := &url.URL{
-		Scheme: scheme,
-		Host:   r.Host,
-		Path:   "/auth/oauth2/callback",
-	}
+	verificationURL := callbackURL(r)
 
 	reqParams := r.URL.Query()
 
@@ -229,13 +202,14 @@ func (m *githubProvider) Callback(w http.ResponseWriter, r *http.Request) (ar *A
 	for _, uo := range userOrgs {
 		if uo.Login == m.organization {
 			return &AuthResult{
-				Code:  code,
-				Email: up.Email,
+				Code:   code,
+				UserID: up.Login,
+				Email:  up.Email,
 			}, nil
 		}
 	}
 
-	return nil, fmt.Errorf("user is not in the requested org")
+	return nil, fmt.Errorf("%w: user is not in the requested org", ErrAccessDenied)
 }
 
 // https://kartusche.netice9.xyz/auth/oauth2/callback
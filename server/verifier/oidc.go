@@ -0,0 +1,261 @@
+package verifier
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig configures the OpenID Connect provider.
+type OIDCConfig struct {
+	// IssuerURL is the issuer of the identity provider, the discovery document is served under
+	// <IssuerURL>/.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// Scopes are requested in addition to `openid`.
+	Scopes []string
+	// UserIDClaim is the claim of the ID token used as the user id.
+	UserIDClaim string
+	// GroupsClaim is the claim of the ID token listing the groups of the user.
+	GroupsClaim string
+	// AllowedGroups, when not empty, restricts the users to members of at least one of the groups.
+	AllowedGroups []string
+	// RequiredClaims must all have the value in the ID token, or contain it if the claim is a list.
+	RequiredClaims map[string]string
+	// LoginTTL is the time the user has to authenticate with the identity provider, defaults to defaultLoginTTL.
+	LoginTTL time.Duration
+}
+
+// defaultLoginTTL is used when OIDCConfig.LoginTTL is not set.
+const defaultLoginTTL = 10 * time.Minute
+
+// maxPendingLogins limits the logins waiting for the callback of the identity provider.
+const maxPendingLogins = 1000
+
+type pendingLogin struct {
+	codeVerifier string
+	nonce        string
+	createdAt    time.Time
+}
+
+type oidcProvider struct {
+	cfg      OIDCConfig
+	client   *http.Client
+	endpoint oauth2.Endpoint
+	verifier *oidc.IDTokenVerifier
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+}
+
+// NewOIDCProvider returns a provider authenticating users with an OpenID Connect identity provider,
+// using the authorization code flow with PKCE.
+// The endpoints and signing keys of the identity provider are discovered from the issuer.
+func NewOIDCProvider(cfg OIDCConfig) (AuthenticationProvider, error) {
+	if cfg.UserIDClaim == "" {
+		cfg.UserIDClaim = "email"
+	}
+
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+
+	if cfg.LoginTTL <= 0 {
+		cfg.LoginTTL = defaultLoginTTL
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	// the context is used for fetching the signing keys for the lifetime of the provider
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), client), cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("while discovering the identity provider: %w", err)
+	}
+
+	return &oidcProvider{
+		cfg:      cfg,
+		client:   client,
+		endpoint: provider.Endpoint(),
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		pending:  map[string]pendingLogin{},
+	}, nil
+}
+
+// oauth2Config returns the OAuth2 config for the server handling the request.
+func (p *oidcProvider) oauth2Config(r *http.Request) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     p.endpoint,
+		RedirectURL:  callbackURL(r).String(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, p.cfg.Scopes...),
+	}
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (p *oidcProvider) Verify(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("request_id")
+	if state == "" {
+		http.Error(w, "request_id is missing", 400)
+		return
+	}
+
+	nonce, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	codeVerifier := oauth2.GenerateVerifier()
+
+	p.mu.Lock()
+	now := time.Now()
+	for s, pl := range p.pending {
+		if now.Sub(pl.createdAt) > p.cfg.LoginTTL {
+			delete(p.pending, s)
+		}
+	}
+
+	if len(p.pending) >= maxPendingLogins {
+		p.mu.Unlock()
+		http.Error(w, "too many pending logins", http.StatusServiceUnavailable)
+		return
+	}
+
+	p.pending[state] = pendingLogin{
+		codeVerifier: codeVerifier,
+		nonce:        nonce,
+		createdAt:    now,
+	}
+	p.mu.Unlock()
+
+	authorizeURL := p.oauth2Config(r).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+
+	http.Redirect(w, r, authorizeURL, 302)
+}
+
+func (p *oidcProvider) Callback(w http.ResponseWriter, r *http.Request) (*AuthResult, error) {
+	reqParams := r.URL.Query()
+	state := reqParams.Get("state")
+
+	p.mu.Lock()
+	pl, found := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+
+	if !found || time.Since(pl.createdAt) > p.cfg.LoginTTL {
+		return nil, errors.New("unknown or expired login request")
+	}
+
+	ar := &AuthResult{Code: state}
+
+	authError := reqParams.Get("error")
+	if authError != "" {
+		return ar, fmt.Errorf("auth error: %s %s", authError, reqParams.Get("error_description"))
+	}
+
+	ctx := oidc.ClientContext(r.Context(), p.client)
+
+	token, err := p.oauth2Config(r).Exchange(ctx, reqParams.Get("code"), oauth2.VerifierOption(pl.codeVerifier))
+	if err != nil {
+		return ar, fmt.Errorf("while getting token: %w", err)
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return ar, errors.New("token response has no id token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return ar, fmt.Errorf("while verifying id token: %w", err)
+	}
+
+	if idToken.Nonce != pl.nonce {
+		return ar, errors.New("nonce of the id token does not match")
+	}
+
+	claims := map[string]interface{}{}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return ar, fmt.Errorf("while unmarshalling claims of the id token: %w", err)
+	}
+
+	err = p.checkAllowed(claims)
+	if err != nil {
+		return ar, err
+	}
+
+	ar.UserID, _ = claims[p.cfg.UserIDClaim].(string)
+	if ar.UserID == "" {
+		return ar, fmt.Errorf("id token has no %s claim", p.cfg.UserIDClaim)
+	}
+
+	ar.Email, _ = claims["email"].(string)
+
+	if p.cfg.UserIDClaim == "email" && claims["email_verified"] == false {
+		return ar, fmt.Errorf("%w: email of the user is not verified", ErrAccessDenied)
+	}
+
+	w.Write([]byte("authentication successful"))
+
+	return ar, nil
+}
+
+// checkAllowed checks the claims against the allowed groups and the required claims.
+func (p *oidcProvider) checkAllowed(claims map[string]interface{}) error {
+	if len(p.cfg.AllowedGroups) > 0 {
+		allowed := false
+		for _, g := range p.cfg.AllowedGroups {
+			if claimContains(claims[p.cfg.GroupsClaim], g) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: user is not in any of the allowed groups", ErrAccessDenied)
+		}
+	}
+
+	for claim, value := range p.cfg.RequiredClaims {
+		if !claimContains(claims[claim], value) {
+			return fmt.Errorf("%w: claim %s of the user does not have the required value", ErrAccessDenied, claim)
+		}
+	}
+
+	return nil
+}
+
+// claimContains checks if the claim has the value or, if the claim is a list, contains it.
+func claimContains(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case []interface{}:
+		for _, v := range c {
+			if fmt.Sprint(v) == value {
+				return true
+			}
+		}
+		return false
+	case nil:
+		return false
+	default:
+		return fmt.Sprint(c) == value
+	}
+}
@@ -1,13 +1,41 @@
 package verifier
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
 
 type AuthResult struct {
-	Code  string
-	Email string
+	Code string
+	// UserID identifies the user, kartusches are owned by and granted to user ids.
+	UserID string
+	Email  string
 }
 
+// ErrAccessDenied is returned by Callback when the user has authenticated, but is not allowed to use the server.
+var ErrAccessDenied = errors.New("access denied")
+
 type AuthenticationProvider interface {
 	Verify(w http.ResponseWriter, r *http.Request)
 	Callback(w http.ResponseWriter, r *http.Request) (*AuthResult, error)
 }
+
+// callbackURL is the URL of the server the provider redirects to after authentication.
+func callbackURL(r *http.Request) *url.URL {
+	scheme := r.Header.Get("X-Forwarded-Proto")
+
+	if scheme == "" {
+		if r.TLS != nil {
+			scheme = "https"
+		} else {
+			scheme = "http"
+		}
+	}
+
+	return &url.URL{
+		Scheme: scheme,
+		Host:   r.Host,
+		Path:   "/auth/oauth2/callback",
+	}
+}
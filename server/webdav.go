@@ -1,10 +1,12 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"path"
 	"sort"
@@ -13,6 +15,8 @@ import (
 
 	"github.com/draganm/bolted"
 	"github.com/draganm/bolted/dbpath"
+	"github.com/draganm/kartusche/common/paths"
+	"github.com/draganm/kartusche/runtime"
 	"github.com/dsnet/golib/memfile"
 	"github.com/go-logr/logr"
 	"golang.org/x/net/webdav"
@@ -38,14 +42,19 @@ func (fs *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) (e
 		}
 	}()
 
-	kartusche, kartuschePath := fs.getKartuscheAndPath(name)
+	kartusche, kartuschePath := fs.getKartuscheAndPath(ctx, name)
 	if kartusche == nil {
 		return os.ErrNotExist
 	}
 
+	err = fs.authorizeWrite(ctx, kartusche, kartuschePath)
+	if err != nil {
+		return err
+	}
+
 	pth := pathToDBPath(kartuschePath)
 
-	return kartusche.runtime.Update(func(tx bolted.SugaredWriteTx) error {
+	return fs.s.updateOverWebdav(kartusche, principalFromContext(ctx), isCodePath(kartuschePath), func(tx bolted.SugaredWriteTx) error {
 		if tx.Exists(pth) {
 			return os.ErrExist
 		}
@@ -55,7 +64,10 @@ func (fs *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) (e
 
 }
 
-func (fs *webdavFS) getKartuscheAndPath(name string) (*kartusche, string) {
+// getKartuscheAndPath returns the kartusche and the path within it.
+// Kartusches the user in ctx has no access to are treated as not existing,
+// as are the recorded failures, containing request bodies, for users without the developer role.
+func (fs *webdavFS) getKartuscheAndPath(ctx context.Context, name string) (*kartusche, string) {
 	cleanPath := strings.TrimLeft(path.Clean(name), "/")
 	kartuscheName, kartuschePath, _ := strings.Cut(cleanPath, "/")
 
@@ -68,9 +80,117 @@ func (fs *webdavFS) getKartuscheAndPath(name string) (*kartusche, string) {
 		return nil, ""
 	}
 
+	readRole := RoleViewer
+	first, _, _ := strings.Cut(kartuschePath, "/")
+	if first == paths.Failures {
+		readRole = RoleDeveloper
+	}
+
+	err := fs.s.authorize(ctx, kartuscheName, readRole)
+	if err != nil {
+		return nil, ""
+	}
+
 	return kartusche, kartuschePath
 }
 
+// writeRole is the role required to change the path within a kartusche.
+// Changing code requires the developer role, changing data or the whole kartusche the admin role.
+func writeRole(kartuschePath string) Role {
+	first, _, _ := strings.Cut(kartuschePath, "/")
+	if first == "" || first == paths.Data {
+		return RoleAdmin
+	}
+	return RoleDeveloper
+}
+
+// authorizeWrite returns os.ErrPermission if the user in ctx may not change the path within the kartusche.
+func (fs *webdavFS) authorizeWrite(ctx context.Context, k *kartusche, kartuschePath string) error {
+	err := fs.s.authorize(ctx, k.name, writeRole(kartuschePath))
+	if err != nil {
+		return os.ErrPermission
+	}
+
+	return nil
+}
+
+// isCodePath returns true if changing the path within a kartusche can change its code.
+func isCodePath(kartuschePath string) bool {
+	first, _, _ := strings.Cut(kartuschePath, "/")
+	return first == "" || paths.IsCode(first)
+}
+
+// updateOverWebdav changes the kartusche and, when the change can touch the code, records a code version
+// unless the code is the same as in the newest version.
+func (s *Server) updateOverWebdav(k *kartusche, p principal, code bool, fn func(tx bolted.SugaredWriteTx) error) error {
+	if !code {
+		return k.runtime.Update(fn)
+	}
+
+	lastHash, err := s.lastCodeHash(k.name)
+	if err != nil {
+		return fmt.Errorf("while getting last code version: %w", err)
+	}
+
+	var hash string
+	snapshot := new(bytes.Buffer)
+
+	err = k.runtime.Update(func(tx bolted.SugaredWriteTx) error {
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+
+		hash = runtime.CodeHash(tx)
+		if hash == lastHash {
+			return nil
+		}
+
+		return writeCodeTar(tx, snapshot)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if hash == lastHash {
+		return nil
+	}
+
+	_, err = s.addCodeVersion(k.name, CodeVersion{CodeHash: hash}, p, snapshot.Bytes())
+	if err != nil {
+		return fmt.Errorf("while recording code version: %w", err)
+	}
+
+	return nil
+}
+
+// authorizeWebdavWrites responds with 403 to WebDAV requests changing a path the user may not change.
+// The WebDAV handler would respond to some of them as if the file did not exist.
+func (s *Server) authorizeWebdavWrites(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !webdavWriteMethods[r.Method] {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cleanPath := strings.TrimLeft(path.Clean(strings.TrimPrefix(r.URL.Path, "/dav")), "/")
+		kartuscheName, kartuschePath, _ := strings.Cut(cleanPath, "/")
+		if kartuscheName == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		err := s.authorize(r.Context(), kartuscheName, writeRole(kartuschePath))
+		if err != nil {
+			handleHttpError(w, err, s.log)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
 func (fs *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (fi webdav.File, err error) {
 
 	log := fs.s.log.WithValues("object", "webdavFS", "method", "OpenFile", "name", name, "flag", flag, "perm", perm)
@@ -94,15 +214,22 @@ func (fs *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os
 	}
 
 	if name == "" || name == "/" {
-		return &serverFile{s: fs.s}, nil
+		return &serverFile{s: fs.s, ctx: ctx}, nil
 	}
 
-	kartusche, kartuschePath := fs.getKartuscheAndPath(name)
+	kartusche, kartuschePath := fs.getKartuscheAndPath(ctx, name)
 
 	if kartusche == nil {
 		return nil, os.ErrNotExist
 	}
 
+	if flag&(os.O_RDWR|os.O_WRONLY|os.O_CREATE|os.O_TRUNC) != 0 {
+		err = fs.authorizeWrite(ctx, kartusche, kartuschePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	kd := &kartuscheDir{
 		name: name,
 		log:  fs.s.log,
@@ -116,12 +243,15 @@ func (fs *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os
 	// creating new file
 	case err == os.ErrNotExist && (flag&os.O_CREATE) != 0:
 		return &fileWriter{
-			name:      path.Base(name),
-			log:       log,
-			readOnly:  false,
-			path:      pathToDBPath(kartuschePath),
-			kartusche: kartusche,
-			File:      memfile.New([]byte{}),
+			name:          path.Base(name),
+			log:           log,
+			readOnly:      false,
+			path:          pathToDBPath(kartuschePath),
+			kartuschePath: kartuschePath,
+			kartusche:     kartusche,
+			s:             fs.s,
+			principal:     principalFromContext(ctx),
+			File:          memfile.New([]byte{}),
 		}, nil
 	case err != nil:
 		return nil, err
@@ -162,12 +292,15 @@ func (fs *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os
 	}
 
 	return &fileWriter{
-		name:      path.Base(name),
-		log:       log,
-		readOnly:  readOnly,
-		path:      pth,
-		kartusche: kartusche,
-		File:      mf,
+		name:          path.Base(name),
+		log:           log,
+		readOnly:      readOnly,
+		path:          pth,
+		kartuschePath: kartuschePath,
+		kartusche:     kartusche,
+		s:             fs.s,
+		principal:     principalFromContext(ctx),
+		File:          mf,
 	}, nil
 
 }
@@ -182,14 +315,19 @@ func (fs *webdavFS) RemoveAll(ctx context.Context, name string) (err error) {
 
 	}()
 
-	kartusche, kartuschePath := fs.getKartuscheAndPath(name)
+	kartusche, kartuschePath := fs.getKartuscheAndPath(ctx, name)
 	if kartusche == nil {
 		return os.ErrNotExist
 	}
 
+	err = fs.authorizeWrite(ctx, kartusche, kartuschePath)
+	if err != nil {
+		return err
+	}
+
 	pth := pathToDBPath(kartuschePath)
 
-	return kartusche.runtime.Update(func(tx bolted.SugaredWriteTx) error {
+	return fs.s.updateOverWebdav(kartusche, principalFromContext(ctx), isCodePath(kartuschePath), func(tx bolted.SugaredWriteTx) error {
 		if !tx.Exists(pth) {
 			return os.ErrNotExist
 		}
@@ -207,12 +345,12 @@ func (fs *webdavFS) Rename(ctx context.Context, oldName, newName string) (err er
 		}
 	}()
 
-	oldKartusche, oldKartuschePath := fs.getKartuscheAndPath(oldName)
+	oldKartusche, oldKartuschePath := fs.getKartuscheAndPath(ctx, oldName)
 	if oldKartusche == nil {
 		return os.ErrNotExist
 	}
 
-	newKartusche, newKartuschePath := fs.getKartuscheAndPath(newName)
+	newKartusche, newKartuschePath := fs.getKartuscheAndPath(ctx, newName)
 	if newKartusche == nil {
 		return os.ErrNotExist
 	}
@@ -221,10 +359,22 @@ func (fs *webdavFS) Rename(ctx context.Context, oldName, newName string) (err er
 		return os.ErrNotExist
 	}
 
+	err = fs.authorizeWrite(ctx, oldKartusche, oldKartuschePath)
+	if err != nil {
+		return err
+	}
+
+	err = fs.authorizeWrite(ctx, newKartusche, newKartuschePath)
+	if err != nil {
+		return err
+	}
+
 	oldPath := pathToDBPath(oldKartuschePath)
 	newPath := pathToDBPath(newKartuschePath)
 
-	return oldKartusche.runtime.Update(func(tx bolted.SugaredWriteTx) error {
+	code := isCodePath(oldKartuschePath) || isCodePath(newKartuschePath)
+
+	return fs.s.updateOverWebdav(oldKartusche, principalFromContext(ctx), code, func(tx bolted.SugaredWriteTx) error {
 		if !tx.Exists(oldPath) {
 			return os.ErrNotExist
 		}
@@ -277,7 +427,7 @@ func (fs *webdavFS) Stat(ctx context.Context, name string) (_ os.FileInfo, err e
 		return &finfo{name: "/", mode: os.ModeDir}, nil
 	}
 
-	kartusche, kartuschePath := fs.getKartuscheAndPath(name)
+	kartusche, kartuschePath := fs.getKartuscheAndPath(ctx, name)
 	if kartusche == nil {
 		return nil, os.ErrNotExist
 	}
@@ -306,11 +456,14 @@ func (fs *webdavFS) Stat(ctx context.Context, name string) (_ os.FileInfo, err e
 }
 
 type fileWriter struct {
-	name      string
-	log       logr.Logger
-	readOnly  bool
-	path      dbpath.Path
-	kartusche *kartusche
+	name          string
+	log           logr.Logger
+	readOnly      bool
+	path          dbpath.Path
+	kartuschePath string
+	kartusche     *kartusche
+	s             *Server
+	principal     principal
 	*memfile.File
 }
 
@@ -329,7 +482,7 @@ func (fw *fileWriter) Close() (err error) {
 		return nil
 	}
 
-	return fw.kartusche.runtime.Update(func(tx bolted.SugaredWriteTx) error {
+	return fw.s.updateOverWebdav(fw.kartusche, fw.principal, isCodePath(fw.kartuschePath), func(tx bolted.SugaredWriteTx) error {
 		tx.Put(fw.path, fw.File.Bytes())
 		return nil
 	})
@@ -344,7 +497,8 @@ func (fw *fileWriter) Stat() (fi fs.FileInfo, err error) {
 }
 
 type serverFile struct {
-	s *Server
+	s   *Server
+	ctx context.Context
 }
 
 func (sf *serverFile) Close() error {
@@ -368,10 +522,18 @@ func (sf *serverFile) Readdir(count int) (fis []fs.FileInfo, err error) {
 		}
 
 	}()
+	names := []string{}
 	sf.s.mu.Lock()
-	defer sf.s.mu.Unlock()
-	fileInfos := []fs.FileInfo{}
 	for name := range sf.s.kartusches {
+		names = append(names, name)
+	}
+	sf.s.mu.Unlock()
+
+	fileInfos := []fs.FileInfo{}
+	for _, name := range names {
+		if sf.s.authorize(sf.ctx, name, RoleViewer) != nil {
+			continue
+		}
 		fileInfos = append(fileInfos, &finfo{
 			name: name,
 			mode: fs.ModeDir,
@@ -9,16 +9,22 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 type runningServer struct {
 	serverURL  string
 	contentURL string
+	workDir    string
 	shutdown   func() error
+	// stop stops the server without removing its work dir.
+	stop func() error
 }
 
-func startServer() (*runningServer, error) {
+// startServer starts the server, env are additional KEY=VALUE environment variables, e.g. to configure authentication.
+// The mock auth provider is allowed unless env overrides INSECURE_MOCK_AUTH.
+func startServer(binaryPath string, env ...string) (*runningServer, error) {
 	td, err := os.MkdirTemp("", "kartusche-test")
 	if err != nil {
 		return nil, fmt.Errorf("while creating test temp dir: %w", err)
@@ -36,13 +42,43 @@ func startServer() (*runningServer, error) {
 		return nil, fmt.Errorf("while creating server work dir: %w", err)
 	}
 
-	cmd := exec.Command("go", "run", ".", "server")
+	rs, err := startServerIn(binaryPath, td, env...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// restartServer stops the server and starts it again with the same work dir and addresses.
+func restartServer(binaryPath string, rs *runningServer, env ...string) (*runningServer, error) {
+	err := rs.stop()
+	if err != nil {
+		return nil, err
+	}
+
+	env = append([]string{
+		"CONTROLLER_ADDR=" + strings.TrimPrefix(rs.serverURL, "http://"),
+		"KARTUSCHES_ADDR=" + strings.TrimPrefix(rs.contentURL, "http://"),
+	}, env...)
+
+	return startServerIn(binaryPath, filepath.Dir(rs.workDir), env...)
+}
+
+// startServerIn starts the server with the work dir in td, td is removed on shutdown.
+func startServerIn(binaryPath string, td string, env ...string) (*runningServer, error) {
+	wd := filepath.Join(td, "work")
+
+	cmd := exec.Command(binaryPath, "server")
 	cmd.Env = append(
 		os.Environ(),
 		"CONTROLLER_ADDR=localhost:0",
 		"KARTUSCHES_ADDR=localhost:0",
 		fmt.Sprintf("WORK_DIR=%s", wd),
+		"AUTH_PROVIDER=mock",
+		"INSECURE_MOCK_AUTH=true",
 	)
+	cmd.Env = append(cmd.Env, env...)
 
 	opr, opw := io.Pipe()
 	output := new(bytes.Buffer)
@@ -54,7 +90,7 @@ func startServer() (*runningServer, error) {
 	processDoneChan := make(chan int)
 	go parseLogs(opr, logChan)
 
-	err = cmd.Start()
+	err := cmd.Start()
 	if err != nil {
 		return nil, fmt.Errorf("while starting server: %w", err)
 	}
@@ -74,7 +110,7 @@ func startServer() (*runningServer, error) {
 	serverURL := ""
 	contentURL := ""
 
-	for serverURL == "" && contentURL == "" {
+	for serverURL == "" || contentURL == "" {
 		select {
 		case <-processDoneChan:
 			return nil, fmt.Errorf("server has died before properly starting:\n%s\n", output.String())
@@ -91,24 +127,43 @@ func startServer() (*runningServer, error) {
 		}
 	}
 
+	stopped := false
+
+	stop := func() error {
+		if stopped {
+			return nil
+		}
+
+		select {
+		case <-processDoneChan:
+			// all good, server is down
+		default:
+			err := cmd.Process.Kill()
+			if err != nil {
+				return fmt.Errorf("while killing process: %w", err)
+			}
+			select {
+			case <-time.NewTimer(3 * time.Second).C:
+				return fmt.Errorf("timed out while shutting down server")
+			case <-processDoneChan:
+				// all good, server is down now, continue
+			}
+		}
+
+		stopped = true
+
+		return nil
+	}
+
 	return &runningServer{
 		serverURL:  serverURL,
 		contentURL: contentURL,
+		workDir:    wd,
+		stop:       stop,
 		shutdown: func() error {
-			select {
-			case <-processDoneChan:
-				// all good, server is down
-			default:
-				err = cmd.Process.Kill()
-				if err != nil {
-					return fmt.Errorf("while killing process: %w", err)
-				}
-				select {
-				case <-time.NewTimer(3 * time.Second).C:
-					return fmt.Errorf("timed out while shutting down server")
-				case <-processDoneChan:
-					// all good, server is down now, continue
-				}
+			err := stop()
+			if err != nil {
+				return err
 			}
 
 			return os.RemoveAll(td)